@@ -21,6 +21,8 @@
       {
         packages.default = import ./nix/packages.nix { inherit pkgs; };
         devShells.default = import ./nix/shell.nix { inherit pkgs; };
+        # Building the package fails when vendorHash is stale.
+        checks.default = self.packages.${system}.default;
       }
     )
     // {
@@ -0,0 +1,735 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hambosto/wallpaper-manager/internal/config"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK        = 0
+	ExitFailure   = 1
+	ExitUsage     = 2
+	ExitNoBackend = 3
+	ExitConfig    = 4
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(r *runner, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"set", "<path>", "Set a wallpaper", runSet},
+	{"list", "", "List wallpapers in the library", runList},
+	{"current", "", "Show the current wallpaper of each output", runCurrent},
+	{"random", "", "Set a random wallpaper", runRandom},
+	{"next", "", "Set the wallpaper after the current one", runNext},
+	{"prev", "", "Set the wallpaper before the current one", runPrev},
+	{"restore", "", "Reapply the last wallpapers, e.g. on login", runRestore},
+	{"undo", "", "Go back to the previous wallpaper", runUndo},
+	{"redo", "", "Reapply the wallpaper last undone", runRedo},
+	{"history", "", "List recently set wallpapers", runHistory},
+	{"rotate", "[run|pause|resume|skip|status]", "Rotate wallpapers through playlists", runRotate},
+	{"schedule", "[run|status|timeline]", "Switch wallpapers at times of day", runSchedule},
+	{"gui", "", "Open the graphical interface (default)", nil},
+}
+
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+type runner struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	jsonOutput bool
+	dir        string
+	config     *config.Config
+	service    *service.WallpaperService
+}
+
+// Run executes the subcommand in args[0] and returns the process exit code.
+// Fyne is never initialised on this path.
+func Run(args []string, stdout, stderr io.Writer) int {
+	r := &runner{stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		r.usage(stdout)
+		return ExitOK
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] && commands[i].run != nil {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "wallpaper-manager: unknown command %q\n\n", args[0])
+		r.usage(stderr)
+		return ExitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&r.jsonOutput, "json", false, "print machine-readable JSON")
+	fs.StringVar(&r.dir, "dir", "", "wallpaper directory to use instead of the library roots from config")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: wallpaper-manager %s [flags] %s\n\n%s.\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	err := cmd.run(r, fs, args[1:])
+	return r.exit(err)
+}
+
+func (r *runner) usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: wallpaper-manager [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'wallpaper-manager <command> -h' for the flags of a command.")
+}
+
+// exit reports err and maps it to an exit code.
+func (r *runner) exit(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+
+	code := ExitFailure
+	var usageErr usageError
+	switch {
+	case errors.As(err, &usageErr):
+		code = ExitUsage
+	case errors.Is(err, service.ErrNoBackend):
+		code = ExitNoBackend
+	case errors.Is(err, errConfig):
+		code = ExitConfig
+	}
+
+	if r.jsonOutput {
+		r.printJSON(map[string]any{"error": err.Error(), "code": code})
+	} else {
+		fmt.Fprintf(r.stderr, "wallpaper-manager: %v\n", err)
+	}
+	return code
+}
+
+var errConfig = errors.New("config")
+
+// parse parses flags, which may appear before or after positional arguments,
+// and sets up the service from the config. Positional arguments other than
+// nargs are a usage error.
+func (r *runner) parse(fs *flag.FlagSet, args []string, nargs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageError{err.Error()}
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != nargs {
+		fs.Usage()
+		return nil, usageError{fmt.Sprintf("%s: expected %d argument(s), got %d", fs.Name(), nargs, len(positional))}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errConfig, err)
+	}
+
+	roots := cfg.Roots()
+	if r.dir != "" {
+		roots = service.NewLibraryRoots(r.dir)
+	}
+
+	backend, err := cfg.NewBackend()
+	if err != nil && !errors.Is(err, service.ErrNoBackend) {
+		return nil, err
+	}
+
+	r.config = cfg
+	r.service = service.NewWallpaperService(roots, backend)
+	r.service.DefaultTransition = cfg.TransitionOptions()
+	r.service.HistorySize = cfg.History.Size
+	r.service.Scan = cfg.ScanOptions()
+	return positional, nil
+}
+
+func (r *runner) printJSON(v any) {
+	enc := json.NewEncoder(r.stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+type applyFlags struct {
+	output     string
+	transition string
+}
+
+func (a *applyFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&a.output, "output", "", "apply to this output only (default all)")
+	fs.StringVar(&a.transition, "transition", "", "transition type (default from config)")
+}
+
+func (r *runner) apply(a *applyFlags, path string) error {
+	transition := r.service.DefaultTransition
+	if a.transition != "" {
+		transition = transition.WithType(service.TransitionType(a.transition))
+	}
+
+	if err := r.service.ApplyWallpaper(a.output, path, transition); err != nil {
+		return err
+	}
+	return r.reportSet(a.output, path)
+}
+
+func (r *runner) reportSet(output, path string) error {
+	if r.jsonOutput {
+		result := map[string]string{"path": path}
+		if output != "" {
+			result["output"] = output
+		}
+		r.printJSON(result)
+		return nil
+	}
+
+	if output != "" {
+		fmt.Fprintf(r.stdout, "Wallpaper set on %s: %s\n", output, path)
+	} else {
+		fmt.Fprintf(r.stdout, "Wallpaper set: %s\n", path)
+	}
+	return nil
+}
+
+func runSet(r *runner, fs *flag.FlagSet, args []string) error {
+	var a applyFlags
+	a.register(fs)
+	span := fs.Bool("span", false, "slice the image across all outputs")
+
+	rest, err := r.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path := rest[0]
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	if *span {
+		transition := r.service.DefaultTransition
+		if a.transition != "" {
+			transition = transition.WithType(service.TransitionType(a.transition))
+		}
+		if err := r.service.SpanWallpaperWithTransition(path, transition); err != nil {
+			return err
+		}
+		return r.reportSet("", path)
+	}
+	return r.apply(&a, path)
+}
+
+func runList(r *runner, fs *flag.FlagSet, args []string) error {
+	root := fs.String("root", "", "only list wallpapers from the library root with this label")
+	withMetadata := fs.Bool("metadata", false, "decode every image to include its dimensions, hash and colours")
+	tags := fs.String("tags", "", "only list wallpapers matching a tag query, e.g. 'dark AND NOT anime'")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+	query, err := service.ParseTagQuery(*tags)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+
+	scan, err := r.service.ScanLibrary(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, unavailable := range scan.Unavailable {
+		fmt.Fprintf(r.stderr, "wallpaper-manager: skipping unavailable root %s\n", unavailable)
+	}
+
+	wallpapers := make([]model.Wallpaper, 0, len(scan.Wallpapers))
+	for _, wp := range scan.Wallpapers {
+		if (*root == "" || wp.Root == *root) && query.Match(wp.Tags) {
+			wallpapers = append(wallpapers, wp)
+		}
+	}
+
+	if *withMetadata {
+		if err := r.service.Metadata.ExtractAll(context.Background(), wallpapers, int64(runtime.NumCPU())); err != nil {
+			return err
+		}
+	}
+
+	if r.jsonOutput {
+		r.printJSON(wallpapers)
+		return nil
+	}
+	for _, wp := range wallpapers {
+		switch {
+		case wp.Unsupported != "":
+			fmt.Fprintf(r.stdout, "%s  [%s]\n", wp.Path, wp.Unsupported)
+		case wp.Metadata != nil:
+			m := wp.Metadata
+			fmt.Fprintf(r.stdout, "%s  %dx%d %s %s\n", wp.Path, m.Width, m.Height, wp.Format, strings.Join(m.Colors, ","))
+		default:
+			fmt.Fprintln(r.stdout, wp.Path)
+		}
+	}
+	return nil
+}
+
+func runCurrent(r *runner, fs *flag.FlagSet, args []string) error {
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	current, err := r.service.CurrentWallpapers()
+	if err != nil {
+		return err
+	}
+
+	if r.jsonOutput {
+		r.printJSON(outputMap(current))
+		return nil
+	}
+	printOutputs(r.stdout, current)
+	return nil
+}
+
+func runRandom(r *runner, fs *flag.FlagSet, args []string) error {
+	var a applyFlags
+	a.register(fs)
+	favorites := fs.Bool("favorites", false, "pick among favorite wallpapers only")
+	tags := fs.String("tags", "", "pick among wallpapers matching a tag query, e.g. 'dark AND NOT anime'")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+	query, err := service.ParseTagQuery(*tags)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+
+	wp, err := r.service.RandomWallpaper(service.RandomOptions{
+		Exclude:       r.currentPath(a.output),
+		FavoritesOnly: *favorites,
+		Tags:          query,
+	})
+	if err != nil {
+		return err
+	}
+	return r.apply(&a, wp.Path)
+}
+
+func runNext(r *runner, fs *flag.FlagSet, args []string) error {
+	return runStep(r, fs, args, 1)
+}
+
+func runPrev(r *runner, fs *flag.FlagSet, args []string) error {
+	return runStep(r, fs, args, -1)
+}
+
+func runStep(r *runner, fs *flag.FlagSet, args []string, delta int) error {
+	var a applyFlags
+	a.register(fs)
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	wp, err := r.service.AdjacentWallpaper(r.currentPath(a.output), delta)
+	if err != nil {
+		return err
+	}
+	return r.apply(&a, wp.Path)
+}
+
+func runRestore(r *runner, fs *flag.FlagSet, args []string) error {
+	timeout := fs.Duration("timeout", -1, "how long to wait for the backend (default from config)")
+	defaultPath := fs.String("default", "", "wallpaper to use when none was saved (default from config)")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	opts := service.RestoreOptions{
+		Timeout: time.Duration(r.config.Restore.Timeout) * time.Second,
+		Default: r.config.Restore.Default,
+		Detect:  r.config.NewBackend,
+	}
+	if *timeout >= 0 {
+		opts.Timeout = *timeout
+	}
+	if *defaultPath != "" {
+		opts.Default = *defaultPath
+	}
+
+	// Wallpapers restored before a failure are still listed in text mode.
+	restored, err := r.service.RestoreWallpapers(opts)
+	if r.jsonOutput {
+		if err != nil {
+			return err
+		}
+		r.printJSON(outputMap(restored))
+		return nil
+	}
+	printOutputs(r.stdout, restored)
+	return err
+}
+
+func runUndo(r *runner, fs *flag.FlagSet, args []string) error {
+	return runHistoryStep(r, fs, args, true)
+}
+
+func runRedo(r *runner, fs *flag.FlagSet, args []string) error {
+	return runHistoryStep(r, fs, args, false)
+}
+
+func runHistoryStep(r *runner, fs *flag.FlagSet, args []string, undo bool) error {
+	output := fs.String("output", "", "output whose history to use (default the every-output history)")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	var wp *service.ActiveWallpaper
+	var err error
+	if undo {
+		wp, err = r.service.Undo(*output)
+	} else {
+		wp, err = r.service.Redo(*output)
+	}
+	if err != nil {
+		return err
+	}
+	return r.reportSet(*output, wp.Path)
+}
+
+func runHistory(r *runner, fs *flag.FlagSet, args []string) error {
+	limit := fs.Int("limit", 20, "number of entries to show, 0 for all")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	history, err := service.LoadHistory()
+	if err != nil {
+		return err
+	}
+	entries := history.Recent(*limit)
+
+	if r.jsonOutput {
+		type jsonEntry struct {
+			Output string `json:"output"`
+			service.ActiveWallpaper
+		}
+		out := make([]jsonEntry, 0, len(entries))
+		for _, e := range entries {
+			output := e.Output
+			if output == "" {
+				output = "*"
+			}
+			out = append(out, jsonEntry{Output: output, ActiveWallpaper: e.ActiveWallpaper})
+		}
+		r.printJSON(out)
+		return nil
+	}
+
+	for _, e := range entries {
+		output := e.Output
+		if output == "" {
+			output = "*"
+		}
+		fmt.Fprintf(r.stdout, "%s  %-8s %s\n", e.SetAt.Local().Format(time.DateTime), output, e.Path)
+	}
+	return nil
+}
+
+func runRotate(r *runner, fs *flag.FlagSet, args []string) error {
+	action := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	output := fs.String("output", "", "skip on this output only (default every rotated output)")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	rotation := service.NewRotation(r.service, r.config.RotationOptions())
+	rotation.OnChange = func(output, path string) {
+		_ = r.reportSet(output, path)
+	}
+
+	var err error
+	switch action {
+	case "run":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return rotation.Run(ctx, func(err error) {
+			fmt.Fprintf(r.stderr, "wallpaper-manager: %v\n", err)
+		})
+	case "skip":
+		return rotation.Skip(context.Background(), *output)
+	case "pause":
+		err = rotation.Pause()
+	case "resume":
+		err = rotation.Resume()
+	case "status":
+	default:
+		return usageError{fmt.Sprintf("rotate: unknown action %q (expected run, pause, resume, skip or status)", action)}
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := rotation.Status()
+	if err != nil {
+		return err
+	}
+	for i := range status.Outputs {
+		if status.Outputs[i].Output == "" {
+			status.Outputs[i].Output = "*"
+		}
+	}
+	if r.jsonOutput {
+		r.printJSON(status)
+		return nil
+	}
+
+	switch {
+	case status.Paused:
+		fmt.Fprintln(r.stdout, "Rotation paused")
+	case status.Running:
+		fmt.Fprintln(r.stdout, "Rotation running")
+	default:
+		fmt.Fprintln(r.stdout, "Rotation not running; start it with 'wallpaper-manager rotate'")
+	}
+	for _, o := range status.Outputs {
+		playlist := o.Playlist
+		if playlist == service.LibraryPlaylist {
+			playlist = "(library)"
+		}
+		next := "not started"
+		if !o.NextAt.IsZero() {
+			next = "next " + o.NextAt.Local().Format(time.DateTime)
+		}
+		line := fmt.Sprintf("%-8s %-12s %-24s %s", o.Output, playlist, next, o.Current)
+		fmt.Fprintln(r.stdout, strings.TrimSpace(line))
+	}
+	return nil
+}
+
+func runSchedule(r *runner, fs *flag.FlagSet, args []string) error {
+	action := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	output := fs.String("output", "", "output whose timeline to show (default the wallpapers for every output)")
+	date := fs.String("date", "", "day whose timeline to show, as YYYY-MM-DD (default today)")
+
+	if _, err := r.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if action != "run" && action != "status" && action != "timeline" {
+		return usageError{fmt.Sprintf("schedule: unknown action %q (expected run, status or timeline)", action)}
+	}
+
+	day := time.Now()
+	if *date != "" {
+		var err error
+		if day, err = time.ParseInLocation(time.DateOnly, *date, time.Local); err != nil {
+			return usageError{fmt.Sprintf("schedule: invalid date %q, expected YYYY-MM-DD", *date)}
+		}
+	}
+
+	schedule := r.config.ScheduleOptions()
+	if schedule.Empty() {
+		return fmt.Errorf("%w; add them to the [schedule] section of the config", service.ErrEmptySchedule)
+	}
+	if err := schedule.ReadFolders(context.Background(), r.service.Scan); err != nil {
+		return err
+	}
+
+	switch action {
+	case "run":
+		scheduler := service.NewScheduler(r.service, schedule)
+		scheduler.OnChange = func(output, path string) {
+			_ = r.reportSet(output, path)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return scheduler.Run(ctx, func(err error) {
+			fmt.Fprintf(r.stderr, "wallpaper-manager: %v\n", err)
+		})
+	case "timeline":
+		return r.printTimeline(schedule.Timeline(day, *output))
+	}
+	return r.printScheduleStatus(schedule)
+}
+
+func (r *runner) printTimeline(timeline []service.ScheduledChange) error {
+	if r.jsonOutput {
+		for i := range timeline {
+			if timeline[i].Output == "" {
+				timeline[i].Output = "*"
+			}
+		}
+		r.printJSON(timeline)
+		return nil
+	}
+
+	for hour, change := range timeline {
+		path := change.Path
+		if path == "" {
+			path = "-"
+		}
+		fmt.Fprintf(r.stdout, "%02d:00  %s\n", hour, path)
+	}
+	return nil
+}
+
+func (r *runner) printScheduleStatus(schedule *service.Schedule) error {
+	now := time.Now()
+	active := schedule.Active(now)
+	changes := make([]service.ScheduledChange, 0, len(active))
+	for _, output := range sortedKeys(active) {
+		change := active[output]
+		if change.Output == "" {
+			change.Output = "*"
+		}
+		changes = append(changes, change)
+	}
+	next, hasNext := schedule.Next(now)
+	if next.Output == "" {
+		next.Output = "*"
+	}
+	sunrise, sunset, _, hasSun := schedule.SunTimes(now)
+	located := schedule.Latitude != 0 || schedule.Longitude != 0
+
+	if r.jsonOutput {
+		status := struct {
+			Running bool                      `json:"running"`
+			Sunrise *time.Time                `json:"sunrise,omitempty"`
+			Sunset  *time.Time                `json:"sunset,omitempty"`
+			Active  []service.ScheduledChange `json:"active"`
+			Next    *service.ScheduledChange  `json:"next,omitempty"`
+		}{Running: service.ScheduleRunning(), Active: changes}
+		if located && hasSun {
+			status.Sunrise, status.Sunset = &sunrise, &sunset
+		}
+		if hasNext {
+			status.Next = &next
+		}
+		r.printJSON(status)
+		return nil
+	}
+
+	if service.ScheduleRunning() {
+		fmt.Fprintln(r.stdout, "Schedule running")
+	} else {
+		fmt.Fprintln(r.stdout, "Schedule not running; start it with 'wallpaper-manager schedule'")
+	}
+	switch {
+	case located && hasSun:
+		fmt.Fprintf(r.stdout, "Sunrise %s, sunset %s\n", sunrise.Format("15:04"), sunset.Format("15:04"))
+	case located:
+		fmt.Fprintln(r.stdout, "The sun does not rise or set today")
+	}
+	for _, change := range changes {
+		fmt.Fprintf(r.stdout, "%-8s since %s  %s\n", change.Output, change.At.Format(time.DateTime), change.Path)
+	}
+	if hasNext {
+		fmt.Fprintf(r.stdout, "Next change on %s at %s: %s\n", next.Output, next.At.Format(time.DateTime), next.Path)
+	}
+	return nil
+}
+
+// currentPath returns the wallpaper shown on output, or on any output when
+// output is empty.
+func (r *runner) currentPath(output string) string {
+	current, err := r.service.CurrentWallpapers()
+	if err != nil {
+		return ""
+	}
+	if path, ok := current[output]; ok {
+		return path
+	}
+	if output == "" {
+		keys := sortedKeys(current)
+		if len(keys) > 0 {
+			return current[keys[0]]
+		}
+	}
+	return ""
+}
+
+// outputMap renames the every-output key "" to "*" for JSON consumers.
+func outputMap(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for output, path := range m {
+		if output == "" {
+			output = "*"
+		}
+		out[output] = path
+	}
+	return out
+}
+
+func printOutputs(w io.Writer, m map[string]string) {
+	for _, output := range sortedKeys(m) {
+		if output == "" {
+			fmt.Fprintln(w, m[output])
+		} else {
+			fmt.Fprintf(w, "%s: %s\n", output, m[output])
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setup points the configuration and state at a temporary directory and
+// replaces $PATH with a fake swww logging its arguments to the returned
+// file. The configuration uses a wipe with an angle by default.
+func setup(t *testing.T) (dir, log string) {
+	t.Helper()
+	dir = t.TempDir()
+	for name, value := range map[string]string{
+		"HOME":                      dir,
+		"XDG_CONFIG_HOME":           filepath.Join(dir, "config"),
+		"XDG_STATE_HOME":            filepath.Join(dir, "state"),
+		"XDG_CACHE_HOME":            filepath.Join(dir, "cache"),
+		"WAYLAND_DISPLAY":           "wayland-1",
+		"WALLPAPER_MANAGER_BACKEND": "",
+	} {
+		t.Setenv(name, value)
+	}
+
+	config := `[library]
+roots = [{ path = "` + dir + `" }]
+
+[backend]
+name = "swww"
+
+[transition]
+type = "wipe"
+angle = 30
+`
+	if err := os.MkdirAll(filepath.Join(dir, "config", "wallpaper-manager"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config", "wallpaper-manager", "config.toml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := filepath.Join(dir, "bin")
+	log = filepath.Join(dir, "swww.log")
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+img) echo "$*" >> '%s' ;;
+query) echo 'DP-1: 64x48, scale: 1, currently displaying: color: 000000' ;;
+esac
+`, log)
+	if err := os.MkdirAll(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bin, "swww"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	return dir, log
+}
+
+// writePNG writes a small grey image to dir.
+func writePNG(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "a.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSetTransitionOverride(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"config default", nil, "--transition-type wipe --transition-angle 30"},
+		{"type without angle", []string{"--transition", "fade"}, "--transition-type fade"},
+		{"type with angle", []string{"--transition", "wave"}, "--transition-type wave --transition-angle 30"},
+		{"spanned", []string{"--transition", "fade", "--span"}, "--transition-type fade"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, log := setup(t)
+			path := writePNG(t, dir)
+
+			var stdout, stderr bytes.Buffer
+			args := append(append([]string{"set"}, tt.args...), path)
+			if code := Run(args, &stdout, &stderr); code != ExitOK {
+				t.Fatalf("Run(%q) = %d: %s", args, code, stderr.String())
+			}
+			data, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line := strings.SplitN(string(data), "\n", 2)[0]; !strings.Contains(line, tt.want) {
+				t.Errorf("swww %s, want it to include %q", line, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,607 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// DirEnv and TransitionEnv override the corresponding config values. The
+// backend is overridden by service.BackendEnv and service.CommandEnv.
+const (
+	DirEnv        = "WALLPAPER_MANAGER_DIR"
+	TransitionEnv = "WALLPAPER_MANAGER_TRANSITION"
+)
+
+type Config struct {
+	WallpaperDir string           `toml:"wallpaper_dir,omitempty"`
+	Library      LibraryConfig    `toml:"library"`
+	Backend      BackendConfig    `toml:"backend"`
+	Transition   TransitionConfig `toml:"transition"`
+	Window       WindowConfig     `toml:"window"`
+	Preview      PreviewConfig    `toml:"preview"`
+	Restore      RestoreConfig    `toml:"restore"`
+	History      HistoryConfig    `toml:"history"`
+	Rotation     RotationConfig   `toml:"rotation"`
+	// Playlists are the playlists the rotation can use, by name.
+	Playlists map[string]PlaylistConfig `toml:"playlists,omitempty"`
+	Schedule  ScheduleConfig            `toml:"schedule"`
+
+	path      string
+	envValues map[string]string
+	saved     guiSettings
+}
+
+// LibraryConfig lists the library roots and controls how they are scanned.
+// When Roots is empty, WallpaperDir is the only root. MaxDepth counts the
+// root itself, so 1 reads only the top level; 0 has no limit. Exclude holds
+// gitignore-style patterns.
+type LibraryConfig struct {
+	Roots          []RootConfig `toml:"roots,omitempty"`
+	MaxDepth       int          `toml:"max_depth"`
+	FollowSymlinks bool         `toml:"follow_symlinks"`
+	Hidden         bool         `toml:"hidden"`
+	Exclude        []string     `toml:"exclude,omitempty"`
+}
+
+// RootConfig is one library root. Label defaults to the folder's name.
+type RootConfig struct {
+	Path  string `toml:"path"`
+	Label string `toml:"label,omitempty"`
+}
+
+type BackendConfig struct {
+	Name    string `toml:"name"`
+	Command string `toml:"command,omitempty"`
+	Mode    string `toml:"mode,omitempty"`
+}
+
+// TransitionConfig holds the default transition. Bezier is [x1, y1, x2, y2]
+// and Wave is [width, height]; both are optional.
+type TransitionConfig struct {
+	Type     string    `toml:"type"`
+	Step     int       `toml:"step,omitzero"`
+	FPS      int       `toml:"fps,omitzero"`
+	Duration float64   `toml:"duration,omitzero"`
+	Angle    float64   `toml:"angle,omitzero"`
+	Position string    `toml:"position,omitempty"`
+	Bezier   []float64 `toml:"bezier,omitempty"`
+	Wave     []float64 `toml:"wave,omitempty"`
+}
+
+// WindowConfig holds the window layout. View is how the library is shown,
+// ListView or GridView, and Sort the order of the wallpapers, one of
+// SortOrders.
+type WindowConfig struct {
+	Width          float32 `toml:"width"`
+	Height         float32 `toml:"height"`
+	SplitOffset    float64 `toml:"split_offset"`
+	View           string  `toml:"view"`
+	Sort           string  `toml:"sort"`
+	SortDescending bool    `toml:"sort_descending"`
+}
+
+const (
+	ListView = "list"
+	GridView = "grid"
+)
+
+const (
+	// SortFolder keeps the order of the library: by folder, then name.
+	SortFolder     = "folder"
+	SortName       = "name"
+	SortDate       = "date"
+	SortSize       = "size"
+	SortResolution = "resolution"
+	SortLastUsed   = "last_used"
+	SortRating     = "rating"
+)
+
+var SortOrders = []string{SortFolder, SortName, SortDate, SortSize, SortResolution, SortLastUsed, SortRating}
+
+type PreviewConfig struct {
+	CacheSizeMB   int `toml:"cache_size_mb"`
+	MaxConcurrent int `toml:"max_concurrent"`
+	MaxSize       int `toml:"max_size"`
+}
+
+// RestoreConfig controls `wallpaper-manager restore`. Default is applied when
+// there is no saved wallpaper, and Timeout is how many seconds to wait for the
+// backend's daemon.
+type RestoreConfig struct {
+	Default string `toml:"default,omitempty"`
+	Timeout int    `toml:"timeout"`
+}
+
+// HistoryConfig sets how many wallpapers are remembered per output for undo.
+// A size of 0 disables the history.
+type HistoryConfig struct {
+	Size int `toml:"size"`
+}
+
+// RotationConfig controls `wallpaper-manager rotate`. Playlist rotates on
+// every output, the whole library when empty, and Outputs gives outputs
+// playlists of their own. Interval and Order apply to playlists without
+// their own; Order is one of service.RotationOrders.
+type RotationConfig struct {
+	Interval time.Duration     `toml:"interval"`
+	Order    string            `toml:"order"`
+	Playlist string            `toml:"playlist,omitempty"`
+	Outputs  map[string]string `toml:"outputs,omitempty"`
+}
+
+// PlaylistConfig is a playlist made of Paths, the images below Folders and
+// the library's images matching the tag query Tags.
+type PlaylistConfig struct {
+	Paths    []string      `toml:"paths,omitempty"`
+	Folders  []string      `toml:"folders,omitempty"`
+	Tags     string        `toml:"tags,omitempty"`
+	Order    string        `toml:"order,omitempty"`
+	Interval time.Duration `toml:"interval,omitzero"`
+}
+
+// ScheduleConfig controls `wallpaper-manager schedule`. Latitude and
+// Longitude, in degrees with north and east positive, locate sunrise and
+// sunset for the rules and dynamic wallpapers that follow the sun.
+type ScheduleConfig struct {
+	Latitude  float64         `toml:"latitude,omitzero"`
+	Longitude float64         `toml:"longitude,omitzero"`
+	Rules     []RuleConfig    `toml:"rules,omitempty"`
+	Dynamic   []DynamicConfig `toml:"dynamic,omitempty"`
+}
+
+// RuleConfig shows Wallpaper from At, a time such as "07:30" or
+// "sunset-30m", on Days, such as ["sat", "sun"], or every day when empty.
+type RuleConfig struct {
+	At         string   `toml:"at"`
+	Days       []string `toml:"days,omitempty"`
+	Wallpaper  string   `toml:"wallpaper"`
+	Output     string   `toml:"output,omitempty"`
+	Transition string   `toml:"transition,omitempty"`
+}
+
+// DynamicConfig spreads Images, or the images in Folder, over the day; see
+// service.DynamicWallpaper.
+type DynamicConfig struct {
+	Images     []string `toml:"images,omitempty"`
+	Folder     string   `toml:"folder,omitempty"`
+	Sun        bool     `toml:"sun,omitempty"`
+	Output     string   `toml:"output,omitempty"`
+	Transition string   `toml:"transition,omitempty"`
+}
+
+// envOverrides maps environment variables to the string settings they
+// replace.
+var envOverrides = []struct {
+	name  string
+	field func(*Config) *string
+}{
+	{DirEnv, func(c *Config) *string { return &c.WallpaperDir }},
+	{service.BackendEnv, func(c *Config) *string { return &c.Backend.Name }},
+	{service.CommandEnv, func(c *Config) *string { return &c.Backend.Command }},
+	{TransitionEnv, func(c *Config) *string { return &c.Transition.Type }},
+}
+
+// Default returns the built-in settings. It is not backed by a file, so Save
+// is a no-op.
+func Default() *Config {
+	return &Config{
+		Backend:    BackendConfig{Name: "auto"},
+		Transition: TransitionConfig{Type: string(service.TransitionOuter)},
+		Window:     WindowConfig{Width: 1000, Height: 600, SplitOffset: 0.3, View: ListView, Sort: SortFolder},
+		Preview:    PreviewConfig{CacheSizeMB: 200, MaxConcurrent: 3, MaxSize: 1200},
+		Restore:    RestoreConfig{Timeout: 30},
+		History:    HistoryConfig{Size: service.DefaultHistorySize},
+		Rotation:   RotationConfig{Interval: service.DefaultRotationInterval, Order: string(service.OrderSequential)},
+	}
+}
+
+// DefaultWallpaperDir is used when no library root is configured.
+func DefaultWallpaperDir() string {
+	return filepath.Join(os.Getenv("HOME"), "Pictures")
+}
+
+// Path returns $XDG_CONFIG_HOME/wallpaper-manager/config.toml.
+func Path() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "wallpaper-manager", "config.toml"), nil
+}
+
+// Load reads the config file from Path, falling back to defaults when it does
+// not exist, and applies environment overrides.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads the config at path. Missing settings keep their defaults.
+// Syntax and type errors are reported with their line number.
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+	cfg.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			var parseErr toml.ParseError
+			if errors.As(err, &parseErr) && parseErr.Message != "" {
+				return nil, fmt.Errorf("%s:%d: %s", path, parseErr.Position.Line, parseErr.Message)
+			}
+			return nil, fmt.Errorf("%s: %s", path, strings.TrimPrefix(err.Error(), "toml: "))
+		}
+
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return nil, fmt.Errorf("%s: unknown settings: %s", path, strings.Join(keys, ", "))
+		}
+	}
+
+	cfg.applyEnv()
+	cfg.WallpaperDir = expandHome(cfg.WallpaperDir)
+	rawRoots := make(map[string]string, len(cfg.Library.Roots))
+	for i := range cfg.Library.Roots {
+		root := &cfg.Library.Roots[i]
+		raw := root.Path
+		root.Path = expandHome(raw)
+		rawRoots[root.Path] = raw
+	}
+	cfg.Restore.Default = expandHome(cfg.Restore.Default)
+	for name, playlist := range cfg.Playlists {
+		for i := range playlist.Paths {
+			playlist.Paths[i] = expandHome(playlist.Paths[i])
+		}
+		for i := range playlist.Folders {
+			playlist.Folders[i] = expandHome(playlist.Folders[i])
+		}
+		cfg.Playlists[name] = playlist
+	}
+	for i := range cfg.Schedule.Rules {
+		cfg.Schedule.Rules[i].Wallpaper = expandHome(cfg.Schedule.Rules[i].Wallpaper)
+	}
+	for i := range cfg.Schedule.Dynamic {
+		dynamic := &cfg.Schedule.Dynamic[i]
+		for j := range dynamic.Images {
+			dynamic.Images[j] = expandHome(dynamic.Images[j])
+		}
+		dynamic.Folder = expandHome(dynamic.Folder)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.saved = cfg.guiSettings()
+	cfg.saved.rawRoots = rawRoots
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() {
+	c.envValues = make(map[string]string)
+	for _, o := range envOverrides {
+		if value := os.Getenv(o.name); value != "" {
+			c.envValues[o.name] = value
+			*o.field(c) = value
+		}
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Backend.Name != "auto" && !slices.Contains(service.BackendNames(), c.Backend.Name) {
+		return fmt.Errorf("backend.name: unknown backend %q (known: auto, %s)", c.Backend.Name, strings.Join(service.BackendNames(), ", "))
+	}
+	if _, err := service.SplitCommand(c.Backend.Command); err != nil {
+		return fmt.Errorf("backend.command: %w", err)
+	}
+	// The environment may pick another backend or hold a command for
+	// detection, but a file naming both is a mistake.
+	_, nameFromEnv := c.envValues[service.BackendEnv]
+	_, commandFromEnv := c.envValues[service.CommandEnv]
+	if c.Backend.Command != "" && c.Backend.Name != "command" && !nameFromEnv && !commandFromEnv {
+		return fmt.Errorf("backend.command: only used with name = \"command\", got %q", c.Backend.Name)
+	}
+	for i, root := range c.Library.Roots {
+		if root.Path == "" {
+			return fmt.Errorf("library.roots[%d]: path must be set", i)
+		}
+	}
+	if c.Library.MaxDepth < 0 {
+		return fmt.Errorf("library.max_depth: must not be negative, got %d", c.Library.MaxDepth)
+	}
+	if _, err := service.NewExcludeMatcher(c.Library.Exclude); err != nil {
+		return fmt.Errorf("library.exclude: %w", err)
+	}
+	if len(c.Transition.Bezier) != 0 && len(c.Transition.Bezier) != 4 {
+		return fmt.Errorf("transition.bezier: expected [x1, y1, x2, y2], got %d values", len(c.Transition.Bezier))
+	}
+	if len(c.Transition.Wave) != 0 && len(c.Transition.Wave) != 2 {
+		return fmt.Errorf("transition.wave: expected [width, height], got %d values", len(c.Transition.Wave))
+	}
+	if err := c.TransitionOptions().Validate(); err != nil {
+		return fmt.Errorf("transition: %w", err)
+	}
+	if c.Window.Width <= 0 || c.Window.Height <= 0 {
+		return fmt.Errorf("window: width and height must be positive")
+	}
+	if c.Window.SplitOffset < 0 || c.Window.SplitOffset > 1 {
+		return fmt.Errorf("window.split_offset: must be between 0 and 1, got %g", c.Window.SplitOffset)
+	}
+	if c.Window.View != ListView && c.Window.View != GridView {
+		return fmt.Errorf("window.view: must be %q or %q, got %q", ListView, GridView, c.Window.View)
+	}
+	if !slices.Contains(SortOrders, c.Window.Sort) {
+		return fmt.Errorf("window.sort: must be one of %s, got %q", strings.Join(SortOrders, ", "), c.Window.Sort)
+	}
+	if c.Preview.CacheSizeMB <= 0 {
+		return fmt.Errorf("preview.cache_size_mb: must be positive, got %d", c.Preview.CacheSizeMB)
+	}
+	if c.Preview.MaxConcurrent <= 0 {
+		return fmt.Errorf("preview.max_concurrent: must be positive, got %d", c.Preview.MaxConcurrent)
+	}
+	if c.Preview.MaxSize <= 0 {
+		return fmt.Errorf("preview.max_size: must be positive, got %d", c.Preview.MaxSize)
+	}
+	if c.Restore.Timeout < 0 {
+		return fmt.Errorf("restore.timeout: must not be negative, got %d", c.Restore.Timeout)
+	}
+	if c.History.Size < 0 {
+		return fmt.Errorf("history.size: must not be negative, got %d", c.History.Size)
+	}
+	if err := c.validateRotation(); err != nil {
+		return err
+	}
+	return c.validateSchedule()
+}
+
+func (c *Config) validateRotation() error {
+	orders := make([]string, len(service.RotationOrders))
+	for i, order := range service.RotationOrders {
+		orders[i] = string(order)
+	}
+
+	if c.Rotation.Interval <= 0 {
+		return fmt.Errorf("rotation.interval: must be positive, got %s", c.Rotation.Interval)
+	}
+	if !slices.Contains(orders, c.Rotation.Order) {
+		return fmt.Errorf("rotation.order: must be one of %s, got %q", strings.Join(orders, ", "), c.Rotation.Order)
+	}
+	if _, ok := c.Playlists[c.Rotation.Playlist]; c.Rotation.Playlist != "" && !ok {
+		return fmt.Errorf("rotation.playlist: unknown playlist %q", c.Rotation.Playlist)
+	}
+	for output, name := range c.Rotation.Outputs {
+		if _, ok := c.Playlists[name]; name != "" && !ok {
+			return fmt.Errorf("rotation.outputs.%s: unknown playlist %q", output, name)
+		}
+	}
+
+	for name, playlist := range c.Playlists {
+		if name == "" {
+			return fmt.Errorf("playlists: a playlist must have a name")
+		}
+		if playlist.Interval < 0 {
+			return fmt.Errorf("playlists.%s.interval: must not be negative, got %s", name, playlist.Interval)
+		}
+		if playlist.Order != "" && !slices.Contains(orders, playlist.Order) {
+			return fmt.Errorf("playlists.%s.order: must be one of %s, got %q", name, strings.Join(orders, ", "), playlist.Order)
+		}
+		if _, err := service.ParseTagQuery(playlist.Tags); err != nil {
+			return fmt.Errorf("playlists.%s.tags: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateSchedule() error {
+	validTransition := func(transition string) bool {
+		return transition == "" || slices.Contains(service.TransitionTypes, service.TransitionType(transition))
+	}
+
+	if c.Schedule.Latitude < -90 || c.Schedule.Latitude > 90 {
+		return fmt.Errorf("schedule.latitude: must be between -90 and 90, got %g", c.Schedule.Latitude)
+	}
+	if c.Schedule.Longitude < -180 || c.Schedule.Longitude > 180 {
+		return fmt.Errorf("schedule.longitude: must be between -180 and 180, got %g", c.Schedule.Longitude)
+	}
+	located := c.Schedule.Latitude != 0 || c.Schedule.Longitude != 0
+	const unlocated = "latitude and longitude must be set to follow the sun"
+
+	for i, rule := range c.Schedule.Rules {
+		at, err := service.ParseScheduleTime(rule.At)
+		if err != nil {
+			return fmt.Errorf("schedule.rules[%d].at: %w", i, err)
+		}
+		if at.Sun != "" && !located {
+			return fmt.Errorf("schedule.rules[%d].at: %s", i, unlocated)
+		}
+		for _, day := range rule.Days {
+			if _, err := service.ParseWeekday(day); err != nil {
+				return fmt.Errorf("schedule.rules[%d].days: %w", i, err)
+			}
+		}
+		if rule.Wallpaper == "" {
+			return fmt.Errorf("schedule.rules[%d]: wallpaper must be set", i)
+		}
+		if !validTransition(rule.Transition) {
+			return fmt.Errorf("schedule.rules[%d].transition: unknown transition %q", i, rule.Transition)
+		}
+	}
+
+	for i, dynamic := range c.Schedule.Dynamic {
+		if (len(dynamic.Images) == 0) == (dynamic.Folder == "") {
+			return fmt.Errorf("schedule.dynamic[%d]: exactly one of images and folder must be set", i)
+		}
+		if dynamic.Sun && !located {
+			return fmt.Errorf("schedule.dynamic[%d].sun: %s", i, unlocated)
+		}
+		if !validTransition(dynamic.Transition) {
+			return fmt.Errorf("schedule.dynamic[%d].transition: unknown transition %q", i, dynamic.Transition)
+		}
+	}
+	return nil
+}
+
+func (c *Config) TransitionOptions() service.TransitionOptions {
+	t := service.TransitionOptions{
+		Type:     service.TransitionType(c.Transition.Type),
+		Step:     c.Transition.Step,
+		FPS:      c.Transition.FPS,
+		Duration: c.Transition.Duration,
+		Angle:    c.Transition.Angle,
+		Position: c.Transition.Position,
+	}
+	if b := c.Transition.Bezier; len(b) == 4 {
+		t.Bezier = &service.Bezier{X1: b[0], Y1: b[1], X2: b[2], Y2: b[3]}
+	}
+	if w := c.Transition.Wave; len(w) == 2 {
+		t.Wave = &service.Wave{Width: w[0], Height: w[1]}
+	}
+	return t
+}
+
+// RotationOptions returns the rotation settings with the playlists. It
+// assumes the config has been validated.
+func (c *Config) RotationOptions() service.RotationOptions {
+	opts := service.RotationOptions{
+		Interval:  c.Rotation.Interval,
+		Order:     service.RotationOrder(c.Rotation.Order),
+		Playlist:  c.Rotation.Playlist,
+		Outputs:   c.Rotation.Outputs,
+		Playlists: make(map[string]service.Playlist, len(c.Playlists)),
+	}
+	for name, playlist := range c.Playlists {
+		tags, _ := service.ParseTagQuery(playlist.Tags)
+		opts.Playlists[name] = service.Playlist{
+			Name:     name,
+			Paths:    playlist.Paths,
+			Folders:  playlist.Folders,
+			Tags:     tags,
+			Order:    service.RotationOrder(playlist.Order),
+			Interval: playlist.Interval,
+		}
+	}
+	return opts
+}
+
+// ScheduleOptions returns the schedule, in the local time zone. It assumes the
+// config has been validated; the folders of dynamic wallpapers are not read
+// yet, see service.Schedule.ReadFolders.
+func (c *Config) ScheduleOptions() *service.Schedule {
+	schedule := &service.Schedule{
+		Latitude:  c.Schedule.Latitude,
+		Longitude: c.Schedule.Longitude,
+	}
+	for _, rule := range c.Schedule.Rules {
+		at, _ := service.ParseScheduleTime(rule.At)
+		var days []time.Weekday
+		for _, name := range rule.Days {
+			day, _ := service.ParseWeekday(name)
+			days = append(days, day)
+		}
+		schedule.Rules = append(schedule.Rules, service.ScheduleRule{
+			At:         at,
+			Days:       days,
+			Path:       rule.Wallpaper,
+			Output:     rule.Output,
+			Transition: service.TransitionType(rule.Transition),
+		})
+	}
+	for _, dynamic := range c.Schedule.Dynamic {
+		schedule.Dynamic = append(schedule.Dynamic, service.DynamicWallpaper{
+			Images:     slices.Clone(dynamic.Images),
+			Folder:     dynamic.Folder,
+			Sun:        dynamic.Sun,
+			Output:     dynamic.Output,
+			Transition: service.TransitionType(dynamic.Transition),
+		})
+	}
+	return schedule
+}
+
+// Roots returns the library roots. A directory from DirEnv replaces the
+// configured roots, and without any configuration DefaultWallpaperDir is
+// used.
+func (c *Config) Roots() []service.LibraryRoot {
+	if _, ok := c.envValues[DirEnv]; ok && c.WallpaperDir != "" {
+		return service.NewLibraryRoots(c.WallpaperDir)
+	}
+	if len(c.Library.Roots) > 0 {
+		roots := make([]service.LibraryRoot, len(c.Library.Roots))
+		for i, root := range c.Library.Roots {
+			roots[i] = service.LibraryRoot{Path: root.Path, Label: root.Label}
+		}
+		return service.LabelRoots(roots)
+	}
+	if c.WallpaperDir != "" {
+		return service.NewLibraryRoots(c.WallpaperDir)
+	}
+	return service.NewLibraryRoots(DefaultWallpaperDir())
+}
+
+// SetRoots replaces the library roots, which then take the place of
+// wallpaper_dir.
+func (c *Config) SetRoots(roots []service.LibraryRoot) {
+	c.Library.Roots = make([]RootConfig, len(roots))
+	for i, root := range roots {
+		c.Library.Roots[i] = RootConfig{Path: root.Path}
+		if root.Label != filepath.Base(root.Path) && root.Label != root.Path {
+			c.Library.Roots[i].Label = root.Label
+		}
+	}
+	c.WallpaperDir = ""
+}
+
+func (c *Config) ScanOptions() service.ScanOptions {
+	return service.ScanOptions{
+		MaxDepth:       c.Library.MaxDepth,
+		FollowSymlinks: c.Library.FollowSymlinks,
+		IncludeHidden:  c.Library.Hidden,
+		Exclude:        c.Library.Exclude,
+	}
+}
+
+// NewBackend creates the configured backend, applying the command template
+// to the command backend and the mode to backends that can scale.
+func (c *Config) NewBackend() (service.Backend, error) {
+	backend, err := service.NewBackend(c.Backend.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if cb, ok := backend.(*service.CommandBackend); ok && c.Backend.Command != "" && cb.Name() == "command" {
+		template, err := service.SplitCommand(c.Backend.Command)
+		if err != nil {
+			return nil, fmt.Errorf("backend.command: %w", err)
+		}
+		cb.Template = template
+	}
+	if fitter, ok := backend.(service.Fitter); ok && c.Backend.Mode != "" {
+		fitter.SetFitMode(c.Backend.Mode)
+	}
+	return backend, nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(os.Getenv("HOME"), rest)
+	}
+	return path
+}
@@ -0,0 +1,410 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// guiSettings are the settings the GUI changes, as loaded or last saved.
+// Save writes only the ones that differ, so everything else in the file,
+// including comments and the order of keys, stays as the user wrote it.
+type guiSettings struct {
+	WallpaperDir string
+	Roots        []RootConfig
+	Window       WindowConfig
+	// rawRoots maps expanded root paths to how they were written, e.g.
+	// with "~/".
+	rawRoots map[string]string
+}
+
+func (c *Config) guiSettings() guiSettings {
+	return guiSettings{WallpaperDir: c.WallpaperDir, Roots: slices.Clone(c.Library.Roots), Window: c.Window}
+}
+
+// windowKeys are the keys of [window] by field name of WindowConfig.
+var windowKeys = map[string]string{
+	"Width":          "width",
+	"Height":         "height",
+	"SplitOffset":    "split_offset",
+	"View":           "view",
+	"Sort":           "sort",
+	"SortDescending": "sort_descending",
+}
+
+// Save writes the settings changed through the GUI, the window layout and
+// the library roots, back to the file atomically. The file is read again
+// and only the changed keys are replaced, so comments, key order, paths
+// written with "~/" and edits made while the application ran are kept, and
+// values from the environment are never written.
+func (c *Config) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	doc := parseDocument(string(data))
+
+	saved := c.saved
+	window, savedWindow := reflect.ValueOf(c.Window), reflect.ValueOf(saved.Window)
+	for i := range window.NumField() {
+		name := window.Type().Field(i).Name
+		if window.Field(i).Equal(savedWindow.Field(i)) {
+			continue
+		}
+		value, err := tomlValue(window.Field(i).Interface())
+		if err != nil {
+			return err
+		}
+		doc.set("window", windowKeys[name], value)
+	}
+
+	if !slices.Equal(c.Library.Roots, saved.Roots) {
+		roots := make([]RootConfig, len(c.Library.Roots))
+		for i, root := range c.Library.Roots {
+			roots[i] = root
+			if raw, ok := saved.rawRoots[root.Path]; ok {
+				roots[i].Path = raw
+			}
+		}
+		if err := doc.setRoots(roots); err != nil {
+			return err
+		}
+	}
+	if c.WallpaperDir != saved.WallpaperDir {
+		if c.WallpaperDir == "" {
+			doc.remove("", "wallpaper_dir")
+		} else {
+			value, err := tomlValue(c.WallpaperDir)
+			if err != nil {
+				return err
+			}
+			doc.set("", "wallpaper_dir", value)
+		}
+	}
+
+	out := doc.String()
+	if err := c.checkSaved(out); err != nil {
+		return fmt.Errorf("%s: cannot update the settings: %w", c.path, err)
+	}
+	if err := service.WriteFileAtomic(c.path, []byte(out)); err != nil {
+		return err
+	}
+
+	c.saved = c.guiSettings()
+	c.saved.rawRoots = saved.rawRoots
+	return nil
+}
+
+// checkSaved makes sure text reads back with the GUI settings of c, in case
+// the file sets them in a form Save does not edit, such as dotted keys.
+func (c *Config) checkSaved(text string) error {
+	check := Default()
+	if _, err := toml.Decode(text, check); err != nil {
+		return err
+	}
+	for i := range check.Library.Roots {
+		check.Library.Roots[i].Path = expandHome(check.Library.Roots[i].Path)
+	}
+	if !reflect.DeepEqual(check.Window, c.Window) {
+		return fmt.Errorf("window settings read back as %+v", check.Window)
+	}
+	if !slices.Equal(check.Library.Roots, c.Library.Roots) {
+		return fmt.Errorf("library roots read back as %+v", check.Library.Roots)
+	}
+	return nil
+}
+
+// tomlValue formats v as a TOML value.
+func tomlValue(v any) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]any{"v": v}); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(buf.String(), "v = "), "\n"), nil
+}
+
+// document is a TOML file as lines, with the position of every header and
+// key, so single settings can be replaced without touching the rest.
+type document struct {
+	lines   []string
+	entries []entry
+}
+
+// entry is a key, or with header set a [table] or [[array]] header, spanning
+// lines start to end. For keys, valueEnd is where the value ends on the last
+// line, before any comment.
+type entry struct {
+	table    string
+	key      string
+	header   bool
+	array    bool
+	start    int
+	end      int
+	valueEnd int
+}
+
+func parseDocument(text string) *document {
+	text = strings.TrimSuffix(text, "\n")
+	doc := &document{}
+	if text != "" {
+		doc.lines = strings.Split(text, "\n")
+	}
+
+	table := ""
+	for i := 0; i < len(doc.lines); i++ {
+		line := strings.TrimSpace(doc.lines[i])
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[["):
+			table = headerName(line, "[[", "]]")
+			doc.entries = append(doc.entries, entry{table: table, header: true, array: true, start: i, end: i})
+		case strings.HasPrefix(line, "["):
+			table = headerName(line, "[", "]")
+			doc.entries = append(doc.entries, entry{table: table, header: true, start: i, end: i})
+		default:
+			key, _, ok := strings.Cut(doc.lines[i], "=")
+			if !ok {
+				continue
+			}
+			end, col := valueEnd(doc.lines, i, len(key)+1)
+			doc.entries = append(doc.entries, entry{table: table, key: strings.TrimSpace(key), start: i, end: end, valueEnd: col})
+			i = end
+		}
+	}
+	return doc
+}
+
+func headerName(line, open, close string) string {
+	name := strings.TrimPrefix(line, open)
+	if i := strings.Index(name, close); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(name)
+}
+
+// valueEnd finds the end of the value starting at column col of line i,
+// following arrays, inline tables and multi-line strings across lines. It
+// returns the last line of the value and the column just after it, before
+// any comment.
+func valueEnd(lines []string, i, col int) (int, int) {
+	depth := 0
+	quote := ""
+	for ; i < len(lines); i, col = i+1, 0 {
+		line := lines[i]
+		end := col
+		for col < len(line) {
+			if quote != "" {
+				switch {
+				case line[col] == '\\' && quote[0] == '"':
+					col += 2
+				case strings.HasPrefix(line[col:], quote):
+					col += len(quote)
+					quote = ""
+					end = col
+				default:
+					col++
+				}
+				continue
+			}
+
+			c := line[col]
+			if c == '#' {
+				break
+			}
+			switch {
+			case strings.HasPrefix(line[col:], `"""`) || strings.HasPrefix(line[col:], "'''"):
+				quote = line[col : col+3]
+				col += 3
+				continue
+			case c == '"' || c == '\'':
+				quote = string(c)
+				col++
+				continue
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				depth--
+			}
+			col++
+			if c != ' ' && c != '\t' {
+				end = col
+			}
+		}
+
+		// Single-line strings cannot continue on the next line.
+		if quote == `"` || quote == "'" {
+			quote = ""
+		}
+		if depth <= 0 && quote == "" {
+			return i, end
+		}
+	}
+	last := len(lines) - 1
+	return last, len(lines[last])
+}
+
+func (d *document) find(table, key string) (entry, bool) {
+	for _, e := range d.entries {
+		if !e.header && e.table == table && e.key == key {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// set replaces the value of key in table, keeping a trailing comment, or
+// adds the key at the end of the table, and the table at the end of the
+// file if it does not exist.
+func (d *document) set(table, key, value string) {
+	if e, ok := d.find(table, key); ok {
+		first := d.lines[e.start]
+		indent := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+		last := indent + key + " = " + value + d.lines[e.end][e.valueEnd:]
+		d.replace(e.start, e.end+1, []string{last})
+		return
+	}
+
+	line := key + " = " + value
+	if at, ok := d.tableEnd(table); ok {
+		d.replace(at, at, []string{line})
+		return
+	}
+	if len(d.lines) > 0 {
+		d.replace(len(d.lines), len(d.lines), []string{"", "[" + table + "]", line})
+	} else {
+		d.replace(0, 0, []string{"[" + table + "]", line})
+	}
+}
+
+// remove deletes key from table.
+func (d *document) remove(table, key string) {
+	if e, ok := d.find(table, key); ok {
+		d.replace(e.start, e.end+1, nil)
+	}
+}
+
+// tableEnd returns the line after the last key of table, or after its
+// header if it has none. The top-level table always exists.
+func (d *document) tableEnd(table string) (int, bool) {
+	at, found := 0, table == ""
+	for _, e := range d.entries {
+		switch {
+		case e.header && e.table == table && !e.array:
+			at, found = e.end+1, true
+		case !e.header && found && e.table == table:
+			at = e.end + 1
+		}
+	}
+	return at, found
+}
+
+// setRoots replaces the library roots where they are defined, as a
+// library.roots key or as [[library.roots]] tables, writing tables at the
+// end of the file if neither exists.
+func (d *document) setRoots(roots []RootConfig) error {
+	if _, ok := d.find("library", "roots"); ok {
+		value := "[]"
+		if len(roots) > 0 {
+			items := make([]string, len(roots))
+			for i, root := range roots {
+				item, err := rootFields(root)
+				if err != nil {
+					return err
+				}
+				items[i] = "  { " + strings.Join(item, ", ") + " },"
+			}
+			value = "[\n" + strings.Join(items, "\n") + "\n]"
+		}
+		d.set("library", "roots", value)
+		return nil
+	}
+
+	var blocks []string
+	for _, root := range roots {
+		fields, err := rootFields(root)
+		if err != nil {
+			return err
+		}
+		if len(blocks) > 0 {
+			blocks = append(blocks, "")
+		}
+		blocks = append(blocks, "[[library.roots]]")
+		blocks = append(blocks, fields...)
+	}
+
+	// Replace the first [[library.roots]] table and drop the others, from
+	// the last so earlier positions stay valid.
+	at := -1
+	for i := len(d.entries) - 1; i >= 0; i-- {
+		e := d.entries[i]
+		if !e.header || !e.array || e.table != "library.roots" {
+			continue
+		}
+		d.replace(e.start, d.blockEnd(i), nil)
+		at = e.start
+	}
+	if at < 0 {
+		if len(blocks) == 0 {
+			return nil
+		}
+		at = len(d.lines)
+		if at > 0 {
+			blocks = append([]string{""}, blocks...)
+		}
+	}
+	d.replace(at, at, blocks)
+	return nil
+}
+
+// blockEnd returns the line after the last key of the table whose header is
+// entries[i], leaving the comments and blank lines before the next header.
+func (d *document) blockEnd(i int) int {
+	end := d.entries[i].end + 1
+	for _, e := range d.entries[i+1:] {
+		if e.header {
+			break
+		}
+		end = e.end + 1
+	}
+	return end
+}
+
+func rootFields(root RootConfig) ([]string, error) {
+	path, err := tomlValue(root.Path)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{"path = " + path}
+	if root.Label != "" {
+		label, err := tomlValue(root.Label)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, "label = "+label)
+	}
+	return fields, nil
+}
+
+// replace swaps lines[from:to] for lines and parses the document again.
+func (d *document) replace(from, to int, lines []string) {
+	d.lines = slices.Concat(d.lines[:from], lines, d.lines[to:])
+	*d = *parseDocument(d.String())
+}
+
+func (d *document) String() string {
+	if len(d.lines) == 0 {
+		return ""
+	}
+	return strings.Join(d.lines, "\n") + "\n"
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if text != "" {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func readConfig(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSave(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(TransitionEnv, "wave")
+
+	tests := []struct {
+		name   string
+		config string
+		change func(*Config)
+		want   string
+	}{
+		{
+			name: "changed keys only",
+			config: `# My settings.
+[library]
+hidden = true  # dot files too
+
+[[library.roots]]
+path = "~/Pictures"   # the main one
+
+[transition]
+type = "wipe"
+angle = 30
+
+[window]
+sort = "name"
+width = 800   # wide enough
+height = 600
+`,
+			change: func(c *Config) {
+				c.Window.Width = 1234
+				c.Window.SortDescending = true
+			},
+			want: `# My settings.
+[library]
+hidden = true  # dot files too
+
+[[library.roots]]
+path = "~/Pictures"   # the main one
+
+[transition]
+type = "wipe"
+angle = 30
+
+[window]
+sort = "name"
+width = 1234.0   # wide enough
+height = 600
+sort_descending = true
+`,
+		},
+		{
+			name: "roots tables",
+			config: `[[library.roots]]
+path = "~/Pictures"
+# Photos from the camera.
+[[library.roots]]
+path = "/mnt/photos"
+label = "Camera"
+
+[window]
+width = 800
+`,
+			change: func(c *Config) {
+				c.SetRoots([]service.LibraryRoot{
+					{Path: filepath.Join(home, "Pictures"), Label: "Pictures"},
+					{Path: "/srv/art", Label: "Art"},
+				})
+			},
+			want: `[[library.roots]]
+path = "~/Pictures"
+
+[[library.roots]]
+path = "/srv/art"
+label = "Art"
+# Photos from the camera.
+
+[window]
+width = 800
+`,
+		},
+		{
+			name: "roots key",
+			config: `[library]
+roots = [
+  { path = "~/Pictures" },  # main
+  { path = "/mnt/photos", label = "Camera" },
+] # every root
+max_depth = 2
+`,
+			change: func(c *Config) {
+				c.SetRoots([]service.LibraryRoot{{Path: filepath.Join(home, "Pictures"), Label: "Pictures"}})
+			},
+			want: `[library]
+roots = [
+  { path = "~/Pictures" },
+] # every root
+max_depth = 2
+`,
+		},
+		{
+			name: "roots replace wallpaper_dir",
+			config: `wallpaper_dir = "~/Walls"  # old style
+[backend]
+name = "swww"
+`,
+			change: func(c *Config) {
+				c.SetRoots([]service.LibraryRoot{{Path: "/srv/art", Label: "art"}})
+			},
+			want: `[backend]
+name = "swww"
+
+[[library.roots]]
+path = "/srv/art"
+`,
+		},
+		{
+			name:   "no file",
+			config: "",
+			change: func(c *Config) { c.Window.View = GridView },
+			want: `[window]
+view = "grid"
+`,
+		},
+		{
+			name: "multi-line strings",
+			config: `[restore]
+default = """
+[window]
+width = 1"""
+
+[window]
+width = 800
+`,
+			change: func(c *Config) { c.Window.Width = 900 },
+			want: `[restore]
+default = """
+[window]
+width = 1"""
+
+[window]
+width = 900.0
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.config)
+			cfg, err := LoadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(cfg)
+			if err := cfg.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if got := readConfig(t, path); got != tt.want {
+				t.Errorf("saved:\n%s\nwant:\n%s", got, tt.want)
+			}
+
+			// Saving again without changes leaves the file alone.
+			if err := cfg.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if got := readConfig(t, path); got != tt.want {
+				t.Errorf("saved again:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveKeepsOtherEdits(t *testing.T) {
+	path := writeConfig(t, "[window]\nwidth = 800\n")
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The user edits the file while the window is open.
+	if err := os.WriteFile(path, []byte("[history]\nsize = 10\n\n[window]\nwidth = 800\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Window.Height = 700
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := "[history]\nsize = 10\n\n[window]\nwidth = 800\nheight = 700.0\n"
+	if got := readConfig(t, path); got != want {
+		t.Errorf("saved:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSaveUneditable(t *testing.T) {
+	text := "window.width = 800\n"
+	path := writeConfig(t, text)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Window.Width = 900
+	if err := cfg.Save(); err == nil {
+		t.Error("Save() of a dotted key succeeded")
+	}
+	if got := readConfig(t, path); got != text {
+		t.Errorf("file changed to:\n%s", got)
+	}
+}
+
+func TestSaveKeepsMode(t *testing.T) {
+	path := writeConfig(t, "[window]\nwidth = 800\n")
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Window.Height = 700
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o640 {
+		t.Errorf("saved file has mode %o, want 640", mode)
+	}
+}
@@ -1,6 +1,50 @@
 package model
 
+import "time"
+
+// Wallpaper is an image in the library. Root is the label of the library
+// folder it was found in, and Dir the slash-separated subfolder relative to
+// that folder, empty at its top level. Format is detected from the file
+// content, and Unsupported explains why the image cannot be decoded, empty
+// when it can.
+//
+// Size and ModTime come from the scan. Metadata requires decoding the image,
+// so it is only filled in once it has been extracted. Tags are the ones the
+// user gave the image.
 type Wallpaper struct {
-	Name string
-	Path string
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Root string `json:"root,omitempty"`
+	Dir  string `json:"dir,omitempty"`
+
+	Format      string `json:"format,omitempty"`
+	Unsupported string `json:"unsupported,omitempty"`
+
+	Size     int64     `json:"size,omitempty"`
+	ModTime  time.Time `json:"mod_time,omitzero"`
+	Metadata *Metadata `json:"metadata,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+// Orientation is the shape of an image as displayed, after applying any
+// EXIF rotation.
+type Orientation string
+
+const (
+	Landscape Orientation = "landscape"
+	Portrait  Orientation = "portrait"
+	Square    Orientation = "square"
+)
+
+// Metadata describes the content of a wallpaper image.
+type Metadata struct {
+	Width       int         `json:"width"`
+	Height      int         `json:"height"`
+	AspectRatio float64     `json:"aspect_ratio"`
+	Orientation Orientation `json:"orientation"`
+	SHA256      string      `json:"sha256"`
+	// Colors are the dominant colours as "#rrggbb", most common first.
+	Colors []string `json:"colors"`
+	// Keywords are the XMP and IPTC keywords embedded in the file.
+	Keywords []string `json:"keywords,omitempty"`
 }
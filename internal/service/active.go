@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// allOutputsKey marks the entry applied to every output in the state file.
+const allOutputsKey = "*"
+
+// StateVersion is the version of the state file format written by
+// SaveActiveWallpapers. Files with a newer version are rejected rather than
+// misread.
+const StateVersion = 1
+
+// State is the JSON document stored at StatePath. Outputs is keyed by output
+// name, with "*" for the wallpaper applied to every output.
+type State struct {
+	Version int                        `json:"version"`
+	Outputs map[string]ActiveWallpaper `json:"outputs"`
+}
+
+// ActiveWallpaper is a persisted wallpaper together with the settings it was
+// applied with, so restoring it looks the same. Span marks an image sliced
+// across every output.
+type ActiveWallpaper struct {
+	Path       string         `json:"path"`
+	Span       bool           `json:"span,omitempty"`
+	Backend    string         `json:"backend,omitempty"`
+	Mode       string         `json:"mode,omitempty"`
+	Transition TransitionType `json:"transition,omitempty"`
+	SetAt      time.Time      `json:"set_at,omitzero"`
+	SHA256     string         `json:"sha256,omitempty"`
+}
+
+// StatePath returns $XDG_STATE_HOME/wallpaper-manager/state.json, where
+// XDG_STATE_HOME defaults to ~/.local/state.
+func StatePath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return filepath.Join(stateHome, "wallpaper-manager", "state.json")
+}
+
+// legacyStatePath is the plain-text file used by earlier versions.
+func legacyStatePath() string {
+	return filepath.Join(os.Getenv("HOME"), ".cache", ".active_wallpaper")
+}
+
+// LoadActiveWallpapers reads the persisted wallpapers keyed by output, with
+// "" meaning every output. If the state file does not exist yet, the legacy
+// ~/.cache/.active_wallpaper file is read instead.
+func LoadActiveWallpapers() (map[string]ActiveWallpaper, error) {
+	data, err := os.ReadFile(StatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return loadLegacyActiveWallpapers()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", StatePath(), err)
+	}
+	if state.Version > StateVersion {
+		return nil, fmt.Errorf("%s: unsupported state version %d", StatePath(), state.Version)
+	}
+
+	active := make(map[string]ActiveWallpaper, len(state.Outputs))
+	for output, wp := range state.Outputs {
+		if output == allOutputsKey {
+			output = ""
+		}
+		active[output] = wp
+	}
+	return active, nil
+}
+
+// loadLegacyActiveWallpapers reads the plain-text format, whose lines are
+// "<output>\t<path>[\t<transition>\t<mode>]" or, from the oldest versions, a
+// bare path applied to every output.
+func loadLegacyActiveWallpapers() (map[string]ActiveWallpaper, error) {
+	data, err := os.ReadFile(legacyStatePath())
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[string]ActiveWallpaper)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 1 {
+			fields = []string{allOutputsKey, line}
+		}
+
+		output := fields[0]
+		if output == allOutputsKey {
+			output = ""
+		}
+		wp := ActiveWallpaper{Path: fields[1]}
+		if len(fields) > 2 {
+			wp.Transition = TransitionType(fields[2])
+		}
+		if len(fields) > 3 {
+			wp.Mode = fields[3]
+		}
+		active[output] = wp
+	}
+	return active, scanner.Err()
+}
+
+// SaveActiveWallpapers atomically replaces the state file with active. Once
+// it is written, the legacy file is removed so it cannot shadow a later
+// state.
+func SaveActiveWallpapers(active map[string]ActiveWallpaper) error {
+	state := State{Version: StateVersion, Outputs: make(map[string]ActiveWallpaper, len(active))}
+	for output, wp := range active {
+		if output == "" {
+			output = allOutputsKey
+		}
+		state.Outputs[output] = wp
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(StatePath(), append(data, '\n')); err != nil {
+		return err
+	}
+
+	if err := os.Remove(legacyStatePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// updateActiveWallpapers reads the state, passes it to change and saves
+// what change returns, unless that is nil, holding a lock so that other
+// processes changing the state wait. It returns the state change was given,
+// which is nil if it could not be read.
+func updateActiveWallpapers(change func(previous map[string]ActiveWallpaper) map[string]ActiveWallpaper) (map[string]ActiveWallpaper, error) {
+	var previous map[string]ActiveWallpaper
+	err := withLock(StatePath()+".lock", func() error {
+		previous, _ = LoadActiveWallpapers()
+		active := change(previous)
+		if active == nil {
+			return nil
+		}
+		return SaveActiveWallpapers(active)
+	})
+	return previous, err
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partial file. A file being replaced
+// keeps its permissions.
+func WriteFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if info, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fileSHA256 returns the hex encoded SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ActivePaths returns just the path of every entry in active.
+func ActivePaths(active map[string]ActiveWallpaper) map[string]string {
+	paths := make(map[string]string, len(active))
+	for output, wp := range active {
+		paths[output] = wp.Path
+	}
+	return paths
+}
+
+// sortedOutputs returns the keys of active with the every-output key "" first.
+func sortedOutputs(active map[string]ActiveWallpaper) []string {
+	outputs := make([]string, 0, len(active))
+	for output := range active {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+	return outputs
+}
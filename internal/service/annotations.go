@@ -0,0 +1,286 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// MaxStars is the highest rating.
+const MaxStars = 5
+
+// unratedStars is how many stars an unrated wallpaper counts as when picking
+// one at random, so rating a wallpaper low makes it rarer than not rating it.
+const unratedStars = 3
+
+// Annotation is what the user gave one image: a favorite mark, stars and
+// tags.
+type Annotation struct {
+	Favorite bool `json:"favorite,omitempty"`
+	// Stars is from 1 to MaxStars, or 0 when unrated.
+	Stars int `json:"stars,omitempty"`
+	// Tags are the tags given to the image, normalized with NormalizeTags.
+	Tags []string `json:"tags,omitempty"`
+	// Path and Size are where the image was last seen, to find it without
+	// hashing the library and to find it again after it moved.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+func (a Annotation) empty() bool {
+	return !a.Favorite && a.Stars == 0 && len(a.Tags) == 0
+}
+
+// weight is how likely the wallpaper is to be picked at random: its stars,
+// doubled for favorites.
+func (a Annotation) weight() float64 {
+	stars := a.Stars
+	if stars == 0 {
+		stars = unratedStars
+	}
+	if a.Favorite {
+		return float64(2 * stars)
+	}
+	return float64(stars)
+}
+
+// Annotations is the JSON document stored at AnnotationsPath, holding the
+// favorites, ratings and tags of images. They are keyed by the SHA-256 of the image rather than its
+// path, so they are kept when the file is moved or renamed, even while the
+// app is not running, and scans never remove them. Nothing is written to the
+// images themselves.
+type Annotations struct {
+	Version    int                    `json:"version"`
+	Wallpapers map[string]*Annotation `json:"wallpapers"`
+
+	mutex  sync.Mutex
+	byPath map[string]string
+}
+
+// AnnotationsPath returns annotations.json next to the state file.
+func AnnotationsPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "annotations.json")
+}
+
+// LoadAnnotations reads the annotations, returning empty ones if none were
+// saved.
+func LoadAnnotations() (*Annotations, error) {
+	annotations := &Annotations{Version: StateVersion, Wallpapers: make(map[string]*Annotation)}
+
+	data, err := os.ReadFile(AnnotationsPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, annotations); err != nil {
+			return nil, fmt.Errorf("%s: %w", AnnotationsPath(), err)
+		}
+		if annotations.Version > StateVersion {
+			return nil, fmt.Errorf("%s: unsupported annotations version %d", AnnotationsPath(), annotations.Version)
+		}
+		if annotations.Wallpapers == nil {
+			annotations.Wallpapers = make(map[string]*Annotation)
+		}
+	}
+
+	annotations.byPath = make(map[string]string, len(annotations.Wallpapers))
+	for hash, annotation := range annotations.Wallpapers {
+		annotations.byPath[annotation.Path] = hash
+	}
+	return annotations, nil
+}
+
+// Annotations returns the annotations, reading them on first use and sharing
+// them between callers afterwards.
+func (s *WallpaperService) Annotations() (*Annotations, error) {
+	s.annotationsOnce.Do(func() {
+		s.annotations, s.annotationsErr = LoadAnnotations()
+	})
+	return s.annotations, s.annotationsErr
+}
+
+// change reads the annotations file again, so changes made by other
+// processes are kept, and saves it if fn, called with a.mutex held, reports
+// that it changed a. The file stays locked meanwhile, so that other processes
+// changing annotations wait.
+func (a *Annotations) change(fn func() bool) error {
+	return withLock(AnnotationsPath()+".lock", func() error {
+		current, err := LoadAnnotations()
+		if err != nil {
+			return err
+		}
+
+		a.mutex.Lock()
+		a.Wallpapers, a.byPath = current.Wallpapers, current.byPath
+		if !fn() {
+			a.mutex.Unlock()
+			return nil
+		}
+		a.Version = StateVersion
+		data, err := json.MarshalIndent(a, "", "  ")
+		a.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		return WriteFileAtomic(AnnotationsPath(), append(data, '\n'))
+	})
+}
+
+// Get returns the rating of the image at path, which is empty if it has none.
+func (a *Annotations) Get(path string) Annotation {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if annotation, ok := a.Wallpapers[a.byPath[path]]; ok {
+		return *annotation
+	}
+	return Annotation{}
+}
+
+// Update changes the annotation of wp with update and saves the annotations.
+// The image is hashed unless it is already annotated or its metadata has the
+// hash.
+func (a *Annotations) Update(wp model.Wallpaper, update func(annotation *Annotation)) error {
+	hash, err := a.hash(wp)
+	if err != nil {
+		return err
+	}
+	return a.change(func() bool {
+		a.updateLocked(hash, wp, update)
+		return true
+	})
+}
+
+// hash returns the key of wp: the one it is rated under, or else the hash
+// from its metadata or of the file.
+func (a *Annotations) hash(wp model.Wallpaper) (string, error) {
+	a.mutex.Lock()
+	hash, ok := a.byPath[wp.Path]
+	a.mutex.Unlock()
+
+	if ok {
+		return hash, nil
+	}
+	if wp.Metadata != nil && wp.Metadata.SHA256 != "" {
+		return wp.Metadata.SHA256, nil
+	}
+	return fileSHA256(wp.Path)
+}
+
+func (a *Annotations) updateLocked(hash string, wp model.Wallpaper, update func(annotation *Annotation)) {
+	annotation := Annotation{}
+	if current, ok := a.Wallpapers[hash]; ok {
+		annotation = *current
+		delete(a.byPath, current.Path)
+	}
+	update(&annotation)
+	annotation.Stars = max(0, min(annotation.Stars, MaxStars))
+	annotation.Path, annotation.Size = wp.Path, wp.Size
+
+	if annotation.empty() {
+		delete(a.Wallpapers, hash)
+	} else {
+		a.Wallpapers[hash] = &annotation
+		a.byPath[wp.Path] = hash
+	}
+}
+
+// FillTags sets the tags of every wallpaper to the ones stored for it.
+func (a *Annotations) FillTags(wallpapers []model.Wallpaper) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for i, wp := range wallpapers {
+		wallpapers[i].Tags = nil
+		if annotation, ok := a.Wallpapers[a.byPath[wp.Path]]; ok {
+			wallpapers[i].Tags = annotation.Tags
+		}
+	}
+}
+
+// Relink finds the annotated images that are no longer at their recorded
+// path among wallpapers, comparing the hash of files of the same size, and
+// saves their new paths.
+func (a *Annotations) Relink(wallpapers []model.Wallpaper) error {
+	a.mutex.Lock()
+	present := make(map[string]bool, len(wallpapers))
+	for _, wp := range wallpapers {
+		present[wp.Path] = true
+	}
+	missing := make(map[int64][]string)
+	for hash, annotation := range a.Wallpapers {
+		if !present[annotation.Path] {
+			missing[annotation.Size] = append(missing[annotation.Size], hash)
+		}
+	}
+	a.mutex.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	moved := make(map[string]string)
+	for _, wp := range wallpapers {
+		hashes, ok := missing[wp.Size]
+		if !ok || a.annotated(wp.Path) {
+			continue
+		}
+
+		hash := ""
+		if wp.Metadata != nil {
+			hash = wp.Metadata.SHA256
+		}
+		if hash == "" {
+			var err error
+			if hash, err = fileSHA256(wp.Path); err != nil {
+				continue
+			}
+		}
+		if slices.Contains(hashes, hash) {
+			moved[hash] = wp.Path
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+
+	return a.change(func() bool {
+		for hash, path := range moved {
+			a.moveLocked(hash, path)
+		}
+		return true
+	})
+}
+
+func (a *Annotations) annotated(path string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	_, ok := a.byPath[path]
+	return ok
+}
+
+// rename records and saves that the image at oldPath is now at newPath.
+func (a *Annotations) rename(oldPath, newPath string) error {
+	return a.change(func() bool {
+		hash, ok := a.byPath[oldPath]
+		if ok {
+			a.moveLocked(hash, newPath)
+		}
+		return ok
+	})
+}
+
+func (a *Annotations) moveLocked(hash, path string) {
+	annotation, ok := a.Wallpapers[hash]
+	if !ok {
+		return
+	}
+	delete(a.byPath, annotation.Path)
+	annotation.Path = path
+	a.byPath[path] = hash
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+func writeImageFile(t *testing.T, dir, name, content string) model.Wallpaper {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return model.Wallpaper{Name: name, Path: path, Size: int64(len(content))}
+}
+
+// TestAnnotationsConcurrentUpdate rates images from separately loaded
+// annotations, standing for separate processes, at the same time.
+func TestAnnotationsConcurrentUpdate(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	const n = 8
+	var wallpapers []model.Wallpaper
+	for i := range n {
+		wallpapers = append(wallpapers, writeImageFile(t, dir, fmt.Sprintf("%d.png", i), fmt.Sprintf("image %d", i)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i, wp := range wallpapers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			annotations, err := LoadAnnotations()
+			if err == nil {
+				err = annotations.Update(wp, func(annotation *Annotation) { annotation.Stars = i%MaxStars + 1 })
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	annotations, err := LoadAnnotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, wp := range wallpapers {
+		if got := annotations.Get(wp.Path).Stars; got != i%MaxStars+1 {
+			t.Errorf("%s has %d stars, want %d", wp.Name, got, i%MaxStars+1)
+		}
+	}
+}
+
+func TestAnnotationsRelink(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	wp := writeImageFile(t, dir, "a.png", "image a")
+	other := writeImageFile(t, dir, "b.png", "image b")
+
+	annotations, err := LoadAnnotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := annotations.Update(wp, func(annotation *Annotation) { annotation.Favorite = true }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process rates a second image while this one runs.
+	elsewhere, err := LoadAnnotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := elsewhere.Update(other, func(annotation *Annotation) { annotation.Stars = 2 }); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first image is moved while the app is closed.
+	moved := wp
+	moved.Path = filepath.Join(dir, "moved.png")
+	if err := os.Rename(wp.Path, moved.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := annotations.Relink([]model.Wallpaper{moved, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadAnnotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Get(moved.Path).Favorite || saved.Get(wp.Path).Favorite {
+		t.Errorf("the favorite was not moved to %s", moved.Path)
+	}
+	if saved.Get(other.Path).Stars != 2 {
+		t.Errorf("the annotation saved by the other process was lost")
+	}
+}
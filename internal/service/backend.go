@@ -0,0 +1,181 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// BackendEnv names the environment variable that forces a specific backend,
+// bypassing auto-detection.
+const BackendEnv = "WALLPAPER_MANAGER_BACKEND"
+
+var ErrNoBackend = errors.New("no supported wallpaper backend found")
+
+// Capabilities describes the optional features a backend supports.
+type Capabilities struct {
+	Transitions bool
+	MultiOutput bool
+}
+
+// Backend is the program or protocol used to actually put an image on screen.
+// An empty output means every output.
+type Backend interface {
+	Name() string
+	Available() bool
+	Capabilities() Capabilities
+	Outputs() ([]Output, error)
+	Apply(output, path string) error
+	Current() (map[string]string, error)
+}
+
+const (
+	sessionAny     = ""
+	sessionWayland = "wayland"
+	sessionX11     = "x11"
+)
+
+// TransitionApplier is implemented by backends whose Capabilities report
+// Transitions.
+type TransitionApplier interface {
+	ApplyTransition(output, path string, transition TransitionOptions) error
+}
+
+// ReadyChecker is implemented by backends that talk to a daemon, which may
+// still be starting when the session comes up. Ready returns nil once the
+// daemon accepts requests; backends without it are ready when Available.
+type ReadyChecker interface {
+	Ready() error
+}
+
+// Fitter is implemented by backends whose scaling mode, such as "fill" or
+// "fit", can be changed, so it can be recorded and restored with the
+// wallpaper.
+type Fitter interface {
+	FitMode() string
+	SetFitMode(mode string)
+}
+
+type backendFactory struct {
+	name    string
+	session string
+	desktop string
+	new     func() Backend
+}
+
+// backendFactories is ordered by detection priority. Auto-detection only
+// considers backends matching the current session type and, for desktop
+// environment backends, the current desktop.
+var backendFactories = []backendFactory{
+	{name: "gnome", desktop: "GNOME", new: func() Backend { return NewGnomeBackend() }},
+	{name: "kde", desktop: "KDE", new: func() Backend { return NewKDEBackend() }},
+	{name: "hyprpaper", session: sessionWayland, new: func() Backend { return NewHyprpaperBackend() }},
+	{name: "swww", session: sessionWayland, new: func() Backend { return NewSwwwBackend() }},
+	{name: "swaybg", session: sessionWayland, new: func() Backend { return NewCommandPresetBackend("swaybg") }},
+	{name: "wbg", session: sessionWayland, new: func() Backend { return NewCommandPresetBackend("wbg") }},
+	{name: "mpvpaper", session: sessionWayland, new: func() Backend { return NewCommandPresetBackend("mpvpaper") }},
+	{name: "xwallpaper", session: sessionX11, new: func() Backend { return NewCommandPresetBackend("xwallpaper") }},
+	{name: "feh", session: sessionX11, new: func() Backend { return NewCommandPresetBackend("feh") }},
+	{name: "x11", session: sessionX11, new: func() Backend { return NewX11Backend() }},
+	{name: "command", session: sessionAny, new: func() Backend { return NewUserCommandBackend() }},
+}
+
+// currentSession reports the display server type. WAYLAND_DISPLAY wins
+// because XWayland also sets DISPLAY.
+func currentSession() string {
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return sessionWayland
+	case os.Getenv("DISPLAY") != "":
+		return sessionX11
+	}
+	return sessionAny
+}
+
+// currentDesktops returns the entries of the colon-separated
+// XDG_CURRENT_DESKTOP, e.g. "ubuntu:GNOME".
+func currentDesktops() []string {
+	return strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":")
+}
+
+// BackendNames returns the names of all known backends in detection order.
+func BackendNames() []string {
+	names := make([]string, 0, len(backendFactories))
+	for _, f := range backendFactories {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// NewBackend returns the backend registered under name. The names "" and
+// "auto" select the first available backend.
+func NewBackend(name string) (Backend, error) {
+	if name == "" || name == "auto" {
+		return DetectBackend()
+	}
+
+	for _, f := range backendFactories {
+		if f.name == name {
+			return f.new(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown backend %q (known: %s)", name, strings.Join(BackendNames(), ", "))
+}
+
+// DetectBackend honours BackendEnv and otherwise returns the first backend
+// for the current session whose tooling is available on this machine.
+func DetectBackend() (Backend, error) {
+	if name := os.Getenv(BackendEnv); name != "" && name != "auto" {
+		return NewBackend(name)
+	}
+
+	session := currentSession()
+	desktops := currentDesktops()
+	for _, f := range backendFactories {
+		if f.session != sessionAny && session != sessionAny && f.session != session {
+			continue
+		}
+		if f.desktop != "" && !slices.Contains(desktops, f.desktop) {
+			continue
+		}
+		if b := f.new(); b.Available() {
+			return b, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
+
+func errPerOutputUnsupported(b Backend) error {
+	return fmt.Errorf("%s: per-output wallpapers are not supported", b.Name())
+}
+
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// runCommand runs name with args and folds stderr into the returned error so
+// failures from external setters are actionable.
+func runCommand(name string, args ...string) error {
+	_, err := commandOutput(name, args...)
+	return err
+}
+
+func commandOutput(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return out, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return out, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakePath replaces $PATH with a directory holding one shell script per
+// entry of scripts, so backends run them instead of the real tools. Every
+// call is logged as "name args..." to the returned file before the script
+// body runs; only shell builtins are available to the bodies.
+func fakePath(t *testing.T, scripts map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls.log")
+	for name, body := range scripts {
+		script := fmt.Sprintf("#!/bin/sh\necho \"%s $*\" >> '%s'\n%s\n", name, log, body)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	return log
+}
+
+// fakeCalls returns the calls logged by the scripts of fakePath.
+func fakeCalls(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// setSession clears the variables backend detection looks at and sets the
+// ones in env.
+func setSession(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, name := range []string{"WAYLAND_DISPLAY", "DISPLAY", "XDG_CURRENT_DESKTOP", "HYPRLAND_INSTANCE_SIGNATURE", BackendEnv, CommandEnv} {
+		t.Setenv(name, env[name])
+	}
+}
+
+func TestDetectBackend(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		tools []string
+		want  string
+	}{
+		{"swww on wayland", map[string]string{"WAYLAND_DISPLAY": "wayland-1"}, []string{"swww", "swaybg"}, "swww"},
+		{"swaybg without swww", map[string]string{"WAYLAND_DISPLAY": "wayland-1"}, []string{"swaybg", "feh"}, "swaybg"},
+		{"wayland wins over xwayland", map[string]string{"WAYLAND_DISPLAY": "wayland-1", "DISPLAY": ":0"}, []string{"feh", "wbg"}, "wbg"},
+		{"xwallpaper on x11", map[string]string{"DISPLAY": ":0"}, []string{"swww", "feh", "xwallpaper"}, "xwallpaper"},
+		{"native x11", map[string]string{"DISPLAY": ":0"}, []string{"swww"}, "x11"},
+		{"gnome", map[string]string{"WAYLAND_DISPLAY": "wayland-1", "XDG_CURRENT_DESKTOP": "ubuntu:GNOME"}, []string{"gsettings", "swww"}, "gnome"},
+		{"gsettings outside gnome", map[string]string{"WAYLAND_DISPLAY": "wayland-1"}, []string{"gsettings", "swww"}, "swww"},
+		{"forced by environment", map[string]string{"WAYLAND_DISPLAY": "wayland-1", BackendEnv: "feh"}, []string{"swww"}, "feh"},
+		{"user command", map[string]string{CommandEnv: "setter {path}"}, []string{"setter"}, "command"},
+		{"nothing installed", map[string]string{"WAYLAND_DISPLAY": "wayland-1"}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSession(t, tt.env)
+			scripts := make(map[string]string)
+			for _, tool := range tt.tools {
+				scripts[tool] = ""
+			}
+			fakePath(t, scripts)
+
+			backend, err := DetectBackend()
+			if tt.want == "" {
+				if !errors.Is(err, ErrNoBackend) {
+					t.Fatalf("DetectBackend() = %v, %v, want ErrNoBackend", backend, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DetectBackend(): %v", err)
+			}
+			if backend.Name() != tt.want {
+				t.Errorf("DetectBackend() = %s, want %s", backend.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBackendUnknown(t *testing.T) {
+	if _, err := NewBackend("nitrogen"); err == nil {
+		t.Error("NewBackend(nitrogen) succeeded, want an error")
+	}
+}
+
+func TestSwwwBackend(t *testing.T) {
+	setSession(t, nil)
+	log := fakePath(t, map[string]string{"swww": `
+if [ "$1" = query ]; then
+	echo ': DP-1: 2560x1440, scale: 1.5, currently displaying: image: /walls/a b.png'
+	echo 'HDMI-A-1: 1920x1080, scale: 1, currently displaying: color: 000000'
+fi`})
+	b := NewSwwwBackend()
+
+	if !b.Available() {
+		t.Fatal("Available() = false with swww on $PATH")
+	}
+	transition := TransitionOptions{Type: TransitionWipe, Angle: 30, Duration: 1.5}
+	if err := b.ApplyTransition("DP-1", "/walls/a b.png", transition); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Apply("", "/walls/c.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := b.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"DP-1": "/walls/a b.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+
+	outputs, err := b.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Output{
+		{Name: "DP-1", Width: 2560, Height: 1440, Scale: 1.5},
+		{Name: "HDMI-A-1", Width: 1920, Height: 1080, Scale: 1},
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("Outputs() = %+v, want %+v", outputs, want)
+	}
+
+	wantCalls := []string{
+		"swww clear-cache",
+		"swww img /walls/a b.png --transition-type wipe --transition-duration 1.5 --transition-angle 30 --outputs DP-1",
+		"swww clear-cache",
+		"swww img /walls/c.png --transition-type outer",
+		"swww query",
+		"swww query",
+	}
+	if calls := fakeCalls(t, log); !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(wantCalls, "\n"))
+	}
+}
+
+func TestSwwwBackendFailure(t *testing.T) {
+	setSession(t, nil)
+	fakePath(t, map[string]string{"swww": `echo 'daemon not running' >&2; exit 1`})
+
+	err := NewSwwwBackend().Apply("", "/walls/a.png")
+	if err == nil || !strings.Contains(err.Error(), "daemon not running") {
+		t.Errorf("Apply() error = %v, want it to include the stderr of swww", err)
+	}
+}
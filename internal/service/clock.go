@@ -0,0 +1,23 @@
+package service
+
+import "time"
+
+// Clock tells the time and waits, so what runs on a timer, such as a
+// Rotation, can be driven by another clock than the system's.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the clock of the system.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,477 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CommandEnv names the environment variable holding the template used by the
+// "command" backend.
+const CommandEnv = "WALLPAPER_MANAGER_COMMAND"
+
+const (
+	defaultCommandMode    = "fill"
+	defaultStartupTimeout = 3 * time.Second
+	defaultShutdownPeriod = 2 * time.Second
+	// commandPollInterval is how often a starting or stopping setter is
+	// looked at, and commandSettleTime how long it must wait for events
+	// without using the CPU to count as up.
+	commandPollInterval = 20 * time.Millisecond
+	commandSettleTime   = 100 * time.Millisecond
+)
+
+type commandPreset struct {
+	template   string
+	mode       string
+	allOutputs string
+	oneShot    bool
+}
+
+// commandPresets are templates for setters without IPC. Wayland setters must
+// be kept running for as long as the wallpaper is shown, while the X11 ones
+// set the root window and exit.
+var commandPresets = map[string]commandPreset{
+	"swaybg":     {template: "swaybg -o {output} -i {path} -m {mode}", mode: "fill", allOutputs: "*"},
+	"wbg":        {template: "wbg {path}"},
+	"mpvpaper":   {template: "mpvpaper -o no-audio {output} {path}", allOutputs: "*"},
+	"feh":        {template: "feh --no-fehbg --bg-{mode} {path}", mode: "fill", oneShot: true},
+	"xwallpaper": {template: "xwallpaper --output {output} --{mode} {path}", mode: "zoom", allOutputs: "all", oneShot: true},
+}
+
+// CommandBackend sets the wallpaper by running a command built from Template.
+// The placeholders {path}, {output} and {mode} are substituted per argument, so
+// paths containing spaces stay a single argument. An empty output is passed to
+// the command as AllOutputs.
+//
+// Long-running setters are supervised: the new process is started and, once
+// it is up, the previous one is terminated, avoiding a flash of empty
+// background. A process counts as up when it has settled into waiting for
+// events, which setters do once the image is shown, or after StartupTimeout.
+// Commands that exit successfully before, or any command when OneShot is
+// set, are waited for instead. The processes are recorded under
+// $XDG_RUNTIME_DIR, so the one replaced may have been started by another
+// process, such as an earlier `wallpaper-manager set`.
+type CommandBackend struct {
+	name           string
+	Template       []string
+	Mode           string
+	AllOutputs     string
+	OneShot        bool
+	StartupTimeout time.Duration
+
+	// templateErr is why the template given to NewCommandBackend could not
+	// be parsed.
+	templateErr error
+	mutex       sync.Mutex
+}
+
+// supervisedProcess is a setter started by this process.
+type supervisedProcess struct {
+	cmd    *exec.Cmd
+	done   chan struct{}
+	stderr bytes.Buffer
+	err    error
+}
+
+// commandProcess records the setter showing Path on an output, with the
+// start time of PID from /proc so a reused PID is not mistaken for it. PID is
+// 0 for setters that exited after setting the wallpaper.
+type commandProcess struct {
+	PID   int    `json:"pid,omitempty"`
+	Start uint64 `json:"start,omitempty"`
+	Path  string `json:"path"`
+}
+
+func NewCommandBackend(name, template string) *CommandBackend {
+	args, err := SplitCommand(template)
+	return &CommandBackend{
+		name:           name,
+		Template:       args,
+		Mode:           defaultCommandMode,
+		AllOutputs:     "*",
+		StartupTimeout: defaultStartupTimeout,
+		templateErr:    err,
+	}
+}
+
+// NewCommandPresetBackend returns a CommandBackend for one of the built-in
+// presets such as "swaybg" or "feh".
+func NewCommandPresetBackend(name string) *CommandBackend {
+	preset := commandPresets[name]
+	b := NewCommandBackend(name, preset.template)
+	b.AllOutputs = preset.allOutputs
+	b.OneShot = preset.oneShot
+	if preset.mode != "" {
+		b.Mode = preset.mode
+	}
+	return b
+}
+
+// NewUserCommandBackend returns a CommandBackend using the template from
+// CommandEnv.
+func NewUserCommandBackend() *CommandBackend {
+	return NewCommandBackend("command", os.Getenv(CommandEnv))
+}
+
+// SplitCommand splits a command line into arguments like a POSIX shell
+// does, without expanding anything: arguments are separated by blanks,
+// single quotes keep everything up to the next one, and double quotes keep
+// everything but backslashes escaping ", \, $ and `. Outside quotes, a
+// backslash keeps the next character.
+func SplitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("command %q: unterminated single quote", command)
+			}
+			arg.WriteString(string(runes[i+1 : end]))
+			i, inArg = end, true
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+					i++
+				}
+				arg.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("command %q: unterminated double quote", command)
+			}
+			inArg = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("command %q: trailing backslash", command)
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+func (b *CommandBackend) Name() string {
+	return b.name
+}
+
+func (b *CommandBackend) Available() bool {
+	return len(b.Template) > 0 && commandExists(b.Template[0])
+}
+
+func (b *CommandBackend) FitMode() string {
+	return b.Mode
+}
+
+func (b *CommandBackend) SetFitMode(mode string) {
+	b.Mode = mode
+}
+
+func (b *CommandBackend) Capabilities() Capabilities {
+	multiOutput := false
+	for _, arg := range b.Template {
+		if strings.Contains(arg, "{output}") {
+			multiOutput = true
+		}
+	}
+	return Capabilities{Transitions: false, MultiOutput: multiOutput}
+}
+
+func (b *CommandBackend) Outputs() ([]Output, error) {
+	return DetectOutputs()
+}
+
+// Apply shows path on output, replacing the setter that showed something
+// else there. Applying to a single output also replaces a setter running for
+// every output, which would keep drawing underneath; when the outputs can be
+// listed, the other outputs get setters of their own showing its image, so
+// they keep their wallpaper.
+func (b *CommandBackend) Apply(output, path string) error {
+	if b.templateErr != nil {
+		return fmt.Errorf("%s: %w", b.name, b.templateErr)
+	}
+	if len(b.Template) == 0 {
+		return fmt.Errorf("%s: empty command template", b.name)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	record, err := b.launch(output, path)
+	if err != nil {
+		return err
+	}
+
+	return withLock(b.processesPath()+".lock", func() error {
+		processes := b.loadProcesses()
+		if all, ok := processes[""]; ok && output != "" && all.running() {
+			b.splitAllOutputs(processes, all.Path, output)
+		}
+		for o, old := range processes {
+			if output == "" || o == output || o == "" {
+				if old.PID != record.PID {
+					old.terminate()
+				}
+				delete(processes, o)
+			}
+		}
+		processes[output] = record
+		return b.saveProcesses(processes)
+	})
+}
+
+// launch starts the setter showing path on output and waits until it is up,
+// returning its record.
+func (b *CommandBackend) launch(output, path string) (commandProcess, error) {
+	proc, err := b.start(b.expand(output, path))
+	if err != nil {
+		return commandProcess{}, err
+	}
+	running, err := b.waitUntilUp(proc)
+	if err != nil {
+		return commandProcess{}, err
+	}
+
+	record := commandProcess{Path: path}
+	if running {
+		record.PID = proc.cmd.Process.Pid
+		if stat, err := readProcStat(record.PID); err == nil {
+			record.Start = stat.start
+		}
+	}
+	return record, nil
+}
+
+// splitAllOutputs starts a setter showing path, the image of the setter for
+// every output, on each output other than except that has none of its own,
+// and records them in processes. Outputs whose setter fails to start are
+// left blank rather than failing the apply that replaced the setter.
+func (b *CommandBackend) splitAllOutputs(processes map[string]commandProcess, path, except string) {
+	outputs, err := b.Outputs()
+	if err != nil {
+		return
+	}
+	for _, o := range outputs {
+		if _, ok := processes[o.Name]; ok || o.Name == except {
+			continue
+		}
+		if record, err := b.launch(o.Name, path); err == nil {
+			processes[o.Name] = record
+		}
+	}
+}
+
+// Current returns what the recorded setters show, leaving out those that
+// are no longer running.
+func (b *CommandBackend) Current() (map[string]string, error) {
+	current := make(map[string]string)
+	for output, p := range b.loadProcesses() {
+		if p.PID == 0 || p.running() {
+			current[output] = p.Path
+		}
+	}
+	return current, nil
+}
+
+func (b *CommandBackend) expand(output, path string) []string {
+	if output == "" {
+		output = b.AllOutputs
+	}
+	replacer := strings.NewReplacer("{path}", path, "{output}", output, "{mode}", b.Mode)
+
+	args := make([]string, len(b.Template))
+	for i, arg := range b.Template {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// start launches args in its own process group so the setter outlives a
+// terminal interrupt sent to the manager.
+func (b *CommandBackend) start(args []string) (*supervisedProcess, error) {
+	proc := &supervisedProcess{done: make(chan struct{})}
+	proc.cmd = exec.Command(args[0], args[1:]...)
+	proc.cmd.Stderr = &proc.stderr
+	proc.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := proc.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	go func() {
+		proc.err = proc.cmd.Wait()
+		close(proc.done)
+	}()
+	return proc, nil
+}
+
+// waitUntilUp waits for proc to exit or, unless the backend is OneShot, to
+// be up, and reports whether it keeps running. A process is up once it has
+// been blocked without using the CPU for commandSettleTime, waiting for
+// events after showing the image, or after StartupTimeout at the latest for
+// setters that never settle, such as video players.
+func (b *CommandBackend) waitUntilUp(proc *supervisedProcess) (bool, error) {
+	var timeout <-chan time.Time
+	var poll <-chan time.Time
+	if !b.OneShot {
+		timeout = time.After(b.StartupTimeout)
+		ticker := time.NewTicker(commandPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	var settledSince time.Time
+	var lastCPU uint64
+	for {
+		select {
+		case <-proc.done:
+			if proc.err != nil {
+				if msg := strings.TrimSpace(proc.stderr.String()); msg != "" {
+					return false, fmt.Errorf("%s: %w: %s", b.Template[0], proc.err, msg)
+				}
+				return false, fmt.Errorf("%s: %w", b.Template[0], proc.err)
+			}
+			return false, nil
+		case <-timeout:
+			return true, nil
+		case now := <-poll:
+			stat, err := readProcStat(proc.cmd.Process.Pid)
+			switch {
+			case err != nil || stat.state != 'S' || stat.cpu != lastCPU:
+				settledSince = time.Time{}
+			case settledSince.IsZero():
+				settledSince = now
+			case now.Sub(settledSince) >= commandSettleTime:
+				return true, nil
+			}
+			lastCPU = stat.cpu
+		}
+	}
+}
+
+// commandRuntimeDir is where the setters are recorded:
+// $XDG_RUNTIME_DIR/wallpaper-manager, which is cleared on logout like the
+// processes themselves.
+func commandRuntimeDir() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join(os.TempDir(), fmt.Sprintf("wallpaper-manager-%d", os.Getuid()))
+	}
+	return filepath.Join(runtimeDir, "wallpaper-manager")
+}
+
+func (b *CommandBackend) processesPath() string {
+	return filepath.Join(commandRuntimeDir(), b.name+".json")
+}
+
+// loadProcesses reads the recorded setters by output. A missing or
+// unreadable file means none are known.
+func (b *CommandBackend) loadProcesses() map[string]commandProcess {
+	processes := make(map[string]commandProcess)
+	if data, err := os.ReadFile(b.processesPath()); err == nil {
+		_ = json.Unmarshal(data, &processes)
+	}
+	return processes
+}
+
+func (b *CommandBackend) saveProcesses(processes map[string]commandProcess) error {
+	data, err := json.Marshal(processes)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(b.processesPath(), data)
+}
+
+// running reports whether the recorded process is still alive.
+func (p commandProcess) running() bool {
+	if p.PID == 0 {
+		return false
+	}
+	stat, err := readProcStat(p.PID)
+	return err == nil && stat.start == p.Start && stat.state != 'Z'
+}
+
+// terminate asks the process group of the recorded process to exit and
+// kills it if it has not done so within defaultShutdownPeriod.
+func (p commandProcess) terminate() {
+	if !p.running() {
+		return
+	}
+
+	_ = syscall.Kill(-p.PID, syscall.SIGTERM)
+	deadline := time.Now().Add(defaultShutdownPeriod)
+	for p.running() {
+		if time.Now().After(deadline) {
+			_ = syscall.Kill(-p.PID, syscall.SIGKILL)
+			return
+		}
+		time.Sleep(commandPollInterval)
+	}
+}
+
+type procStat struct {
+	state byte
+	// cpu is the user and system time used, and start the time the process
+	// started after boot, both in clock ticks.
+	cpu   uint64
+	start uint64
+}
+
+// readProcStat reads the fields of /proc/<pid>/stat used to follow setters.
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+	// The command name in parentheses may contain spaces and parentheses,
+	// so the fields are counted from the last closing one, starting with
+	// the state, the third field.
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return procStat{}, errors.New("malformed /proc stat")
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return procStat{}, errors.New("malformed /proc stat")
+	}
+
+	stat := procStat{state: fields[0][0]}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	start, err3 := strconv.ParseUint(fields[19], 10, 64)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return procStat{}, err
+	}
+	stat.cpu, stat.start = utime+stime, start
+	return stat, nil
+}
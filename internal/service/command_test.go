@@ -0,0 +1,182 @@
+package service
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"swaybg -o {output} -i {path}", []string{"swaybg", "-o", "{output}", "-i", "{path}"}},
+		{"  setter\t--image '{path}'  ", []string{"setter", "--image", "{path}"}},
+		{`setter --title "my \"wall\" \$HOME" 'it'\''s'`, []string{"setter", "--title", `my "wall" $HOME`, "it's"}},
+		{`setter /path/with\ space "" x`, []string{"setter", "/path/with space", "", "x"}},
+		{`mpvpaper -o "no-audio --loop" {output} {path}`, []string{"mpvpaper", "-o", "no-audio --loop", "{output}", "{path}"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitCommand(tt.command)
+		if err != nil {
+			t.Errorf("SplitCommand(%q): %v", tt.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+
+	for _, command := range []string{`setter 'open`, `setter "open`, `setter \`} {
+		if _, err := SplitCommand(command); err == nil {
+			t.Errorf("SplitCommand(%q) succeeded, want an error", command)
+		}
+	}
+}
+
+func TestCommandBackendExpand(t *testing.T) {
+	b := NewCommandBackend("command", `setter --image '{path}' --name "my wall" --on {output}`)
+	got := b.expand("", "/walls/a b.png")
+	want := []string{"setter", "--image", "/walls/a b.png", "--name", "my wall", "--on", "*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expand() = %q, want %q", got, want)
+	}
+
+	b = NewCommandBackend("command", `setter 'open`)
+	if err := b.Apply("", "/walls/a.png"); err == nil {
+		t.Error("Apply() with an unparsable template succeeded")
+	}
+}
+
+// fakeSetter is the body of a long-running setter for fakePath, using the
+// sleep found on the real $PATH. When stopped, it logs its arguments to the
+// file named after it with ".log" appended.
+func fakeSetter(t *testing.T) string {
+	t.Helper()
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	return `trap 'echo "$*" >> "$0.log"; kill $!; exit 0' TERM
+` + sleep + ` 60 &
+wait`
+}
+
+// stopSetters terminates the setters recorded by backends named name.
+func stopSetters(t *testing.T, name string) {
+	t.Cleanup(func() {
+		for _, p := range (&CommandBackend{name: name}).loadProcesses() {
+			p.terminate()
+		}
+	})
+}
+
+func TestCommandBackendSupervision(t *testing.T) {
+	setSession(t, nil)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	log := fakePath(t, map[string]string{"swaybg": fakeSetter(t)})
+	stopSetters(t, "swaybg")
+
+	// Separate backends stand for separate processes, such as successive
+	// `wallpaper-manager set` calls.
+	if err := NewCommandPresetBackend("swaybg").Apply("", "/walls/a b.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCommandPresetBackend("swaybg").Apply("", "/walls/c.png"); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{
+		"swaybg -o * -i /walls/a b.png -m fill",
+		"swaybg -o * -i /walls/c.png -m fill",
+	}
+	if calls := fakeCalls(t, log); !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("calls = %q, want %q", calls, wantCalls)
+	}
+	wantStopped := []string{"-o * -i /walls/a b.png -m fill"}
+	if stopped := fakeCalls(t, filepath.Join(filepath.Dir(log), "swaybg.log")); !reflect.DeepEqual(stopped, wantStopped) {
+		t.Errorf("stopped = %q, want %q", stopped, wantStopped)
+	}
+
+	// The outputs cannot be listed outside a session, so the setter for
+	// every output is simply replaced.
+	b := NewCommandPresetBackend("swaybg")
+	if err := b.Apply("DP-1", "/walls/d.png"); err != nil {
+		t.Fatal(err)
+	}
+	current, err := NewCommandPresetBackend("swaybg").Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"DP-1": "/walls/d.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+}
+
+// TestCommandBackendOutputAfterAll sets one output while a setter runs for
+// every output, which must not keep running underneath.
+func TestCommandBackendOutputAfterAll(t *testing.T) {
+	setSession(t, map[string]string{"WAYLAND_DISPLAY": "wayland-1", "HYPRLAND_INSTANCE_SIGNATURE": "test"})
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	log := fakePath(t, map[string]string{
+		"swaybg":  fakeSetter(t),
+		"hyprctl": `echo '[{"name": "DP-1", "width": 1920, "height": 1080}, {"name": "HDMI-A-1", "width": 1920, "height": 1080}]'`,
+	})
+	stopSetters(t, "swaybg")
+
+	if err := NewCommandPresetBackend("swaybg").Apply("", "/walls/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCommandPresetBackend("swaybg").Apply("DP-1", "/walls/b.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStopped := []string{"-o * -i /walls/a.png -m fill"}
+	if stopped := fakeCalls(t, filepath.Join(filepath.Dir(log), "swaybg.log")); !reflect.DeepEqual(stopped, wantStopped) {
+		t.Errorf("stopped = %q, want %q", stopped, wantStopped)
+	}
+	current, err := NewCommandPresetBackend("swaybg").Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"DP-1": "/walls/b.png", "HDMI-A-1": "/walls/a.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+}
+
+func TestCommandBackendFailure(t *testing.T) {
+	setSession(t, nil)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	fakePath(t, map[string]string{"wbg": `echo 'cannot open image' >&2; exit 1`})
+
+	err := NewCommandPresetBackend("wbg").Apply("", "/walls/a.png")
+	if err == nil || !strings.Contains(err.Error(), "cannot open image") {
+		t.Errorf("Apply() error = %v, want it to include the stderr of wbg", err)
+	}
+	if current, _ := NewCommandPresetBackend("wbg").Current(); len(current) != 0 {
+		t.Errorf("Current() = %v after a failure, want nothing", current)
+	}
+}
+
+func TestCommandBackendOneShot(t *testing.T) {
+	setSession(t, nil)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	log := fakePath(t, map[string]string{"feh": ""})
+
+	if err := NewCommandPresetBackend("feh").Apply("", "/walls/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fakeCalls(t, log); !reflect.DeepEqual(calls, []string{"feh --no-fehbg --bg-fill /walls/a.png"}) {
+		t.Errorf("calls = %q", calls)
+	}
+	current, err := NewCommandPresetBackend("feh").Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"": "/walls/a.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+}
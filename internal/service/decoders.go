@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// externalDecoders convert AVIF and JPEG XL images, which neither the
+// standard library nor golang.org/x/image can decode, to PNG. The first
+// command found in PATH is used, looked up when an image in that format is
+// first decoded or checked; without one, files in that format are listed as
+// unsupported. "{in}" and "{out}" are replaced by the input and output paths.
+var externalDecoders = map[ImageFormat][][]string{
+	FormatAVIF: {
+		{"avifdec", "{in}", "{out}"},
+		{"magick", "{in}", "png:{out}"},
+	},
+	FormatJXL: {
+		{"djxl", "{in}", "{out}"},
+		{"magick", "{in}", "png:{out}"},
+	},
+}
+
+// externalMagic holds the image.RegisterFormat magic strings of the formats
+// decoded externally, "?" matching any byte.
+var externalMagic = map[ImageFormat][]string{
+	FormatAVIF: {"????ftypavif", "????ftypavis"},
+	FormatJXL:  {"\xff\x0a", "\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"},
+}
+
+// installedDecoders returns the command found for every format of
+// externalDecoders, searching PATH once.
+var installedDecoders = sync.OnceValue(findExternalDecoders)
+
+func findExternalDecoders() map[ImageFormat][]string {
+	installed := make(map[ImageFormat][]string)
+	for format, commands := range externalDecoders {
+		for _, command := range commands {
+			if _, err := exec.LookPath(command[0]); err == nil {
+				installed[format] = command
+				break
+			}
+		}
+	}
+	return installed
+}
+
+// The formats are registered whether or not a decoder is installed, which
+// is only known once one is needed.
+func init() {
+	for format, magics := range externalMagic {
+		decoder := externalDecoder(format)
+		for _, magic := range magics {
+			image.RegisterFormat(string(format), magic, decoder.decode, decoder.decodeConfig)
+		}
+	}
+}
+
+// externalDecoderNames lists the commands that could decode format, for
+// telling the user what to install.
+func externalDecoderNames(format ImageFormat) string {
+	var names []string
+	for _, command := range externalDecoders[format] {
+		names = append(names, command[0])
+	}
+	return strings.Join(names, " or ")
+}
+
+// externalDecoder decodes its format with the installed external decoder.
+type externalDecoder ImageFormat
+
+func (d externalDecoder) decode(r io.Reader) (image.Image, error) {
+	command := installedDecoders()[ImageFormat(d)]
+	if command == nil {
+		return nil, fmt.Errorf("%w: %s (install %s to decode it)", ErrUnsupportedFormat, string(d), externalDecoderNames(ImageFormat(d)))
+	}
+
+	dir, err := os.MkdirTemp("", "wallpaper-manager-decode-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out.png")
+	file, err := os.Create(in)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, len(command)-1)
+	for i, arg := range command[1:] {
+		arg = strings.ReplaceAll(arg, "{in}", in)
+		args[i] = strings.ReplaceAll(arg, "{out}", out)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(command[0], args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	converted, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer converted.Close()
+	return png.Decode(converted)
+}
+
+// decodeConfig has to convert the whole image, since the dimensions are only
+// known once the external decoder has run.
+func (d externalDecoder) decodeConfig(r io.Reader) (image.Config, error) {
+	img, err := d.decode(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: img.ColorModel(),
+		Width:      img.Bounds().Dx(),
+		Height:     img.Bounds().Dy(),
+	}, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ExcludeMatcher matches slash-separated paths, relative to a library root,
+// against gitignore-style patterns:
+//
+//   - "*" and "?" match within one path segment, "**" across segments
+//   - a pattern without a slash matches the name at any depth, one with a
+//     leading or inner slash is anchored to the root
+//   - a trailing slash only matches directories
+//   - a leading "!" re-includes what an earlier pattern excluded
+//   - blank lines and lines starting with "#" are ignored
+//
+// As in git, the last matching pattern wins, and nothing below an excluded
+// directory can be re-included because the directory is never entered.
+type ExcludeMatcher struct {
+	rules []excludeRule
+}
+
+type excludeRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func NewExcludeMatcher(patterns []string) (*ExcludeMatcher, error) {
+	m := &ExcludeMatcher{}
+	for _, original := range patterns {
+		p := strings.TrimSpace(original)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		var rule excludeRule
+		if rest, ok := strings.CutPrefix(p, "!"); ok {
+			rule.negate = true
+			p = rest
+		}
+		if rest, ok := strings.CutSuffix(p, "/"); ok {
+			rule.dirOnly = true
+			p = rest
+		}
+
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		if p == "" {
+			return nil, fmt.Errorf("invalid exclude pattern %q", original)
+		}
+
+		expr := globToRegexp(p)
+		if !anchored {
+			expr = "(?:.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", original, err)
+		}
+		rule.pattern = re
+		m.rules = append(m.rules, rule)
+	}
+	return m, nil
+}
+
+// Match reports whether path is excluded.
+func (m *ExcludeMatcher) Match(path string, isDir bool) bool {
+	excluded := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(path) {
+			excluded = !rule.negate
+		}
+	}
+	return excluded
+}
+
+// globToRegexp translates one gitignore glob into a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if rest, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + rest
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageFormat names an image encoding as detected from the file content. The
+// names match the ones image.Decode reports.
+type ImageFormat string
+
+const (
+	FormatJPEG ImageFormat = "jpeg"
+	FormatPNG  ImageFormat = "png"
+	FormatGIF  ImageFormat = "gif"
+	FormatWebP ImageFormat = "webp"
+	FormatBMP  ImageFormat = "bmp"
+	FormatTIFF ImageFormat = "tiff"
+	FormatAVIF ImageFormat = "avif"
+	FormatJXL  ImageFormat = "jxl"
+	FormatHEIC ImageFormat = "heic"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// headerSize is how much of a file DetectFormat needs.
+const headerSize = 32
+
+// imageExtensions are the file extensions of images. Files with one of them
+// are listed even when their content cannot be recognised, so broken or
+// unsupported images show up instead of disappearing from the library.
+var imageExtensions = []string{
+	".jpg", ".jpeg", ".jpe", ".jfif", ".png", ".gif", ".webp", ".bmp",
+	".tif", ".tiff", ".avif", ".jxl", ".heic", ".heif",
+}
+
+// DetectFormat identifies an image by the magic bytes at the start of
+// header, regardless of the file name. It returns "" for anything else.
+func DetectFormat(header []byte) ImageFormat {
+	switch {
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return FormatGIF
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP
+	case len(header) >= 14 && string(header[:2]) == "BM" && string(header[6:10]) == "\x00\x00\x00\x00":
+		// The four bytes after the file size are reserved and always zero.
+		return FormatBMP
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return FormatTIFF
+	case bytes.HasPrefix(header, []byte("\xff\x0a")),
+		bytes.HasPrefix(header, []byte("\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a")):
+		return FormatJXL
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		// ISO base media files name their major brand after "ftyp".
+		switch string(header[8:12]) {
+		case "avif", "avis":
+			return FormatAVIF
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return FormatHEIC
+		}
+	}
+	return ""
+}
+
+// DetectFileFormat reads the start of the file at path and identifies it
+// with DetectFormat.
+func DetectFileFormat(path string) (ImageFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return DetectFormat(header[:n]), nil
+}
+
+// Decodable reports whether images in format f can be decoded for previews,
+// spanning and the X11 backend. AVIF and JPEG XL are only decodable when one
+// of their external decoders is installed, see externalDecoders.
+func (f ImageFormat) Decodable() bool {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatWebP, FormatBMP, FormatTIFF:
+		return true
+	case FormatAVIF, FormatJXL:
+		return installedDecoders()[f] != nil
+	}
+	return false
+}
+
+// inspectFile reads the start of the file at path, whose info has already
+// been read, to decide whether it belongs in the library. Files that are not
+// named or recognised as images are Ignored. readable is false when the file
+// could not be read, so the result is not worth indexing.
+func inspectFile(path string, info fs.FileInfo) (entry *IndexEntry, readable bool) {
+	entry = &IndexEntry{Size: info.Size(), ModTime: info.ModTime()}
+	named := slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(path)))
+
+	format, err := DetectFileFormat(path)
+	switch {
+	case err != nil:
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			err = pathErr.Err
+		}
+		entry.Ignored = !named
+		entry.Unsupported = fmt.Sprintf("unreadable: %v", err)
+		return entry, false
+	case format == "":
+		entry.Ignored = !named
+		entry.Unsupported = "unrecognized image data"
+	case !format.Decodable():
+		entry.Unsupported = fmt.Sprintf("%v: %s", ErrUnsupportedFormat, format)
+		if tools := externalDecoderNames(format); tools != "" {
+			entry.Unsupported += fmt.Sprintf(" (install %s to decode it)", tools)
+		}
+	}
+	entry.Format = string(format)
+	return entry, true
+}
+
+// DecodeImageConfig is image.DecodeConfig for the file at path, with an
+// error naming the detected format when it cannot be decoded.
+func DecodeImageConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if errors.Is(err, image.ErrFormat) {
+		return image.Config{}, unsupportedFormatError(path)
+	}
+	return config, err
+}
+
+func unsupportedFormatError(path string) error {
+	format, err := DetectFileFormat(path)
+	if err != nil || format == "" {
+		return fmt.Errorf("%w: %s is not a recognized image", ErrUnsupportedFormat, filepath.Base(path))
+	}
+	return fmt.Errorf("%w: %s is %s", ErrUnsupportedFormat, filepath.Base(path), format)
+}
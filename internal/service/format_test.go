@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// encoded returns a 4x3 image in the format of encode.
+func encoded(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// useDecoders makes the next image decode look the external decoders up
+// again, and again after the test.
+func useDecoders(t *testing.T) {
+	installedDecoders = sync.OnceValue(findExternalDecoders)
+	t.Cleanup(func() { installedDecoders = sync.OnceValue(findExternalDecoders) })
+}
+
+// mislabeledCorpus writes files whose names do not match their content and
+// returns their contents by name.
+func mislabeledCorpus(t *testing.T) map[string][]byte {
+	t.Helper()
+	pngData := encoded(t, func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) })
+	return map[string][]byte{
+		"png.jpg":       pngData,
+		"jpeg.png":      encoded(t, func(w *bytes.Buffer, img image.Image) error { return jpeg.Encode(w, img, nil) }),
+		"gif.webp":      encoded(t, func(w *bytes.Buffer, img image.Image) error { return gif.Encode(w, img, nil) }),
+		"bmp.tiff":      encoded(t, func(w *bytes.Buffer, img image.Image) error { return bmp.Encode(w, img) }),
+		"tiff.gif":      encoded(t, func(w *bytes.Buffer, img image.Image) error { return tiff.Encode(w, img, nil) }),
+		"png-no-ext":    pngData,
+		"png.txt":       pngData,
+		"avif.png":      []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf"),
+		"jxl.jpg":       []byte("\xff\x0a\xfa\x1f\x00\x00\x00\x00"),
+		"heic.jpeg":     []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"),
+		"text.png":      []byte("not an image at all\n"),
+		"empty.jpg":     nil,
+		"notes.txt":     []byte("just text\n"),
+		"webp.bmp":      []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"),
+		"truncated.dat": []byte("\x89PNG\r\n"),
+	}
+}
+
+func TestInspectMislabeledFiles(t *testing.T) {
+	useDecoders(t)
+	t.Setenv("PATH", t.TempDir())
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		format      ImageFormat
+		ignored     bool
+		unsupported string
+		width       int
+	}{
+		{name: "png.jpg", format: FormatPNG, width: 4},
+		{name: "jpeg.png", format: FormatJPEG, width: 4},
+		{name: "gif.webp", format: FormatGIF, width: 4},
+		{name: "bmp.tiff", format: FormatBMP, width: 4},
+		{name: "tiff.gif", format: FormatTIFF, width: 4},
+		{name: "png-no-ext", format: FormatPNG, width: 4},
+		{name: "png.txt", format: FormatPNG, width: 4},
+		{name: "avif.png", format: FormatAVIF, unsupported: "unsupported format: avif (install avifdec or magick to decode it)"},
+		{name: "jxl.jpg", format: FormatJXL, unsupported: "unsupported format: jxl (install djxl or magick to decode it)"},
+		{name: "heic.jpeg", format: FormatHEIC, unsupported: "unsupported format: heic"},
+		{name: "text.png", unsupported: "unrecognized image data"},
+		{name: "empty.jpg", unsupported: "unrecognized image data"},
+		{name: "notes.txt", ignored: true, unsupported: "unrecognized image data"},
+		{name: "webp.bmp", format: FormatWebP},
+		{name: "truncated.dat", ignored: true, unsupported: "unrecognized image data"},
+	}
+	corpus := mislabeledCorpus(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, corpus[tt.name], 0o644); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry, readable := inspectFile(path, info)
+			if !readable {
+				t.Fatal("inspectFile() reports the file unreadable")
+			}
+			if ImageFormat(entry.Format) != tt.format || entry.Ignored != tt.ignored || entry.Unsupported != tt.unsupported {
+				t.Errorf("inspectFile() = format %q, ignored %v, unsupported %q; want %q, %v, %q",
+					entry.Format, entry.Ignored, entry.Unsupported, tt.format, tt.ignored, tt.unsupported)
+			}
+
+			config, err := DecodeImageConfig(path)
+			if tt.width == 0 {
+				if err == nil {
+					t.Errorf("DecodeImageConfig() = %+v, want an error", config)
+				}
+				return
+			}
+			if err != nil || config.Width != tt.width {
+				t.Errorf("DecodeImageConfig() = %+v, %v, want width %d", config, err, tt.width)
+			}
+		})
+	}
+}
+
+func TestExternalDecoder(t *testing.T) {
+	cp, err := exec.LookPath("cp")
+	if err != nil {
+		t.Skip("cp not found")
+	}
+	dir := t.TempDir()
+	converted := filepath.Join(dir, "converted.png")
+	if err := os.WriteFile(converted, encoded(t, func(w *bytes.Buffer, img image.Image) error { return png.Encode(w, img) }), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	avif := filepath.Join(dir, "avif.png")
+	if err := os.WriteFile(avif, mislabeledCorpus(t)["avif.png"], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The decoder is looked up when first needed, not when the package is
+	// loaded, so it is found even though PATH is set afterwards.
+	useDecoders(t)
+	log := fakePath(t, map[string]string{"avifdec": cp + ` '` + converted + `' "$2"`})
+	if !FormatAVIF.Decodable() {
+		t.Fatal("AVIF is not decodable with avifdec on $PATH")
+	}
+	config, err := DecodeImageConfig(avif)
+	if err != nil || config.Width != 4 || config.Height != 3 {
+		t.Errorf("DecodeImageConfig() = %+v, %v, want 4x3", config, err)
+	}
+	if calls := fakeCalls(t, log); len(calls) != 1 || !strings.HasPrefix(calls[0], "avifdec ") {
+		t.Errorf("calls = %q, want one avifdec", calls)
+	}
+	if FormatJXL.Decodable() {
+		t.Error("JPEG XL is decodable without djxl or magick")
+	}
+
+	fakePath(t, map[string]string{"avifdec": `echo 'corrupt file' >&2; exit 1`})
+	useDecoders(t)
+	if _, err := DecodeImageConfig(avif); err == nil || !strings.Contains(err.Error(), "corrupt file") {
+		t.Errorf("DecodeImageConfig() error = %v, want the stderr of avifdec", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	useDecoders(t)
+	if _, err := DecodeImageConfig(avif); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("DecodeImageConfig() without a decoder = %v, want ErrUnsupportedFormat", err)
+	}
+}
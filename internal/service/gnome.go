@@ -0,0 +1,102 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+)
+
+const gnomeBackgroundSchema = "org.gnome.desktop.background"
+
+// gnomePictureOptions maps the fit modes used by other backends to values
+// of picture-options; GNOME's own values are passed through.
+var gnomePictureOptions = map[string]string{
+	"fill":    "zoom",
+	"fit":     "scaled",
+	"center":  "centered",
+	"stretch": "stretched",
+	"tile":    "wallpaper",
+	"span":    "spanned",
+}
+
+// GnomeBackend sets the wallpaper through gsettings, updating both the light
+// and dark variants so the image survives a style switch. picture-options is
+// only changed when Mode is set, so the scaling chosen in GNOME's settings
+// is kept otherwise.
+type GnomeBackend struct {
+	Binary string
+	Mode   string
+}
+
+func NewGnomeBackend() *GnomeBackend {
+	return &GnomeBackend{Binary: "gsettings"}
+}
+
+func (b *GnomeBackend) Name() string {
+	return "gnome"
+}
+
+func (b *GnomeBackend) Available() bool {
+	return commandExists(b.Binary)
+}
+
+func (b *GnomeBackend) Capabilities() Capabilities {
+	return Capabilities{Transitions: false, MultiOutput: false}
+}
+
+func (b *GnomeBackend) Outputs() ([]Output, error) {
+	return DetectOutputs()
+}
+
+func (b *GnomeBackend) FitMode() string {
+	return b.Mode
+}
+
+func (b *GnomeBackend) SetFitMode(mode string) {
+	b.Mode = mode
+}
+
+func (b *GnomeBackend) Apply(output, path string) error {
+	if output != "" {
+		return errPerOutputUnsupported(b)
+	}
+
+	uri := fileURI(path)
+	for _, key := range []string{"picture-uri", "picture-uri-dark"} {
+		if err := runCommand(b.Binary, "set", gnomeBackgroundSchema, key, uri); err != nil {
+			return err
+		}
+	}
+	if b.Mode == "" {
+		return nil
+	}
+	option := b.Mode
+	if mapped, ok := gnomePictureOptions[option]; ok {
+		option = mapped
+	}
+	return runCommand(b.Binary, "set", gnomeBackgroundSchema, "picture-options", option)
+}
+
+func (b *GnomeBackend) Current() (map[string]string, error) {
+	out, err := commandOutput(b.Binary, "get", gnomeBackgroundSchema, "picture-uri")
+	if err != nil {
+		return nil, err
+	}
+
+	uri := strings.Trim(strings.TrimSpace(string(out)), "'")
+	if path := pathFromURI(uri); path != "" {
+		return map[string]string{"": path}, nil
+	}
+	return map[string]string{}, nil
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func pathFromURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGnomeBackendApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  string
+		calls []string
+	}{
+		{"picture-options left alone", "", nil},
+		{"mapped fit mode", "fit", []string{"gsettings set org.gnome.desktop.background picture-options scaled"}},
+		{"native value", "spanned", []string{"gsettings set org.gnome.desktop.background picture-options spanned"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := fakePath(t, map[string]string{"gsettings": ""})
+			b := NewGnomeBackend()
+			b.SetFitMode(tt.mode)
+
+			if err := b.Apply("", "/walls/a b.png"); err != nil {
+				t.Fatal(err)
+			}
+			want := append([]string{
+				"gsettings set org.gnome.desktop.background picture-uri file:///walls/a%20b.png",
+				"gsettings set org.gnome.desktop.background picture-uri-dark file:///walls/a%20b.png",
+			}, tt.calls...)
+			if calls := fakeCalls(t, log); !reflect.DeepEqual(calls, want) {
+				t.Errorf("calls = %q, want %q", calls, want)
+			}
+		})
+	}
+}
+
+func TestGnomeBackendCurrent(t *testing.T) {
+	log := fakePath(t, map[string]string{"gsettings": `echo "'file:///walls/a%20b.png'"`})
+	b := NewGnomeBackend()
+
+	if err := b.Apply("DP-1", "/walls/a.png"); err == nil {
+		t.Error("Apply() on one output succeeded")
+	}
+	current, err := b.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"": "/walls/a b.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+	if want := []string{"gsettings get org.gnome.desktop.background picture-uri"}; !reflect.DeepEqual(fakeCalls(t, log), want) {
+		t.Errorf("calls = %q, want %q", fakeCalls(t, log), want)
+	}
+}
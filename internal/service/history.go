@@ -0,0 +1,277 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultHistorySize is how many wallpapers are remembered per output.
+const DefaultHistorySize = 50
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// History is the JSON document stored at HistoryPath. Every output has its
+// own log, keyed like State.Outputs, so undoing on one monitor leaves the
+// others alone.
+type History struct {
+	Version int                       `json:"version"`
+	Outputs map[string]*OutputHistory `json:"outputs"`
+}
+
+// OutputHistory lists the wallpapers applied to one output, oldest first.
+// Current indexes the one on screen; the entries after it can be redone until
+// a new wallpaper is set.
+type OutputHistory struct {
+	Entries []ActiveWallpaper `json:"entries"`
+	Current int               `json:"current"`
+}
+
+// HistoryEntry is one applied wallpaper and the output it was applied to,
+// with "" meaning every output.
+type HistoryEntry struct {
+	Output string
+	ActiveWallpaper
+}
+
+// HistoryPath returns history.json next to the state file.
+func HistoryPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "history.json")
+}
+
+// LoadHistory reads the history, returning an empty one if none was saved.
+func LoadHistory() (*History, error) {
+	history := &History{Version: StateVersion, Outputs: make(map[string]*OutputHistory)}
+
+	data, err := os.ReadFile(HistoryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, history); err != nil {
+		return nil, fmt.Errorf("%s: %w", HistoryPath(), err)
+	}
+	if history.Version > StateVersion {
+		return nil, fmt.Errorf("%s: unsupported history version %d", HistoryPath(), history.Version)
+	}
+	if history.Outputs == nil {
+		history.Outputs = make(map[string]*OutputHistory)
+	}
+	return history, nil
+}
+
+// updateHistory reads the history and saves it if change reports that it
+// changed it, holding a lock so that other processes changing the history
+// wait.
+func updateHistory(change func(history *History) (bool, error)) error {
+	return withLock(HistoryPath()+".lock", func() error {
+		history, err := LoadHistory()
+		if err != nil {
+			return err
+		}
+		if changed, err := change(history); err != nil || !changed {
+			return err
+		}
+		return history.Save()
+	})
+}
+
+// Save atomically replaces the history file.
+func (h *History) Save() error {
+	h.Version = StateVersion
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(HistoryPath(), append(data, '\n'))
+}
+
+// Recent returns up to limit entries across every output, newest first. A
+// limit of 0 returns everything.
+func (h *History) Recent(limit int) []HistoryEntry {
+	var entries []HistoryEntry
+	for key, outputHistory := range h.Outputs {
+		output := key
+		if output == allOutputsKey {
+			output = ""
+		}
+		for _, wp := range outputHistory.Entries {
+			entries = append(entries, HistoryEntry{Output: output, ActiveWallpaper: wp})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SetAt.After(entries[j].SetAt)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
+
+// LastUsed returns when each wallpaper in the history or on screen was last
+// applied, by path.
+func LastUsed() (map[string]time.Time, error) {
+	lastUsed := make(map[string]time.Time)
+	use := func(wp ActiveWallpaper) {
+		if wp.SetAt.After(lastUsed[wp.Path]) {
+			lastUsed[wp.Path] = wp.SetAt
+		}
+	}
+
+	history, err := LoadHistory()
+	if err != nil {
+		return nil, err
+	}
+	for _, outputHistory := range history.Outputs {
+		for _, wp := range outputHistory.Entries {
+			use(wp)
+		}
+	}
+
+	active, err := LoadActiveWallpapers()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, wp := range active {
+		use(wp)
+	}
+	return lastUsed, nil
+}
+
+// record appends wp to output's log, dropping any redo entries and the
+// oldest entries beyond size. A new log starts with previous, if set, so the
+// first change can be undone. Setting the wallpaper already on screen only
+// refreshes its timestamp.
+func (h *History) record(output string, wp ActiveWallpaper, previous *ActiveWallpaper, size int) {
+	key := historyKey(output)
+	outputHistory := h.Outputs[key]
+	if outputHistory == nil {
+		outputHistory = &OutputHistory{Current: -1}
+		if previous != nil {
+			outputHistory.Entries = []ActiveWallpaper{*previous}
+			outputHistory.Current = 0
+		}
+		h.Outputs[key] = outputHistory
+	}
+
+	current := outputHistory.Current
+	if current >= 0 && current < len(outputHistory.Entries) && outputHistory.Entries[current].Path == wp.Path && outputHistory.Entries[current].Span == wp.Span {
+		outputHistory.Entries[current] = wp
+		return
+	}
+
+	outputHistory.Entries = append(outputHistory.Entries[:current+1], wp)
+	if excess := len(outputHistory.Entries) - size; excess > 0 {
+		outputHistory.Entries = outputHistory.Entries[excess:]
+	}
+	outputHistory.Current = len(outputHistory.Entries) - 1
+}
+
+func historyKey(output string) string {
+	if output == "" {
+		return allOutputsKey
+	}
+	return output
+}
+
+// recordHistory adds the wallpapers just applied, keyed by output, to the
+// history. previous is the state before they were applied. It does nothing
+// when HistorySize is 0.
+func (s *WallpaperService) recordHistory(applied, previous map[string]ActiveWallpaper) error {
+	if s.HistorySize <= 0 {
+		return nil
+	}
+
+	return updateHistory(func(history *History) (bool, error) {
+		for _, output := range sortedOutputs(applied) {
+			var before *ActiveWallpaper
+			if wp, ok := previous[output]; ok {
+				before = &wp
+			} else if wp, ok := previous[""]; ok {
+				before = &wp
+			}
+			history.record(output, applied[output], before, s.HistorySize)
+		}
+		return true, nil
+	})
+}
+
+// Undo reapplies the wallpaper shown on output before the current one, with
+// "" meaning the wallpaper applied to every output.
+func (s *WallpaperService) Undo(output string) (*ActiveWallpaper, error) {
+	return s.stepHistory(output, -1)
+}
+
+// Redo reapplies the wallpaper most recently undone on output.
+func (s *WallpaperService) Redo(output string) (*ActiveWallpaper, error) {
+	return s.stepHistory(output, 1)
+}
+
+func (s *WallpaperService) stepHistory(output string, delta int) (*ActiveWallpaper, error) {
+	if s.Backend == nil {
+		return nil, ErrNoBackend
+	}
+
+	// The history stays locked while the wallpaper is applied, so that two
+	// undos step back twice.
+	var wp ActiveWallpaper
+	err := updateHistory(func(history *History) (bool, error) {
+		outputHistory := history.Outputs[historyKey(output)]
+		next := delta
+		if outputHistory != nil {
+			next += outputHistory.Current
+		}
+		if outputHistory == nil || next < 0 || next >= len(outputHistory.Entries) {
+			if delta < 0 {
+				return false, ErrNothingToUndo
+			}
+			return false, ErrNothingToRedo
+		}
+
+		wp = outputHistory.Entries[next]
+		if err := s.restore(output, wp); err != nil {
+			return false, err
+		}
+		outputHistory.Current = next
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = updateActiveWallpapers(func(active map[string]ActiveWallpaper) map[string]ActiveWallpaper {
+		if active == nil || output == "" {
+			active = make(map[string]ActiveWallpaper)
+		}
+		current := wp
+		current.SetAt = time.Now()
+		active[output] = current
+		return active
+	})
+	return &wp, err
+}
+
+// ReapplyHistoryEntry applies entry to its output again, with the transition
+// it was first applied with, as a new history entry. Spanned entries are
+// sliced across the current outputs.
+func (s *WallpaperService) ReapplyHistoryEntry(entry HistoryEntry) error {
+	transition := s.DefaultTransition
+	if entry.Transition != "" {
+		transition = transition.WithType(entry.Transition)
+	}
+	if entry.Span {
+		return s.SpanWallpaperWithTransition(entry.Path, transition)
+	}
+	return s.ApplyWallpaper(entry.Output, entry.Path, transition)
+}
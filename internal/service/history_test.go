@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentApply applies wallpapers from services standing for
+// separate processes at the same time; none of the changes may be lost.
+func TestConcurrentApply(t *testing.T) {
+	useStateDirs(t)
+	const n = 8
+	var outputs []Output
+	for i := range n {
+		outputs = append(outputs, Output{Name: fmt.Sprintf("DP-%d", i), Width: 64, Height: 48, Scale: 1})
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := &WallpaperService{Backend: newFakeBackend(outputs...), HistorySize: DefaultHistorySize}
+			errs <- s.SetWallpaperForOutput(outputs[i].Name, fmt.Sprintf("/walls/%d.png", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := LoadActiveWallpapers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, o := range outputs {
+		want := fmt.Sprintf("/walls/%d.png", i)
+		if active[o.Name].Path != want {
+			t.Errorf("state of %s = %q, want %q", o.Name, active[o.Name].Path, want)
+		}
+		if h := history.Outputs[o.Name]; h == nil || len(h.Entries) != 1 || h.Entries[0].Path != want {
+			t.Errorf("history of %s = %+v, want %q", o.Name, h, want)
+		}
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	useStateDirs(t)
+	backend := newFakeBackend(Output{Name: "DP-1", Width: 64, Height: 48, Scale: 1})
+	s := &WallpaperService{Backend: backend, HistorySize: DefaultHistorySize}
+	for _, path := range []string{"/walls/a.png", "/walls/b.png"} {
+		if err := s.SetWallpaper(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend.take()
+
+	steps := []struct {
+		undo bool
+		want string
+		err  error
+	}{
+		{undo: true, want: "/walls/a.png"},
+		{undo: true, err: ErrNothingToUndo},
+		{undo: false, want: "/walls/b.png"},
+		{undo: false, err: ErrNothingToRedo},
+	}
+	for i, step := range steps {
+		var wp *ActiveWallpaper
+		var err error
+		if step.undo {
+			wp, err = s.Undo("")
+		} else {
+			wp, err = s.Redo("")
+		}
+		if step.err != nil {
+			if err != step.err {
+				t.Errorf("step %d: error = %v, want %v", i, err, step.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if wp.Path != step.want {
+			t.Errorf("step %d: got %s, want %s", i, wp.Path, step.want)
+		}
+		if active, _ := LoadActiveWallpapers(); active[""].Path != step.want {
+			t.Errorf("step %d: state = %+v, want %s", i, active, step.want)
+		}
+	}
+	if applied := backend.take(); len(applied) != 2 {
+		t.Errorf("applied = %q, want the undo and the redo", applied)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const hyprpaperDialTimeout = 2 * time.Second
+
+// HyprpaperBackend drives hyprpaper over its IPC socket using the same
+// commands as `hyprctl hyprpaper`. Each command is sent on its own connection.
+type HyprpaperBackend struct {
+	SocketPath string
+
+	mutex sync.Mutex
+}
+
+func NewHyprpaperBackend() *HyprpaperBackend {
+	return &HyprpaperBackend{SocketPath: hyprpaperSocketPath()}
+}
+
+// hyprpaperSocketPath follows Hyprland's layout, preferring the runtime
+// directory used by current releases over the legacy /tmp location.
+func hyprpaperSocketPath() string {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	if signature == "" {
+		return ""
+	}
+
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		path := filepath.Join(runtimeDir, "hypr", signature, ".hyprpaper.sock")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join("/tmp", "hypr", signature, ".hyprpaper.sock")
+}
+
+func (b *HyprpaperBackend) Name() string {
+	return "hyprpaper"
+}
+
+func (b *HyprpaperBackend) Available() bool {
+	if b.SocketPath == "" {
+		return false
+	}
+	info, err := os.Stat(b.SocketPath)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// Ready checks that hyprpaper answers on its socket, which exists slightly
+// before it starts accepting connections.
+func (b *HyprpaperBackend) Ready() error {
+	_, err := b.send("listactive")
+	return err
+}
+
+func (b *HyprpaperBackend) Capabilities() Capabilities {
+	return Capabilities{Transitions: false, MultiOutput: true}
+}
+
+func (b *HyprpaperBackend) Outputs() ([]Output, error) {
+	return hyprlandOutputs()
+}
+
+// Apply preloads path, shows it on output and then unloads the images that
+// were shown before and no longer are, so repeated calls do not grow
+// hyprpaper's memory. What was shown is asked from hyprpaper rather than
+// remembered, so images preloaded by other processes, such as an earlier
+// `wallpaper-manager set`, are unloaded too; images preloaded but never
+// shown, e.g. from hyprpaper.conf, are left alone.
+func (b *HyprpaperBackend) Apply(output, path string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	previous, err := b.shownPaths()
+	if err != nil {
+		return err
+	}
+
+	preloaded := !slices.Contains(previous, path)
+	if preloaded {
+		if _, err := b.send("preload " + path); err != nil {
+			return err
+		}
+	}
+	if _, err := b.send(fmt.Sprintf("wallpaper %s,%s", output, path)); err != nil {
+		if preloaded {
+			_, _ = b.send("unload " + path)
+		}
+		return err
+	}
+
+	shown, err := b.shownPaths()
+	if err != nil {
+		return err
+	}
+	for _, old := range previous {
+		if old != path && !slices.Contains(shown, old) {
+			if _, err := b.send("unload " + old); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// shownPaths returns the images shown on any output, sorted and without
+// duplicates.
+func (b *HyprpaperBackend) shownPaths() ([]string, error) {
+	current, err := b.Current()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(current))
+	for _, path := range current {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// Current parses `listactive`, whose lines look like "DP-1 = /path/to.png".
+func (b *HyprpaperBackend) Current() (map[string]string, error) {
+	reply, err := b.send("listactive")
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(reply))
+	for scanner.Scan() {
+		output, path, ok := strings.Cut(scanner.Text(), " = ")
+		if ok {
+			current[strings.TrimSpace(output)] = strings.TrimSpace(path)
+		}
+	}
+	return current, scanner.Err()
+}
+
+func (b *HyprpaperBackend) send(command string) (string, error) {
+	conn, err := net.DialTimeout("unix", b.SocketPath, hyprpaperDialTimeout)
+	if err != nil {
+		return "", fmt.Errorf("hyprpaper: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(hyprpaperDialTimeout)); err != nil {
+		return "", fmt.Errorf("hyprpaper: %w", err)
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return "", fmt.Errorf("hyprpaper: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("hyprpaper: %w", err)
+	}
+
+	text := strings.TrimSpace(string(reply))
+	if command == "listactive" {
+		return text, nil
+	}
+	if text != "ok" {
+		return "", fmt.Errorf("hyprpaper: %s: %s", command, text)
+	}
+	return text, nil
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHyprpaper answers hyprpaper's IPC commands on a Unix socket, one
+// command per connection, and records them. Like hyprpaper, it refuses to
+// show images that are not preloaded and to unload images that are shown.
+type fakeHyprpaper struct {
+	mutex    sync.Mutex
+	monitors []string
+	loaded   map[string]bool
+	active   map[string]string
+	commands []string
+}
+
+func newFakeHyprpaper(t *testing.T, monitors ...string) (*fakeHyprpaper, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".hyprpaper.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	f := &fakeHyprpaper{monitors: monitors, loaded: make(map[string]bool), active: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4096)
+			n, _ := conn.Read(buf)
+			conn.Write([]byte(f.handle(string(buf[:n]))))
+			conn.Close()
+		}
+	}()
+	return f, path
+}
+
+func (f *fakeHyprpaper) handle(command string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.commands = append(f.commands, command)
+
+	name, arg, _ := strings.Cut(command, " ")
+	switch name {
+	case "listactive":
+		if len(f.active) == 0 {
+			return "no wallpapers active"
+		}
+		var lines []string
+		for _, monitor := range f.monitors {
+			if path, ok := f.active[monitor]; ok {
+				lines = append(lines, monitor+" = "+path)
+			}
+		}
+		return strings.Join(lines, "\n")
+	case "preload":
+		f.loaded[arg] = true
+		return "ok"
+	case "wallpaper":
+		monitor, path, _ := strings.Cut(arg, ",")
+		if !f.loaded[path] {
+			return "wallpaper failed (not preloaded)"
+		}
+		if monitor == "" {
+			for _, m := range f.monitors {
+				f.active[m] = path
+			}
+			return "ok"
+		}
+		if !slices.Contains(f.monitors, monitor) {
+			return fmt.Sprintf("wallpaper failed (no monitor %s)", monitor)
+		}
+		f.active[monitor] = path
+		return "ok"
+	case "unload":
+		for _, path := range f.active {
+			if path == arg {
+				return "cannot unload an active wallpaper"
+			}
+		}
+		delete(f.loaded, arg)
+		return "ok"
+	}
+	return "invalid hyprpaper request"
+}
+
+// show makes path loaded and shown on monitor.
+func (f *fakeHyprpaper) show(monitor, path string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.loaded[path] = true
+	f.active[monitor] = path
+}
+
+// take returns the commands received since the last call.
+func (f *fakeHyprpaper) take() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	commands := f.commands
+	f.commands = nil
+	return commands
+}
+
+func (f *fakeHyprpaper) loadedPaths() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var paths []string
+	for path := range f.loaded {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestHyprpaperBackendApply(t *testing.T) {
+	fake, socket := newFakeHyprpaper(t, "DP-1", "HDMI-A-1")
+	// An earlier process showed /a everywhere and the user preloaded /spare.
+	fake.show("DP-1", "/a")
+	fake.show("HDMI-A-1", "/a")
+	fake.mutex.Lock()
+	fake.loaded["/spare"] = true
+	fake.mutex.Unlock()
+
+	steps := []struct {
+		name         string
+		output, path string
+		wantErr      bool
+		commands     []string
+		loaded       []string
+	}{
+		{
+			name: "every output", path: "/b",
+			commands: []string{"listactive", "preload /b", "wallpaper ,/b", "listactive", "unload /a"},
+			loaded:   []string{"/b", "/spare"},
+		},
+		{
+			name: "one output keeps the image shown on the other", output: "DP-1", path: "/c",
+			commands: []string{"listactive", "preload /c", "wallpaper DP-1,/c", "listactive"},
+			loaded:   []string{"/b", "/c", "/spare"},
+		},
+		{
+			name: "image already shown is not preloaded again", output: "HDMI-A-1", path: "/c",
+			commands: []string{"listactive", "wallpaper HDMI-A-1,/c", "listactive", "unload /b"},
+			loaded:   []string{"/c", "/spare"},
+		},
+		{
+			name: "failed wallpaper unloads its preload", output: "DP-2", path: "/d", wantErr: true,
+			commands: []string{"listactive", "preload /d", "wallpaper DP-2,/d", "unload /d"},
+			loaded:   []string{"/c", "/spare"},
+		},
+	}
+	for _, step := range steps {
+		// A new backend per step, like separate CLI invocations.
+		b := &HyprpaperBackend{SocketPath: socket}
+		err := b.Apply(step.output, step.path)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: Apply() error = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if commands := fake.take(); !reflect.DeepEqual(commands, step.commands) {
+			t.Errorf("%s: commands = %q, want %q", step.name, commands, step.commands)
+		}
+		if loaded := fake.loadedPaths(); !reflect.DeepEqual(loaded, step.loaded) {
+			t.Errorf("%s: loaded = %q, want %q", step.name, loaded, step.loaded)
+		}
+	}
+}
+
+func TestHyprpaperBackendCurrent(t *testing.T) {
+	fake, socket := newFakeHyprpaper(t, "DP-1", "HDMI-A-1")
+	b := &HyprpaperBackend{SocketPath: socket}
+
+	current, err := b.Current()
+	if err != nil || len(current) != 0 {
+		t.Fatalf("Current() = %v, %v, want nothing shown", current, err)
+	}
+
+	fake.show("DP-1", "/walls/a b.png")
+	fake.show("HDMI-A-1", "/walls/c.png")
+	current, err = b.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"DP-1": "/walls/a b.png", "HDMI-A-1": "/walls/c.png"}
+	if !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// IndexVersion is the version of the index layout. An index written with a
+// different version is discarded and rebuilt by the next scan.
+const IndexVersion = 1
+
+const (
+	// indexFlushDelay is how long queued updates wait for more to arrive
+	// before they are written together.
+	indexFlushDelay = 2 * time.Second
+	// indexLockTimeout bounds how long to wait for another process that
+	// has the index open.
+	indexLockTimeout = time.Second
+)
+
+var (
+	indexMetaBucket       = []byte("meta")
+	indexWallpapersBucket = []byte("wallpapers")
+	indexVersionKey       = []byte("version")
+)
+
+// IndexEntry is what the index knows about one file, valid as long as the
+// file keeps its Size and ModTime. Files that turned out not to be images are
+// indexed too, with Ignored set, so they are not opened again.
+type IndexEntry struct {
+	Size        int64           `json:"size"`
+	ModTime     time.Time       `json:"mod_time"`
+	Ignored     bool            `json:"ignored,omitempty"`
+	Format      string          `json:"format,omitempty"`
+	Unsupported string          `json:"unsupported,omitempty"`
+	Metadata    *model.Metadata `json:"metadata,omitempty"`
+}
+
+// matches reports whether e still describes a file with this size and
+// modification time.
+func (e *IndexEntry) matches(size int64, modTime time.Time) bool {
+	return e.Size == size && e.ModTime.Equal(modTime)
+}
+
+// outdated reports whether e marks a format as unsupported that has become
+// decodable since, because its external decoder was installed.
+func (e *IndexEntry) outdated() bool {
+	return e.Unsupported != "" && ImageFormat(e.Format).Decodable()
+}
+
+// Index is a persistent cache of the library in a bbolt database, keyed by
+// file path, so that scans only open files that changed and metadata is not
+// extracted twice. The database is only opened for the duration of a read or
+// a write, since bbolt locks it against other processes while it is open.
+//
+// The index is a cache: callers treat failures to read or write it as misses.
+// Nothing in it is lost for good when it is discarded; tags are kept with the
+// annotations.
+type Index struct {
+	path string
+
+	mutex   sync.Mutex
+	pending []indexUpdate
+	timer   *time.Timer
+}
+
+type indexUpdate struct {
+	path string
+	// update changes the entry for path, which is nil when there is none,
+	// and returns the entry to store, or nil to delete it.
+	update func(entry *IndexEntry) *IndexEntry
+}
+
+// IndexPath returns $XDG_CACHE_HOME/wallpaper-manager/index.db, where
+// XDG_CACHE_HOME defaults to ~/.cache.
+func IndexPath() string {
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		cacheHome = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(cacheHome, "wallpaper-manager", "index.db")
+}
+
+func NewIndex(path string) *Index {
+	return &Index{path: path}
+}
+
+func (i *Index) open(readOnly bool) (*bolt.DB, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(i.path), 0o755); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(i.path); err != nil {
+		return nil, err
+	}
+	return bolt.Open(i.path, 0o644, &bolt.Options{Timeout: indexLockTimeout, ReadOnly: readOnly})
+}
+
+// Load returns every entry whose path is below one of dirs, keyed by path.
+// A missing or outdated index is empty.
+func (i *Index) Load(dirs []string) (map[string]*IndexEntry, error) {
+	entries := make(map[string]*IndexEntry)
+
+	db, err := i.open(true)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return entries, err
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if !indexCurrent(tx) {
+			return nil
+		}
+		wallpapers := tx.Bucket(indexWallpapersBucket)
+		for _, dir := range dirs {
+			prefix := []byte(dirPrefix(dir))
+			c := wallpapers.Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				var entry IndexEntry
+				if json.Unmarshal(v, &entry) == nil {
+					entries[string(k)] = &entry
+				}
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Wallpapers lists the indexed wallpapers of roots without touching the
+// files, in the order a scan would return them. It shows the library
+// instantly while a scan confirms it.
+func (i *Index) Wallpapers(roots []LibraryRoot) ([]model.Wallpaper, error) {
+	var wallpapers []model.Wallpaper
+	for _, root := range roots {
+		entries, err := i.Load([]string{root.Path})
+		if err != nil {
+			return nil, err
+		}
+
+		var found []model.Wallpaper
+		rootPath := filepath.Clean(root.Path)
+		for full, entry := range entries {
+			if entry.Ignored {
+				continue
+			}
+			rel, err := filepath.Rel(rootPath, full)
+			if err != nil {
+				continue
+			}
+			dir := path.Dir(filepath.ToSlash(rel))
+			if dir == "." {
+				dir = ""
+			}
+			found = append(found, entry.wallpaper(full, root.Label, dir))
+		}
+		sortWallpapers(found)
+		wallpapers = append(wallpapers, found...)
+	}
+	return wallpapers, nil
+}
+
+func (e *IndexEntry) wallpaper(full, root, dir string) model.Wallpaper {
+	return model.Wallpaper{
+		Name:        filepath.Base(full),
+		Path:        full,
+		Root:        root,
+		Dir:         dir,
+		Format:      e.Format,
+		Unsupported: e.Unsupported,
+		Size:        e.Size,
+		ModTime:     e.ModTime,
+		Metadata:    e.Metadata,
+	}
+}
+
+// Update queues update to the entry of path. Queued updates are written
+// together shortly afterwards, or by Flush.
+func (i *Index) Update(path string, update func(entry *IndexEntry) *IndexEntry) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.pending = append(i.pending, indexUpdate{path: path, update: update})
+	if i.timer == nil {
+		i.timer = time.AfterFunc(indexFlushDelay, func() { _ = i.Flush() })
+	}
+}
+
+// Flush writes the queued updates in a single transaction. If the index
+// cannot be opened, for example because another process keeps it open for
+// longer than indexLockTimeout, the updates are dropped like any failed cache
+// write, and the files are read again by the next scan.
+func (i *Index) Flush() error {
+	i.mutex.Lock()
+	pending := i.pending
+	i.pending = nil
+	if i.timer != nil {
+		i.timer.Stop()
+		i.timer = nil
+	}
+	i.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	db, err := i.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		wallpapers, err := prepareIndex(tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range pending {
+			if err := updateEntry(wallpapers, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func updateEntry(wallpapers *bolt.Bucket, p indexUpdate) error {
+	key := []byte(p.path)
+	var current *IndexEntry
+	if v := wallpapers.Get(key); v != nil {
+		current = &IndexEntry{}
+		if json.Unmarshal(v, current) != nil {
+			current = nil
+		}
+	}
+
+	updated := p.update(current)
+	if updated == nil {
+		return wallpapers.Delete(key)
+	}
+	data, err := json.Marshal(updated)
+	if err != nil {
+		return err
+	}
+	return wallpapers.Put(key, data)
+}
+
+// indexCurrent reports whether tx holds an index written with IndexVersion.
+func indexCurrent(tx *bolt.Tx) bool {
+	meta := tx.Bucket(indexMetaBucket)
+	if meta == nil || tx.Bucket(indexWallpapersBucket) == nil {
+		return false
+	}
+	return string(meta.Get(indexVersionKey)) == strconv.Itoa(IndexVersion)
+}
+
+// prepareIndex creates the buckets, discarding the cache of an index with
+// another version, and returns the wallpapers bucket.
+func prepareIndex(tx *bolt.Tx) (*bolt.Bucket, error) {
+	if !indexCurrent(tx) {
+		for _, name := range [][]byte{indexMetaBucket, indexWallpapersBucket} {
+			if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return nil, err
+			}
+		}
+		meta, err := tx.CreateBucket(indexMetaBucket)
+		if err != nil {
+			return nil, err
+		}
+		if err := meta.Put(indexVersionKey, []byte(strconv.Itoa(IndexVersion))); err != nil {
+			return nil, err
+		}
+	}
+	return tx.CreateBucketIfNotExists(indexWallpapersBucket)
+}
+
+// isBelow reports whether path is inside one of dirs.
+func isBelow(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, dirPrefix(dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dirPrefix is the prefix shared by the paths of every file below dir.
+func dirPrefix(dir string) string {
+	dir = filepath.Clean(dir)
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return dir
+}
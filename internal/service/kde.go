@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	plasmaShellService   = "org.kde.plasmashell"
+	plasmaShellPath      = "/PlasmaShell"
+	plasmaEvaluateScript = "org.kde.PlasmaShell.evaluateScript"
+)
+
+// KDEBackend sets the Plasma wallpaper through plasmashell's D-Bus scripting
+// interface on the session bus. Plasma knows screens by index rather than
+// output name, so desktops are matched to outputs by their position.
+type KDEBackend struct{}
+
+func NewKDEBackend() *KDEBackend {
+	return &KDEBackend{}
+}
+
+func (b *KDEBackend) Name() string {
+	return "kde"
+}
+
+func (b *KDEBackend) Available() bool {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return false
+	}
+
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, plasmaShellService).Store(&hasOwner)
+	return err == nil && hasOwner
+}
+
+func (b *KDEBackend) Capabilities() Capabilities {
+	return Capabilities{Transitions: false, MultiOutput: true}
+}
+
+func (b *KDEBackend) Outputs() ([]Output, error) {
+	return DetectOutputs()
+}
+
+func (b *KDEBackend) Apply(output, path string) error {
+	uri, err := json.Marshal(fileURI(path))
+	if err != nil {
+		return err
+	}
+
+	filter := ""
+	if output != "" {
+		o, err := b.output(output)
+		if err != nil {
+			return err
+		}
+		filter = fmt.Sprintf(`
+	var g = screenGeometry(d.screen);
+	if (g.x != %d || g.y != %d) {
+		return;
+	}`, o.X, o.Y)
+	}
+
+	script := fmt.Sprintf(`desktops().forEach(function (d) {%s
+	d.wallpaperPlugin = "org.kde.image";
+	d.currentConfigGroup = ["Wallpaper", "org.kde.image", "General"];
+	d.writeConfig("Image", %s);
+});`, filter, uri)
+
+	_, err = b.evaluate(script)
+	return err
+}
+
+// Current prints one "x,y=uri" line per desktop from a script, with the
+// position of its screen, and maps them back to outputs and paths. When
+// every desktop shows the same image, as after applying to every output, it
+// is reported for every output.
+func (b *KDEBackend) Current() (map[string]string, error) {
+	out, err := b.evaluate(`desktops().forEach(function (d) {
+	var g = screenGeometry(d.screen);
+	d.currentConfigGroup = ["Wallpaper", "org.kde.image", "General"];
+	print(g.x + "," + g.y + "=" + d.readConfig("Image") + "\n");
+});`)
+	if err != nil {
+		return nil, err
+	}
+
+	byPosition := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		position, uri, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		if path := pathFromURI(uri); path != "" {
+			byPosition[position] = path
+		}
+	}
+
+	current := make(map[string]string)
+	if paths := slices.Sorted(maps.Values(byPosition)); len(slices.Compact(paths)) == 1 {
+		current[""] = paths[0]
+		return current, nil
+	}
+	if len(byPosition) == 0 {
+		return current, nil
+	}
+
+	outputs, err := b.Outputs()
+	if err != nil {
+		return nil, fmt.Errorf("kde: cannot match Plasma screens to outputs: %w", err)
+	}
+	for _, o := range outputs {
+		if path, ok := byPosition[fmt.Sprintf("%d,%d", o.X, o.Y)]; ok {
+			current[o.Name] = path
+		}
+	}
+	return current, nil
+}
+
+// output returns the output called name.
+func (b *KDEBackend) output(name string) (Output, error) {
+	outputs, err := b.Outputs()
+	if err != nil {
+		return Output{}, fmt.Errorf("kde: %w", err)
+	}
+	for _, o := range outputs {
+		if o.Name == name {
+			return o, nil
+		}
+	}
+	return Output{}, fmt.Errorf("kde: unknown output %q", name)
+}
+
+func (b *KDEBackend) evaluate(script string) (string, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return "", fmt.Errorf("kde: %w", err)
+	}
+
+	var out string
+	obj := conn.Object(plasmaShellService, plasmaShellPath)
+	if err := obj.Call(plasmaEvaluateScript, 0, script).Store(&out); err != nil {
+		return "", fmt.Errorf("kde: %w", err)
+	}
+	return out, nil
+}
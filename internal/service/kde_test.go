@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bufio"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startSessionBus runs a private D-Bus session bus for the duration of the
+// test and points DBUS_SESSION_BUS_ADDRESS at it. The test is skipped where
+// dbus-daemon is not installed.
+func startSessionBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.Command(daemon, "--session", "--nofork", "--nopidfile", "--address="+address, "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	// The address is printed once the bus accepts connections.
+	ready := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		ready <- strings.TrimSpace(line)
+	}()
+	select {
+	case line := <-ready:
+		if line == "" {
+			t.Fatal("dbus-daemon did not start")
+		}
+		t.Setenv("DBUS_SESSION_BUS_ADDRESS", line)
+		return line
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for dbus-daemon")
+	}
+	return ""
+}
+
+// fakeKScreenDoctor prints the JSON of kscreen-doctor for two monitors side
+// by side, the right one scaled down and rotated, and a disconnected one.
+const fakeKScreenDoctor = `echo '{"outputs": [
+	{"name": "DP-1", "enabled": true, "connected": true, "pos": {"x": 0, "y": 0}, "size": {"width": 2560, "height": 1440}, "scale": 1.25, "rotation": 1},
+	{"name": "HDMI-A-1", "enabled": true, "connected": true, "pos": {"x": 2048, "y": 0}, "size": {"width": 1920, "height": 1080}, "scale": 1, "rotation": 8},
+	{"name": "DP-2", "enabled": false, "connected": false, "pos": {"x": 0, "y": 0}, "size": {"width": 0, "height": 0}, "scale": 1, "rotation": 1}
+]}'`
+
+// fakePlasmaShell implements evaluateScript of plasmashell, recording the
+// scripts and answering them with output.
+type fakePlasmaShell struct {
+	mutex   sync.Mutex
+	scripts []string
+	output  string
+}
+
+func (f *fakePlasmaShell) EvaluateScript(script string) (string, *dbus.Error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.scripts = append(f.scripts, script)
+	return f.output, nil
+}
+
+func (f *fakePlasmaShell) take() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	scripts := f.scripts
+	f.scripts = nil
+	return scripts
+}
+
+func TestKDEBackend(t *testing.T) {
+	address := startSessionBus(t)
+	t.Cleanup(func() {
+		// Drop the shared connection to the private bus.
+		if conn, err := dbus.SessionBus(); err == nil {
+			conn.Close()
+		}
+	})
+
+	setSession(t, map[string]string{"WAYLAND_DISPLAY": "wayland-1", "XDG_CURRENT_DESKTOP": "KDE"})
+	fakePath(t, map[string]string{"kscreen-doctor": fakeKScreenDoctor})
+
+	b := NewKDEBackend()
+	if b.Available() {
+		t.Fatal("Available() = true without plasmashell on the bus")
+	}
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	shell := &fakePlasmaShell{output: "0,0=file:///walls/a%20b.png\n2048,0=file:///walls/c.png\n"}
+	if err := conn.ExportMethodTable(map[string]any{"evaluateScript": shell.EvaluateScript}, plasmaShellPath, "org.kde.PlasmaShell"); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(plasmaShellService, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName() = %v, %v", reply, err)
+	}
+
+	if !b.Available() {
+		t.Fatal("Available() = false with plasmashell on the bus")
+	}
+	if err := b.Apply("", "/walls/a b.png"); err != nil {
+		t.Fatal(err)
+	}
+	scripts := shell.take()
+	if len(scripts) != 1 || !strings.Contains(scripts[0], `d.writeConfig("Image", "file:///walls/a%20b.png");`) {
+		t.Errorf("scripts = %q, want one writing the image of every desktop", scripts)
+	}
+
+	// Desktops are matched to outputs by the position of their screen.
+	if err := b.Apply("HDMI-A-1", "/walls/c.png"); err != nil {
+		t.Fatal(err)
+	}
+	scripts = shell.take()
+	if len(scripts) != 1 || !strings.Contains(scripts[0], "if (g.x != 2048 || g.y != 0) {") {
+		t.Errorf("scripts = %q, want one writing the image of the desktop at 2048,0", scripts)
+	}
+	if err := b.Apply("NOPE-1", "/walls/c.png"); err == nil {
+		t.Error("Apply() on an unknown output succeeded")
+	}
+
+	current, err := b.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"DP-1": "/walls/a b.png", "HDMI-A-1": "/walls/c.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+
+	// The same image everywhere was applied to every output.
+	shell.mutex.Lock()
+	shell.output = "0,0=file:///walls/c.png\n2048,0=file:///walls/c.png\n"
+	shell.mutex.Unlock()
+	current, err = b.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"": "/walls/c.png"}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+}
+
+func TestKScreenOutputs(t *testing.T) {
+	setSession(t, map[string]string{"WAYLAND_DISPLAY": "wayland-1", "XDG_CURRENT_DESKTOP": "KDE"})
+	fakePath(t, map[string]string{"kscreen-doctor": fakeKScreenDoctor})
+
+	outputs, err := DetectOutputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Output{
+		{Name: "DP-1", Width: 2560, Height: 1440, Scale: 1.25},
+		{Name: "HDMI-A-1", X: 2048, Width: 1920, Height: 1080, Scale: 1, Transform: 3},
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("DetectOutputs() = %+v, want %+v", outputs, want)
+	}
+}
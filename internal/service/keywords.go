@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// embeddedKeywords returns the keywords of an image file's XMP packet, where
+// photo managers such as digiKam, darktable and Lightroom write them, and of
+// its IPTC record, which older tools use. Keywords found in both are listed
+// once.
+func embeddedKeywords(data []byte) []string {
+	var keywords []string
+	seen := make(map[string]bool)
+	for _, keyword := range append(xmpKeywords(data), iptcKeywords(jpegIPTC(data))...) {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" || seen[strings.ToLower(keyword)] {
+			continue
+		}
+		seen[strings.ToLower(keyword)] = true
+		keywords = append(keywords, keyword)
+	}
+	return keywords
+}
+
+// xmpKeywords returns the items of dc:subject in the XMP packet of data. The
+// packet is stored as plain text in every format, so it is found by its tags
+// rather than by parsing the container.
+func xmpKeywords(data []byte) []string {
+	packet := between(data, "<x:xmpmeta", "</x:xmpmeta>")
+	if packet == nil {
+		packet = between(data, "<rdf:RDF", "</rdf:RDF>")
+	}
+	if packet == nil {
+		return nil
+	}
+
+	var keywords []string
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	inSubject, inItem := false, false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return keywords
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == dcNamespace && t.Name.Local == "subject" {
+				inSubject = true
+			}
+			inItem = inSubject && t.Name.Space == rdfNamespace && t.Name.Local == "li"
+		case xml.EndElement:
+			if t.Name.Space == dcNamespace && t.Name.Local == "subject" {
+				inSubject = false
+			}
+			inItem = false
+		case xml.CharData:
+			if inItem {
+				keywords = append(keywords, string(t))
+			}
+		}
+	}
+}
+
+// between returns the part of data from the first start to the following
+// end, both included, or nil if there is none.
+func between(data []byte, start, end string) []byte {
+	i := bytes.Index(data, []byte(start))
+	if i < 0 {
+		return nil
+	}
+	j := bytes.Index(data[i:], []byte(end))
+	if j < 0 {
+		return nil
+	}
+	return data[i : i+j+len(end)]
+}
+
+// jpegIPTC returns the IPTC record of a JPEG file, which is an image resource
+// in its Photoshop APP13 segment, or nil if there is none.
+func jpegIPTC(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return nil
+	}
+
+	const photoshop = "Photoshop 3.0\x00"
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Padding before a marker.
+			i++
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// The image data starts, after all metadata segments.
+			return nil
+		case marker >= 0xd0 && marker <= 0xd7 || marker == 0x01:
+			// Markers without a segment.
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		if segment := data[i+4 : end]; marker == 0xed && bytes.HasPrefix(segment, []byte(photoshop)) {
+			if iptc := photoshopResource(segment[len(photoshop):], 0x0404); iptc != nil {
+				return iptc
+			}
+		}
+		i = end
+	}
+	return nil
+}
+
+// photoshopResource returns the data of the image resource with id in a list
+// of Photoshop image resources.
+func photoshopResource(resources []byte, id uint16) []byte {
+	for len(resources) >= 12 && string(resources[:4]) == "8BIM" {
+		// The Pascal string name is padded to an even length.
+		nameLength := 1 + int(resources[6])
+		nameLength += nameLength % 2
+
+		sizeAt := 6 + nameLength
+		if sizeAt+4 > len(resources) {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(resources[sizeAt:]))
+		start := sizeAt + 4
+		end := start + size
+		if size < 0 || end > len(resources) {
+			return nil
+		}
+		if binary.BigEndian.Uint16(resources[4:]) == id {
+			return resources[start:end]
+		}
+		resources = resources[min(end+size%2, len(resources)):]
+	}
+	return nil
+}
+
+// iptcKeywords returns the keywords (dataset 2:25) of an IPTC record. They
+// are UTF-8 when the record says so (dataset 1:90) or when they happen to be
+// valid UTF-8, and Latin-1 otherwise.
+func iptcKeywords(iim []byte) []string {
+	var keywords [][]byte
+	utf8Declared := false
+	for len(iim) >= 5 && iim[0] == 0x1c {
+		record, dataset := iim[1], iim[2]
+		size := int(binary.BigEndian.Uint16(iim[3:]))
+		if size&0x8000 != 0 || 5+size > len(iim) {
+			// Extended datasets hold large binary data, never keywords.
+			break
+		}
+		value := iim[5 : 5+size]
+		switch {
+		case record == 1 && dataset == 90:
+			utf8Declared = bytes.Equal(value, []byte("\x1b%G"))
+		case record == 2 && dataset == 25:
+			keywords = append(keywords, value)
+		}
+		iim = iim[5+size:]
+	}
+
+	decoded := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		if utf8Declared || utf8.Valid(keyword) {
+			decoded[i] = string(keyword)
+			continue
+		}
+		runes := make([]rune, len(keyword))
+		for j, b := range keyword {
+			runes[j] = rune(b)
+		}
+		decoded[i] = string(runes)
+	}
+	return decoded
+}
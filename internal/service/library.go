@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// LibraryRoot is one folder of the wallpaper library. Label identifies it in
+// the UI and in model.Wallpaper.Root.
+type LibraryRoot struct {
+	Path  string
+	Label string
+}
+
+// NewLibraryRoots returns roots for paths, labelled by their base name. Roots
+// sharing a base name are labelled by their full path instead.
+func NewLibraryRoots(paths ...string) []LibraryRoot {
+	roots := make([]LibraryRoot, len(paths))
+	for i, path := range paths {
+		roots[i] = LibraryRoot{Path: path}
+	}
+	return LabelRoots(roots)
+}
+
+// LabelRoots fills in missing labels the way NewLibraryRoots does.
+func LabelRoots(roots []LibraryRoot) []LibraryRoot {
+	names := make(map[string]int)
+	for _, root := range roots {
+		if root.Label == "" {
+			names[filepath.Base(root.Path)]++
+		}
+	}
+
+	labelled := make([]LibraryRoot, len(roots))
+	for i, root := range roots {
+		if root.Label == "" {
+			root.Label = filepath.Base(root.Path)
+			if names[root.Label] > 1 {
+				root.Label = root.Path
+			}
+		}
+		labelled[i] = root
+	}
+	return labelled
+}
+
+// RootError reports a library root that could not be scanned.
+type RootError struct {
+	Root LibraryRoot
+	Err  error
+}
+
+func (e *RootError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Root.Label, e.Err)
+}
+
+func (e *RootError) Unwrap() error {
+	return e.Err
+}
+
+// LibraryScan is the merged content of every library root.
+type LibraryScan struct {
+	Wallpapers []model.Wallpaper
+	// Unavailable lists the roots that could not be read, such as folders
+	// on an unmounted drive.
+	Unavailable []*RootError
+	// Dirs lists every directory that was read, for watching.
+	Dirs []string
+}
+
+// ScanLibrary scans every root concurrently and merges the results in root
+// order. Unreadable roots are reported in Unavailable rather than failing the
+// scan; an error is only returned for invalid options, when ctx is cancelled,
+// or when no root could be read at all.
+//
+// With an index, files that have not changed since they were indexed are not
+// opened again, and the index is brought up to date with the scan.
+func ScanLibrary(ctx context.Context, roots []LibraryRoot, opts ScanOptions, index *Index) (LibraryScan, error) {
+	if _, err := NewExcludeMatcher(opts.Exclude); err != nil {
+		return LibraryScan{}, err
+	}
+
+	paths := make([]string, len(roots))
+	for i, root := range roots {
+		paths[i] = root.Path
+	}
+
+	var known map[string]*IndexEntry
+	if index != nil {
+		// Without the index everything is simply read again.
+		known, _ = index.Load(paths)
+	}
+
+	results := make([]*directoryScanner, len(roots))
+	errs := make([]error, len(roots))
+
+	var wg sync.WaitGroup
+	for i, root := range roots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sc, err := scanDirectory(ctx, root.Path, opts, known)
+			if err == nil {
+				for j := range sc.wallpapers {
+					sc.wallpapers[j].Root = root.Label
+				}
+			}
+			results[i], errs[i] = sc, err
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return LibraryScan{}, err
+	}
+
+	var scan LibraryScan
+	var scanned []string
+	for i, root := range roots {
+		if errs[i] != nil {
+			scan.Unavailable = append(scan.Unavailable, &RootError{Root: root, Err: errs[i]})
+			continue
+		}
+		scan.Wallpapers = append(scan.Wallpapers, results[i].wallpapers...)
+		scan.Dirs = append(scan.Dirs, results[i].dirs...)
+		scanned = append(scanned, root.Path)
+	}
+
+	if index != nil {
+		updateIndex(index, known, results, scanned)
+	}
+
+	if len(roots) > 0 && len(scan.Unavailable) == len(roots) {
+		rootErrs := make([]error, len(scan.Unavailable))
+		for i, err := range scan.Unavailable {
+			rootErrs[i] = err
+		}
+		return scan, errors.Join(rootErrs...)
+	}
+	return scan, nil
+}
+
+// updateIndex stores the files read by a scan and forgets the ones below the
+// scanned roots that are gone. Entries of unavailable roots
+// are kept for when they come back.
+func updateIndex(index *Index, known map[string]*IndexEntry, results []*directoryScanner, scanned []string) {
+	seen := make(map[string]bool)
+	for _, sc := range results {
+		if sc == nil {
+			continue
+		}
+		for _, path := range sc.seen {
+			seen[path] = true
+		}
+		for path, entry := range sc.fresh {
+			index.Update(path, func(*IndexEntry) *IndexEntry { return entry })
+		}
+	}
+
+	for path := range known {
+		if !seen[path] && isBelow(path, scanned) {
+			index.Update(path, func(*IndexEntry) *IndexEntry { return nil })
+		}
+	}
+	_ = index.Flush()
+}
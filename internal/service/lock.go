@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+var errLocked = errors.New("locked")
+
+// lockFile makes sure only one process runs something, such as the
+// rotation, by locking the file at path, and returns running if another
+// process holds the lock. The lock is released when the returned file is
+// closed or the process exits.
+func lockFile(path string, running error) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, running
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// locked reports whether another process holds the lock at path.
+func locked(path string) bool {
+	f, err := lockFile(path, errLocked)
+	if err != nil {
+		return errors.Is(err, errLocked)
+	}
+	f.Close()
+	return false
+}
+
+// withLock runs fn holding an exclusive lock on the file at path, waiting
+// for other processes to release it first, so that processes reading,
+// changing and writing back the same file do not lose each other's changes.
+// Calls must not be nested for the same path.
+func withLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	return fn()
+}
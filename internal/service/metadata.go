@@ -0,0 +1,214 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// dominantColors is how many colours Metadata.Colors holds at most.
+	dominantColors = 5
+	// colorSampleSize is the size images are shrunk to before counting
+	// colours, which is plenty to find the dominant ones.
+	colorSampleSize = 64
+	// squareTolerance is how far the aspect ratio may be from 1 for an
+	// image to count as square.
+	squareTolerance = 0.02
+)
+
+// MetadataExtractor reads model.Metadata from wallpaper images and caches it
+// by path. A cached entry is reused as long as the file keeps the size and
+// modification time it had when it was read, so rescanning the library does
+// not decode anything again. Extracted metadata is also written to the index,
+// if there is one, from where later scans fill in model.Wallpaper.Metadata.
+type MetadataExtractor struct {
+	index   *Index
+	mutex   sync.Mutex
+	entries map[string]metadataEntry
+}
+
+type metadataEntry struct {
+	size     int64
+	modTime  time.Time
+	metadata *model.Metadata
+}
+
+func NewMetadataExtractor(index *Index) *MetadataExtractor {
+	return &MetadataExtractor{index: index, entries: make(map[string]metadataEntry)}
+}
+
+// Cached returns the metadata of wp if it has been extracted from the
+// current version of the file, and nil otherwise.
+func (e *MetadataExtractor) Cached(wp model.Wallpaper) *model.Metadata {
+	if wp.Metadata != nil {
+		return wp.Metadata
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	entry, ok := e.entries[wp.Path]
+	if !ok || entry.size != wp.Size || !entry.modTime.Equal(wp.ModTime) {
+		return nil
+	}
+	return entry.metadata
+}
+
+// Extract returns the metadata of wp, decoding the image unless it is
+// cached. Images that cannot be decoded are an error.
+func (e *MetadataExtractor) Extract(wp model.Wallpaper) (*model.Metadata, error) {
+	if metadata := e.Cached(wp); metadata != nil {
+		return metadata, nil
+	}
+	if wp.Unsupported != "" {
+		return nil, fmt.Errorf("%s: %s", wp.Name, wp.Unsupported)
+	}
+
+	metadata, err := extractMetadata(wp.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mutex.Lock()
+	e.entries[wp.Path] = metadataEntry{size: wp.Size, modTime: wp.ModTime, metadata: metadata}
+	e.mutex.Unlock()
+
+	if e.index != nil {
+		e.index.Update(wp.Path, func(entry *IndexEntry) *IndexEntry {
+			if entry != nil && entry.matches(wp.Size, wp.ModTime) {
+				entry.Metadata = metadata
+			}
+			return entry
+		})
+	}
+	return metadata, nil
+}
+
+// ExtractAll fills in the Metadata of every wallpaper, decoding at most
+// maxConcurrent images at once. Wallpapers whose metadata cannot be read are
+// left without. It stops early when ctx is cancelled and returns ctx's error.
+// The index is written before it returns.
+func (e *MetadataExtractor) ExtractAll(ctx context.Context, wallpapers []model.Wallpaper, maxConcurrent int64) error {
+	sem := semaphore.NewWeighted(maxConcurrent)
+	var wg sync.WaitGroup
+	for i := range wallpapers {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			if metadata, err := e.Extract(wallpapers[i]); err == nil {
+				wallpapers[i].Metadata = metadata
+			}
+		}()
+	}
+	wg.Wait()
+
+	if e.index != nil {
+		_ = e.index.Flush()
+	}
+	return ctx.Err()
+}
+
+func extractMetadata(path string) (*model.Metadata, error) {
+	// The file is read once for the hash, the keywords and the image.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("%s: empty image", path)
+	}
+	aspect := float64(width) / float64(height)
+
+	orientation := model.Landscape
+	switch {
+	case math.Abs(aspect-1) <= squareTolerance:
+		orientation = model.Square
+	case aspect < 1:
+		orientation = model.Portrait
+	}
+
+	return &model.Metadata{
+		Width:       width,
+		Height:      height,
+		AspectRatio: math.Round(aspect*1000) / 1000,
+		Orientation: orientation,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Colors:      dominantColorsOf(img),
+		Keywords:    embeddedKeywords(data),
+	}, nil
+}
+
+// dominantColorsOf groups the pixels of a downscaled copy of img into buckets
+// of similar colours and returns the average colour of the largest buckets.
+func dominantColorsOf(img image.Image) []string {
+	sample := imaging.Fit(img, colorSampleSize, colorSampleSize, imaging.Box)
+
+	type bucket struct {
+		key              int
+		count            int
+		red, green, blue int
+	}
+	buckets := make(map[int]*bucket)
+
+	bounds := sample.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			i := sample.PixOffset(x, y)
+			r, g, b, a := int(sample.Pix[i]), int(sample.Pix[i+1]), int(sample.Pix[i+2]), sample.Pix[i+3]
+			if a < 128 {
+				continue
+			}
+
+			// Four bits per channel keeps shades of one colour together.
+			key := r>>4<<8 | g>>4<<4 | b>>4
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{key: key}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.red += r
+			bk.green += g
+			bk.blue += b
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	slices.SortFunc(sorted, func(a, b *bucket) int {
+		return cmp.Or(b.count-a.count, a.key-b.key)
+	})
+
+	colors := make([]string, 0, dominantColors)
+	for _, bk := range sorted[:min(len(sorted), dominantColors)] {
+		colors = append(colors, fmt.Sprintf("#%02x%02x%02x", bk.red/bk.count, bk.green/bk.count, bk.blue/bk.count))
+	}
+	return colors
+}
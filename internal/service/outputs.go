@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+)
+
+// Output is a connected monitor. Width and Height are the current mode in
+// physical pixels, before Transform and Scale are applied. Transform uses the
+// wl_output enum: 0-3 rotate by 90° steps, 4-7 are the flipped variants.
+type Output struct {
+	Name      string
+	X         int
+	Y         int
+	Width     int
+	Height    int
+	Scale     float64
+	Transform int
+}
+
+// DetectOutputs enumerates outputs with whatever the session provides:
+// hyprctl inside Hyprland, kscreen-doctor in Plasma, wlr-randr on other
+// wlroots compositors, and RandR on X11.
+func DetectOutputs() ([]Output, error) {
+	switch {
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "" && commandExists("hyprctl"):
+		return hyprlandOutputs()
+	case currentSession() == sessionWayland && slices.Contains(currentDesktops(), "KDE") && commandExists("kscreen-doctor"):
+		return kscreenOutputs()
+	case currentSession() == sessionWayland && commandExists("wlr-randr"):
+		return wlrRandrOutputs()
+	case currentSession() == sessionX11:
+		return x11Outputs(os.Getenv("DISPLAY"))
+	}
+	return nil, fmt.Errorf("cannot enumerate outputs in this session")
+}
+
+func hyprlandOutputs() ([]Output, error) {
+	out, err := commandOutput("hyprctl", "monitors", "-j")
+	if err != nil {
+		return nil, err
+	}
+
+	var monitors []struct {
+		Name      string  `json:"name"`
+		Width     int     `json:"width"`
+		Height    int     `json:"height"`
+		X         int     `json:"x"`
+		Y         int     `json:"y"`
+		Scale     float64 `json:"scale"`
+		Transform int     `json:"transform"`
+		Disabled  bool    `json:"disabled"`
+	}
+	if err := json.Unmarshal(out, &monitors); err != nil {
+		return nil, fmt.Errorf("hyprctl: %w", err)
+	}
+
+	outputs := make([]Output, 0, len(monitors))
+	for _, m := range monitors {
+		if m.Disabled {
+			continue
+		}
+		outputs = append(outputs, Output{
+			Name:      m.Name,
+			X:         m.X,
+			Y:         m.Y,
+			Width:     m.Width,
+			Height:    m.Height,
+			Scale:     m.Scale,
+			Transform: m.Transform,
+		})
+	}
+	return outputs, nil
+}
+
+var wlrTransforms = map[string]int{
+	"normal":      0,
+	"90":          1,
+	"180":         2,
+	"270":         3,
+	"flipped":     4,
+	"flipped-90":  5,
+	"flipped-180": 6,
+	"flipped-270": 7,
+}
+
+func wlrRandrOutputs() ([]Output, error) {
+	out, err := commandOutput("wlr-randr", "--json")
+	if err != nil {
+		return nil, err
+	}
+
+	var heads []struct {
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+		Modes   []struct {
+			Width   int  `json:"width"`
+			Height  int  `json:"height"`
+			Current bool `json:"current"`
+		} `json:"modes"`
+		Position struct {
+			X int `json:"x"`
+			Y int `json:"y"`
+		} `json:"position"`
+		Transform string  `json:"transform"`
+		Scale     float64 `json:"scale"`
+	}
+	if err := json.Unmarshal(out, &heads); err != nil {
+		return nil, fmt.Errorf("wlr-randr: %w", err)
+	}
+
+	outputs := make([]Output, 0, len(heads))
+	for _, h := range heads {
+		if !h.Enabled {
+			continue
+		}
+		output := Output{
+			Name:      h.Name,
+			X:         h.Position.X,
+			Y:         h.Position.Y,
+			Scale:     h.Scale,
+			Transform: wlrTransforms[h.Transform],
+		}
+		for _, mode := range h.Modes {
+			if mode.Current {
+				output.Width, output.Height = mode.Width, mode.Height
+			}
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+// kscreenRotations maps the rotations of kscreen-doctor to wl_output
+// transforms.
+var kscreenRotations = map[int]int{1: 0, 2: 1, 4: 2, 8: 3}
+
+func kscreenOutputs() ([]Output, error) {
+	out, err := commandOutput("kscreen-doctor", "--json")
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Outputs []struct {
+			Name      string `json:"name"`
+			Enabled   bool   `json:"enabled"`
+			Connected bool   `json:"connected"`
+			Pos       struct {
+				X int `json:"x"`
+				Y int `json:"y"`
+			} `json:"pos"`
+			Size struct {
+				Width  int `json:"width"`
+				Height int `json:"height"`
+			} `json:"size"`
+			Scale    float64 `json:"scale"`
+			Rotation int     `json:"rotation"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, fmt.Errorf("kscreen-doctor: %w", err)
+	}
+
+	var outputs []Output
+	for _, o := range config.Outputs {
+		if !o.Enabled || !o.Connected {
+			continue
+		}
+		outputs = append(outputs, Output{
+			Name:      o.Name,
+			X:         o.Pos.X,
+			Y:         o.Pos.Y,
+			Width:     o.Size.Width,
+			Height:    o.Size.Height,
+			Scale:     o.Scale,
+			Transform: kscreenRotations[o.Rotation],
+		})
+	}
+	return outputs, nil
+}
+
+// x11Outputs lists RandR monitors. X11 reports geometry already rotated and
+// unscaled, so Transform is 0 and Scale is 1.
+func x11Outputs(display string) ([]Output, error) {
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, fmt.Errorf("x11: %w", err)
+	}
+	defer conn.Close()
+
+	return randrMonitors(conn)
+}
+
+func randrMonitors(conn *xgb.Conn) ([]Output, error) {
+	if err := randr.Init(conn); err != nil {
+		return nil, fmt.Errorf("x11: %w", err)
+	}
+
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	reply, err := randr.GetMonitors(conn, root, true).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("x11: %w", err)
+	}
+
+	outputs := make([]Output, 0, len(reply.Monitors))
+	for _, m := range reply.Monitors {
+		name, err := xproto.GetAtomName(conn, m.Name).Reply()
+		if err != nil {
+			return nil, fmt.Errorf("x11: %w", err)
+		}
+		outputs = append(outputs, Output{
+			Name:   name.Name,
+			X:      int(m.X),
+			Y:      int(m.Y),
+			Width:  int(m.Width),
+			Height: int(m.Height),
+			Scale:  1,
+		})
+	}
+	return outputs, nil
+}
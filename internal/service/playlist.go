@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RotationOrder is how a rotation picks the next wallpaper of a playlist.
+type RotationOrder string
+
+const (
+	// OrderSequential goes through the playlist in order, starting over at
+	// the end.
+	OrderSequential RotationOrder = "sequential"
+	// OrderShuffle goes through the playlist in a random order, showing
+	// every wallpaper once before any is repeated.
+	OrderShuffle RotationOrder = "shuffle"
+	// OrderWeighted picks at random each time, favouring wallpapers with
+	// more stars as RandomWallpaper does.
+	OrderWeighted RotationOrder = "weighted"
+)
+
+var RotationOrders = []RotationOrder{OrderSequential, OrderShuffle, OrderWeighted}
+
+// Playlist is a named selection of wallpapers to rotate through: Paths, the
+// wallpapers below Folders and the library's wallpapers matching Tags, in
+// that order. A playlist with none of them is the whole library. Order and
+// Interval default to those of the rotation.
+type Playlist struct {
+	Name     string
+	Paths    []string
+	Folders  []string
+	Tags     *TagQuery
+	Order    RotationOrder
+	Interval time.Duration
+}
+
+// LibraryPlaylist is the name of the playlist of the whole library, used
+// when no playlist is configured.
+const LibraryPlaylist = ""
+
+// PlaylistWallpapers lists the paths of the wallpapers of p that exist and
+// can be decoded, each once.
+func (s *WallpaperService) PlaylistWallpapers(ctx context.Context, p Playlist) ([]string, error) {
+	if len(p.Paths) == 0 && len(p.Folders) == 0 && p.Tags == nil {
+		wallpapers, err := s.selectableWallpapers()
+		if err != nil {
+			return nil, err
+		}
+		paths := make([]string, len(wallpapers))
+		for i, wp := range wallpapers {
+			paths[i] = wp.Path
+		}
+		return paths, nil
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, path := range p.Paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(absPath); err == nil && info.Mode().IsRegular() {
+			add(absPath)
+		}
+	}
+
+	// Folders are scanned without the index: they may be parts of the
+	// library scanned differently, which must not look like files
+	// disappearing from it.
+	if len(p.Folders) > 0 {
+		scan, err := ScanLibrary(ctx, NewLibraryRoots(p.Folders...), s.Scan, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, wp := range scan.Wallpapers {
+			if wp.Unsupported == "" {
+				add(wp.Path)
+			}
+		}
+	}
+
+	if p.Tags != nil {
+		scan, err := s.ScanLibrary(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, wp := range scan.Wallpapers {
+			if wp.Unsupported == "" && p.Tags.Match(wp.Tags) {
+				add(wp.Path)
+			}
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("playlist %s: %w", p.Name, ErrNoWallpapers)
+	}
+	return paths, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"os"
+)
+
+// RenameWallpaper moves what is recorded about the file at oldPath to
+// newPath after the file was renamed or moved: the saved wallpaper state,
+// the history, the rating and the index entry with its metadata and tags.
+func (s *WallpaperService) RenameWallpaper(oldPath, newPath string) error {
+	var errs []error
+
+	// The files are locked like for any other change, since this runs on the
+	// watcher's goroutine while wallpapers may be set.
+	errs = append(errs, withLock(StatePath()+".lock", func() error {
+		active, err := LoadActiveWallpapers()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		renamed := false
+		for output, wp := range active {
+			if wp.Path == oldPath {
+				wp.Path = newPath
+				active[output] = wp
+				renamed = true
+			}
+		}
+		if !renamed {
+			return nil
+		}
+		return SaveActiveWallpapers(active)
+	}))
+
+	errs = append(errs, updateHistory(func(history *History) (bool, error) {
+		return history.rename(oldPath, newPath), nil
+	}))
+
+	if annotations, err := s.Annotations(); err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, annotations.rename(oldPath, newPath))
+	}
+
+	if s.Index != nil {
+		var moved *IndexEntry
+		s.Index.Update(oldPath, func(entry *IndexEntry) *IndexEntry {
+			moved = entry
+			return nil
+		})
+		s.Index.Update(newPath, func(entry *IndexEntry) *IndexEntry {
+			if moved != nil {
+				return moved
+			}
+			return entry
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// rename points every entry for oldPath at newPath and reports whether there
+// were any.
+func (h *History) rename(oldPath, newPath string) bool {
+	renamed := false
+	for _, outputHistory := range h.Outputs {
+		for i := range outputHistory.Entries {
+			if outputHistory.Entries[i].Path == oldPath {
+				outputHistory.Entries[i].Path = newPath
+				renamed = true
+			}
+		}
+	}
+	return renamed
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRenameWallpaper(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	wp := writeImageFile(t, dir, "a.png", "image a")
+	outputs := []Output{{Name: "DP-1"}, {Name: "DP-2"}}
+	s := &WallpaperService{Backend: newFakeBackend(outputs...), HistorySize: DefaultHistorySize}
+
+	if err := s.SetWallpaperForOutput("DP-1", wp.Path); err != nil {
+		t.Fatal(err)
+	}
+	annotations, err := s.Annotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := annotations.Update(wp, func(annotation *Annotation) { annotation.Stars = 4 }); err != nil {
+		t.Fatal(err)
+	}
+
+	newPath := filepath.Join(dir, "b.png")
+	if err := os.Rename(wp.Path, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The watcher renames while other wallpapers are being set, here by
+	// another process.
+	const n = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, n+1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errs <- s.RenameWallpaper(wp.Path, newPath)
+	}()
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			other := &WallpaperService{Backend: newFakeBackend(outputs...), HistorySize: DefaultHistorySize}
+			errs <- other.SetWallpaperForOutput("DP-2", fmt.Sprintf("/walls/%d.png", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := LoadActiveWallpapers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active["DP-1"].Path != newPath || active["DP-2"].Path == "" {
+		t.Errorf("state = %+v, want DP-1 renamed to %s and DP-2 set", active, newPath)
+	}
+	history, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := history.Outputs["DP-1"]; h == nil || h.Entries[h.Current].Path != newPath {
+		t.Errorf("history of DP-1 = %+v, want %s", h, newPath)
+	}
+	if h := history.Outputs["DP-2"]; h == nil || len(h.Entries) != n {
+		t.Errorf("history of DP-2 = %+v, want %d entries", h, n)
+	}
+	saved, err := LoadAnnotations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Get(newPath).Stars != 4 {
+		t.Errorf("the annotation did not follow the file to %s", newPath)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	restoreInitialBackoff = 100 * time.Millisecond
+	restoreMaxBackoff     = 2 * time.Second
+)
+
+// RestoreOptions controls RestoreWallpapers.
+type RestoreOptions struct {
+	// Timeout bounds how long to wait for the backend to become ready.
+	Timeout time.Duration
+	// Default is applied to every output when nothing was saved, and in
+	// place of saved wallpapers that no longer exist.
+	Default string
+	// Detect creates the backend if none is set yet, e.g. because its daemon
+	// was not running when the service was created.
+	Detect func() (Backend, error)
+}
+
+// WaitForBackend polls until the backend accepts requests, backing off
+// exponentially between attempts, and gives up after timeout. A zero timeout
+// checks once.
+func (s *WallpaperService) WaitForBackend(timeout time.Duration, detect func() (Backend, error)) error {
+	deadline := time.Now().Add(timeout)
+	backoff := restoreInitialBackoff
+	for {
+		err := s.backendReady(detect)
+		if err == nil {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if timeout > 0 {
+				return fmt.Errorf("backend not ready after %s: %w", timeout, err)
+			}
+			return err
+		}
+		time.Sleep(min(backoff, remaining))
+		backoff = min(backoff*2, restoreMaxBackoff)
+	}
+}
+
+func (s *WallpaperService) backendReady(detect func() (Backend, error)) error {
+	if s.Backend == nil {
+		if detect == nil {
+			return ErrNoBackend
+		}
+		backend, err := detect()
+		if err != nil {
+			return err
+		}
+		s.Backend = backend
+	}
+
+	if checker, ok := s.Backend.(ReadyChecker); ok {
+		return checker.Ready()
+	}
+	if !s.Backend.Available() {
+		return fmt.Errorf("%s backend is not available", s.Backend.Name())
+	}
+	return nil
+}
+
+// RestoreWallpapers waits for the backend, then reapplies the persisted
+// wallpapers with the transition and fit mode they were set with, the
+// every-output entry first so per-output entries override it. It returns
+// what was applied; entries that fail are skipped and reported together.
+func (s *WallpaperService) RestoreWallpapers(opts RestoreOptions) (map[string]string, error) {
+	var fallback string
+	if opts.Default != "" {
+		abs, err := filepath.Abs(opts.Default)
+		if err != nil {
+			return nil, err
+		}
+		fallback = abs
+	}
+
+	if err := s.WaitForBackend(opts.Timeout, opts.Detect); err != nil {
+		return nil, err
+	}
+
+	active, err := LoadActiveWallpapers()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(active) == 0 {
+		if fallback == "" {
+			return map[string]string{}, nil
+		}
+		if err := s.ApplyWallpaper("", fallback, s.DefaultTransition); err != nil {
+			return nil, err
+		}
+		return map[string]string{"": fallback}, nil
+	}
+
+	restored := make(map[string]string, len(active))
+	var errs []error
+	for _, output := range sortedOutputs(active) {
+		wp := active[output]
+		if _, err := os.Stat(wp.Path); err != nil {
+			if fallback == "" {
+				errs = append(errs, err)
+				continue
+			}
+			wp = ActiveWallpaper{Path: fallback}
+		}
+
+		if err := s.restore(output, wp); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		restored[output] = wp.Path
+	}
+
+	// Move state read from the legacy file into the state file.
+	_, err = updateActiveWallpapers(func(legacy map[string]ActiveWallpaper) map[string]ActiveWallpaper {
+		if _, err := os.Stat(StatePath()); !errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return legacy
+	})
+	errs = append(errs, err)
+	return restored, errors.Join(errs...)
+}
+
+func (s *WallpaperService) restore(output string, wp ActiveWallpaper) error {
+	transition := s.DefaultTransition
+	if wp.Transition != "" {
+		transition = transition.WithType(wp.Transition)
+	}
+	if err := transition.Validate(); err != nil {
+		return err
+	}
+
+	if wp.Span {
+		return s.applySpan(wp.Path, transition.Resolve())
+	}
+
+	if fitter, ok := s.Backend.(Fitter); ok && wp.Mode != "" {
+		mode := fitter.FitMode()
+		fitter.SetFitMode(wp.Mode)
+		defer fitter.SetFitMode(mode)
+	}
+	return s.apply(output, wp.Path, transition.Resolve())
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRestoreRelativeDefault restores with a default given relative to the
+// working directory, both with nothing saved and in place of a saved
+// wallpaper that is gone, which must apply and report the absolute path.
+func TestRestoreRelativeDefault(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "default.png"), blue)
+	t.Chdir(dir)
+	want := filepath.Join(dir, "default.png")
+
+	for _, saved := range []map[string]ActiveWallpaper{
+		nil,
+		{"DP-1": {Path: filepath.Join(dir, "gone.png")}},
+	} {
+		if err := SaveActiveWallpapers(saved); err != nil {
+			t.Fatal(err)
+		}
+		backend := newFakeBackend(Output{Name: "DP-1", Width: 4, Height: 3, Scale: 1})
+		s := &WallpaperService{Backend: backend}
+		restored, err := s.RestoreWallpapers(RestoreOptions{Default: "default.png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for output := range restored {
+			if restored[output] != want {
+				t.Errorf("restored %v with %d saved, want %s", restored, len(saved), want)
+			}
+		}
+		if len(restored) != 1 {
+			t.Errorf("restored %v with %d saved, want one wallpaper", restored, len(saved))
+		}
+		if applied := backend.take(); len(applied) != 1 || !strings.HasSuffix(applied[0], "="+want) {
+			t.Errorf("applied %q with %d saved, want %s", applied, len(saved), want)
+		}
+	}
+}
@@ -0,0 +1,502 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultRotationInterval is how long each wallpaper of a playlist is shown
+// when no interval is configured.
+const DefaultRotationInterval = 30 * time.Minute
+
+const (
+	// rotationRetryDelay is how long the rotation waits after failing to
+	// change a wallpaper before trying again.
+	rotationRetryDelay = time.Minute
+	// rotationMaxWait bounds how long the rotation sleeps before looking at
+	// the clock again. Timers do not count time spent suspended, so a
+	// change due while the computer slept happens soon after it wakes up.
+	rotationMaxWait = time.Minute
+)
+
+var (
+	ErrRotationRunning = errors.New("the rotation is already running")
+	ErrNotRotated      = errors.New("output is not rotated")
+)
+
+// RotationOptions configures a Rotation. Playlist rotates on every output at
+// once, unless Outputs gives some outputs playlists of their own: then every
+// output rotates separately, the ones listed through theirs and the others
+// through Playlist. Playlists without an order or interval use Order and
+// Interval.
+type RotationOptions struct {
+	Interval  time.Duration
+	Order     RotationOrder
+	Playlist  string
+	Outputs   map[string]string
+	Playlists map[string]Playlist
+}
+
+// RotationState is the JSON document stored at RotationPath. Outputs is keyed
+// like State.Outputs. While Paused, the time left until each output's next
+// change is kept by moving NextAt forward on Resume by how long the pause
+// lasted.
+type RotationState struct {
+	Version  int                          `json:"version"`
+	Paused   bool                         `json:"paused,omitempty"`
+	PausedAt time.Time                    `json:"paused_at,omitzero"`
+	Outputs  map[string]*RotationPosition `json:"outputs"`
+}
+
+// RotationPosition is where the rotation of one output is in its playlist.
+// Queue holds the wallpapers of a shuffled playlist left in this round, next
+// first.
+type RotationPosition struct {
+	Playlist string    `json:"playlist"`
+	Current  string    `json:"current,omitempty"`
+	Queue    []string  `json:"queue,omitempty"`
+	NextAt   time.Time `json:"next_at,omitzero"`
+}
+
+// RotationPath returns rotation.json next to the state file.
+func RotationPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "rotation.json")
+}
+
+func rotationLockPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "rotation.lock")
+}
+
+// LoadRotationState reads the rotation state, returning an empty one if none
+// was saved.
+func LoadRotationState() (*RotationState, error) {
+	state := &RotationState{Version: StateVersion, Outputs: make(map[string]*RotationPosition)}
+
+	data, err := os.ReadFile(RotationPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("%s: %w", RotationPath(), err)
+	}
+	if state.Version > StateVersion {
+		return nil, fmt.Errorf("%s: unsupported rotation version %d", RotationPath(), state.Version)
+	}
+	if state.Outputs == nil {
+		state.Outputs = make(map[string]*RotationPosition)
+	}
+	return state, nil
+}
+
+// Save atomically replaces the rotation state file.
+func (st *RotationState) Save() error {
+	st.Version = StateVersion
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(RotationPath(), append(data, '\n'))
+}
+
+// position returns the position of output key in playlist, starting over
+// when the output was rotating through another playlist.
+func (st *RotationState) position(key, playlist string) *RotationPosition {
+	pos := st.Outputs[key]
+	if pos == nil || pos.Playlist != playlist {
+		pos = &RotationPosition{Playlist: playlist}
+		st.Outputs[key] = pos
+	}
+	return pos
+}
+
+// Rotation changes wallpapers through playlists, each at its interval. Its
+// position is kept in the rotation state file, so it carries on where it was
+// after a restart, and Pause, Resume and Skip work from another process than
+// the one running it.
+type Rotation struct {
+	service *WallpaperService
+	opts    RotationOptions
+	mutex   sync.Mutex
+
+	// Clock tells the time, SystemClock unless replaced.
+	Clock Clock
+	// OnChange is called after the wallpaper of output, "" for every
+	// output, was changed to path.
+	OnChange func(output, path string)
+}
+
+func NewRotation(s *WallpaperService, opts RotationOptions) *Rotation {
+	return &Rotation{service: s, opts: opts, Clock: SystemClock}
+}
+
+// Playlist returns the playlist called name, with the defaults of the
+// rotation filled in.
+func (r *Rotation) Playlist(name string) (Playlist, error) {
+	p := Playlist{Name: name}
+	if name != LibraryPlaylist {
+		var ok bool
+		if p, ok = r.opts.Playlists[name]; !ok {
+			return Playlist{}, fmt.Errorf("unknown playlist %q", name)
+		}
+		p.Name = name
+	}
+	if p.Order == "" {
+		p.Order = cmp.Or(r.opts.Order, OrderSequential)
+	}
+	if p.Interval <= 0 {
+		p.Interval = cmp.Or(r.opts.Interval, DefaultRotationInterval)
+	}
+	return p, nil
+}
+
+// Targets returns the playlist of each output the rotation changes, keyed
+// like State.Outputs. Outputs with a playlist of their own that are not
+// connected are left out, unless the backend cannot list its outputs.
+func (r *Rotation) Targets() (map[string]string, error) {
+	if len(r.opts.Outputs) == 0 {
+		return map[string]string{allOutputsKey: r.opts.Playlist}, nil
+	}
+
+	backend := r.service.Backend
+	if backend == nil {
+		return nil, ErrNoBackend
+	}
+	if !backend.Capabilities().MultiOutput {
+		return nil, errPerOutputUnsupported(backend)
+	}
+
+	outputs, err := r.service.Outputs()
+	if err != nil {
+		targets := make(map[string]string, len(r.opts.Outputs))
+		for output, playlist := range r.opts.Outputs {
+			targets[output] = playlist
+		}
+		return targets, nil
+	}
+
+	targets := make(map[string]string, len(outputs))
+	for _, output := range outputs {
+		playlist, ok := r.opts.Outputs[output.Name]
+		if !ok {
+			playlist = r.opts.Playlist
+		}
+		targets[output.Name] = playlist
+	}
+	return targets, nil
+}
+
+// update applies change to the rotation state and saves it if change
+// reports that it changed anything. The state is read, changed and saved
+// holding a lock on it, so that a process running the rotation and another
+// pausing or skipping it wait for each other instead of overwriting what the
+// other saved.
+func (r *Rotation) update(change func(state *RotationState, targets map[string]string, now time.Time) (bool, error)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return withLock(RotationPath()+".lock", func() error {
+		state, err := LoadRotationState()
+		if err != nil {
+			return err
+		}
+		targets, err := r.Targets()
+		if err != nil {
+			return err
+		}
+
+		changed, err := change(state, targets, r.Clock.Now())
+		if changed {
+			err = errors.Join(err, state.Save())
+		}
+		return err
+	})
+}
+
+// Step changes the wallpaper of every output whose turn has come, unless the
+// rotation is paused, and returns when the next change is due, or the zero
+// time when there is none. Outputs that failed to change are left out of it.
+func (r *Rotation) Step(ctx context.Context) (time.Time, error) {
+	var next time.Time
+	err := r.update(func(state *RotationState, targets map[string]string, now time.Time) (bool, error) {
+		if state.Paused {
+			return false, nil
+		}
+
+		changed := false
+		var errs []error
+		for _, key := range sortedKeys(targets) {
+			pos := state.position(key, targets[key])
+			if !now.Before(pos.NextAt) {
+				if err := r.advance(ctx, key, pos, now); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				changed = true
+			}
+			if next.IsZero() || pos.NextAt.Before(next) {
+				next = pos.NextAt
+			}
+		}
+		return changed, errors.Join(errs...)
+	})
+	return next, err
+}
+
+// Skip changes the wallpaper of output, or of every output when it is
+// empty, to the next one of its playlist right away, even while paused, and
+// restarts its interval.
+func (r *Rotation) Skip(ctx context.Context, output string) error {
+	return r.update(func(state *RotationState, targets map[string]string, now time.Time) (bool, error) {
+		if output != "" {
+			if _, ok := targets[output]; !ok {
+				return false, fmt.Errorf("%s: %w", output, ErrNotRotated)
+			}
+		}
+
+		changed := false
+		var errs []error
+		for _, key := range sortedKeys(targets) {
+			if output != "" && key != output {
+				continue
+			}
+			if err := r.advance(ctx, key, state.position(key, targets[key]), now); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			changed = true
+		}
+		return changed, errors.Join(errs...)
+	})
+}
+
+// Pause stops the rotation until Resume.
+func (r *Rotation) Pause() error {
+	return r.update(func(state *RotationState, _ map[string]string, now time.Time) (bool, error) {
+		if state.Paused {
+			return false, nil
+		}
+		state.Paused, state.PausedAt = true, now
+		return true, nil
+	})
+}
+
+// Resume restarts the rotation after Pause, with as much time left until
+// each change as there was when it was paused.
+func (r *Rotation) Resume() error {
+	return r.update(func(state *RotationState, _ map[string]string, now time.Time) (bool, error) {
+		if !state.Paused {
+			return false, nil
+		}
+		for _, pos := range state.Outputs {
+			if !pos.NextAt.IsZero() && !state.PausedAt.IsZero() {
+				pos.NextAt = pos.NextAt.Add(now.Sub(state.PausedAt))
+			}
+		}
+		state.Paused, state.PausedAt = false, time.Time{}
+		return true, nil
+	})
+}
+
+// RotationStatus is what the rotation of each output is doing. Running
+// reports whether a process is running the rotation.
+type RotationStatus struct {
+	Paused  bool             `json:"paused"`
+	Running bool             `json:"running"`
+	Outputs []OutputRotation `json:"outputs"`
+}
+
+// OutputRotation is the rotation of one output, "" for every output. NextAt
+// is zero before the first change.
+type OutputRotation struct {
+	Output   string    `json:"output"`
+	Playlist string    `json:"playlist"`
+	Current  string    `json:"current,omitempty"`
+	NextAt   time.Time `json:"next_at,omitzero"`
+}
+
+func (r *Rotation) Status() (RotationStatus, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state, err := LoadRotationState()
+	if err != nil {
+		return RotationStatus{}, err
+	}
+	targets, err := r.Targets()
+	if err != nil {
+		return RotationStatus{}, err
+	}
+
+	status := RotationStatus{Paused: state.Paused, Running: RotationRunning()}
+	for _, key := range sortedKeys(targets) {
+		rotation := OutputRotation{Output: key, Playlist: targets[key]}
+		if key == allOutputsKey {
+			rotation.Output = ""
+		}
+		if pos := state.Outputs[key]; pos != nil && pos.Playlist == targets[key] {
+			rotation.Current, rotation.NextAt = pos.Current, pos.NextAt
+			if state.Paused && !pos.NextAt.IsZero() {
+				rotation.NextAt = pos.NextAt.Add(r.Clock.Now().Sub(state.PausedAt))
+			}
+		}
+		status.Outputs = append(status.Outputs, rotation)
+	}
+	return status, nil
+}
+
+// advance applies the next wallpaper of pos's playlist to output key and
+// moves pos to it.
+func (r *Rotation) advance(ctx context.Context, key string, pos *RotationPosition, now time.Time) error {
+	p, err := r.Playlist(pos.Playlist)
+	if err != nil {
+		return err
+	}
+	paths, err := r.service.PlaylistWallpapers(ctx, p)
+	if err != nil {
+		return err
+	}
+	next, queue, err := r.pick(p, pos, paths)
+	if err != nil {
+		return err
+	}
+
+	output := key
+	if key == allOutputsKey {
+		output = ""
+	}
+	if err := r.service.ApplyWallpaper(output, next, r.service.DefaultTransition); err != nil {
+		return err
+	}
+
+	pos.Current, pos.Queue, pos.NextAt = next, queue, now.Add(p.Interval)
+	if r.OnChange != nil {
+		r.OnChange(output, next)
+	}
+	return nil
+}
+
+// pick chooses the wallpaper after pos among paths according to the order of
+// p, returning the queue of a shuffled playlist without it.
+func (r *Rotation) pick(p Playlist, pos *RotationPosition, paths []string) (string, []string, error) {
+	switch p.Order {
+	case OrderShuffle:
+		// Wallpapers that left the playlist during the round are dropped,
+		// and new ones wait for the next round.
+		queue := slices.DeleteFunc(slices.Clone(pos.Queue), func(path string) bool {
+			return !slices.Contains(paths, path)
+		})
+		if len(queue) == 0 {
+			queue = slices.Clone(paths)
+			rand.Shuffle(len(queue), func(i, j int) { queue[i], queue[j] = queue[j], queue[i] })
+			// A round does not start with the wallpaper that ended the
+			// previous one.
+			if len(queue) > 1 && queue[0] == pos.Current {
+				queue[0], queue[len(queue)-1] = queue[len(queue)-1], queue[0]
+			}
+		}
+		return queue[0], queue[1:], nil
+
+	case OrderWeighted:
+		annotations, err := r.service.Annotations()
+		if err != nil {
+			return "", nil, err
+		}
+		weights := make([]float64, len(paths))
+		for i, path := range paths {
+			if len(paths) == 1 || path != pos.Current {
+				weights[i] = annotations.Get(path).weight()
+			}
+		}
+		return paths[weightedIndex(weights)], nil, nil
+
+	default:
+		i := slices.Index(paths, pos.Current)
+		return paths[(i+1)%len(paths)], nil, nil
+	}
+}
+
+// Run rotates the wallpapers until ctx is done. Only one process can run the
+// rotation at a time; others get ErrRotationRunning. Failures to change a
+// wallpaper are passed to onError and retried after a while rather than
+// ending the rotation. Pause, Resume and Skip take effect as soon as they
+// are saved, from whichever process.
+func (r *Rotation) Run(ctx context.Context, onError func(error)) error {
+	lock, err := lockFile(rotationLockPath(), ErrRotationRunning)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(RotationPath())); err != nil {
+		return err
+	}
+
+	for {
+		next, err := r.Step(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		now := r.Clock.Now()
+		wait := rotationMaxWait
+		if !next.IsZero() {
+			wait = min(wait, next.Sub(now))
+		}
+		if err != nil {
+			onError(err)
+			wait = min(wait, rotationRetryDelay)
+		}
+		timer := r.Clock.After(max(wait, 0))
+
+	waiting:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-timer:
+				break waiting
+			case event := <-watcher.Events:
+				if event.Name == RotationPath() {
+					break waiting
+				}
+			case err := <-watcher.Errors:
+				onError(err)
+			}
+		}
+	}
+}
+
+// RotationRunning reports whether a process is running the rotation.
+func RotationRunning() bool {
+	return locked(rotationLockPath())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRotationPauseDuringStep pauses the rotation from another process while
+// the one running it is changing the wallpaper, which must not undo the pause
+// when it saves its position.
+func TestRotationPauseDuringStep(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, a, red)
+	writePNG(t, b, green)
+
+	opts := RotationOptions{
+		Playlist:  "both",
+		Playlists: map[string]Playlist{"both": {Paths: []string{a, b}}},
+	}
+	newRotation := func() *Rotation {
+		s := &WallpaperService{Backend: newFakeBackend(), HistorySize: DefaultHistorySize}
+		return NewRotation(s, opts)
+	}
+
+	running := newRotation()
+	changing, release := make(chan struct{}), make(chan struct{})
+	running.OnChange = func(string, string) {
+		close(changing)
+		<-release
+	}
+	stepped := make(chan error)
+	go func() {
+		_, err := running.Step(context.Background())
+		stepped <- err
+	}()
+	<-changing
+
+	paused := make(chan error, 1)
+	go func() { paused <- newRotation().Pause() }()
+	select {
+	case err := <-paused:
+		paused <- err
+		t.Error("Pause returned while the rotation was saving its position")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stepped; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-paused; err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadRotationState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Paused {
+		t.Error("the pause was lost")
+	}
+	if pos := state.Outputs[allOutputsKey]; pos == nil || pos.Current != a {
+		t.Errorf("the rotation position is %+v, want %s as current", pos, a)
+	}
+}
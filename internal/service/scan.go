@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// ScanOptions controls how each library root is walked. The zero value
+// walks the whole tree without following symlinks or listing hidden files.
+type ScanOptions struct {
+	// MaxDepth is how many directory levels are read, counting the root
+	// itself; 1 reads only the top level and 0 has no limit.
+	MaxDepth int
+	// FollowSymlinks descends into symlinked directories, except links
+	// back to a directory being walked, which would loop. Symlinked files
+	// are always listed.
+	FollowSymlinks bool
+	// IncludeHidden lists files and enters directories whose names start
+	// with a dot.
+	IncludeHidden bool
+	// Exclude holds gitignore-style patterns, see ExcludeMatcher.
+	Exclude []string
+	// Workers bounds how many directories are read at once, including
+	// opening their files to detect the image format; 0 picks a default
+	// based on the number of CPUs.
+	Workers int
+}
+
+type fileID struct {
+	dev, ino uint64
+}
+
+type directoryScanner struct {
+	ctx     context.Context
+	opts    ScanOptions
+	exclude *ExcludeMatcher
+	sem     chan struct{}
+	wg      sync.WaitGroup
+
+	// known holds the indexed entries of the files below the root. Files
+	// that changed since are read again and end up in fresh; seen lists
+	// every file found.
+	known map[string]*IndexEntry
+
+	mutex      sync.Mutex
+	wallpapers []model.Wallpaper
+	fresh      map[string]*IndexEntry
+	seen       []string
+	dirs       []string
+	rootErr    error
+}
+
+// ScanDirectory lists the wallpapers below root according to opts, sorted by
+// their path relative to root. Files are recognised by their content, and
+// files named like images are listed even when they cannot be decoded, with
+// the reason in Unsupported. Directories are read concurrently. Unreadable
+// subdirectories are skipped; an unreadable root is an error. When ctx is
+// cancelled the walk stops and ctx's error is returned.
+func ScanDirectory(ctx context.Context, root string, opts ScanOptions) ([]model.Wallpaper, error) {
+	sc, err := scanDirectory(ctx, root, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sc.wallpapers, nil
+}
+
+// scanDirectory is ScanDirectory reusing the entries in known for files that
+// have not changed.
+func scanDirectory(ctx context.Context, root string, opts ScanOptions, known map[string]*IndexEntry) (*directoryScanner, error) {
+	return scanSubdirectory(ctx, root, "", opts, known)
+}
+
+// scanSubdirectory is scanDirectory for the directory dir at rel below its
+// root, applying opts as a scan of the whole root would.
+func scanSubdirectory(ctx context.Context, dir, rel string, opts ScanOptions, known map[string]*IndexEntry) (*directoryScanner, error) {
+	exclude, err := NewExcludeMatcher(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = max(4, runtime.NumCPU())
+	}
+
+	sc := &directoryScanner{
+		ctx:     ctx,
+		opts:    opts,
+		exclude: exclude,
+		sem:     make(chan struct{}, workers),
+		known:   known,
+		fresh:   make(map[string]*IndexEntry),
+	}
+
+	var ancestors []fileID
+	if id, ok := sc.directoryID(dir); ok {
+		ancestors = append(ancestors, id)
+	}
+
+	sc.wg.Add(1)
+	sc.walk(dir, rel, ancestors)
+	sc.wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if sc.rootErr != nil {
+		return nil, sc.rootErr
+	}
+
+	sortWallpapers(sc.wallpapers)
+	return sc, nil
+}
+
+// sortWallpapers orders wallpapers of one root by folder, then name.
+func sortWallpapers(wallpapers []model.Wallpaper) {
+	sort.Slice(wallpapers, func(i, j int) bool {
+		a, b := wallpapers[i], wallpapers[j]
+		if a.Dir != b.Dir {
+			return a.Dir < b.Dir
+		}
+		return a.Name < b.Name
+	})
+}
+
+// walk lists dir, whose path relative to the root is rel. ancestors holds the
+// identity of dir and every directory above it when following symlinks.
+func (sc *directoryScanner) walk(dir, rel string, ancestors []fileID) {
+	defer sc.wg.Done()
+
+	select {
+	case sc.sem <- struct{}{}:
+	case <-sc.ctx.Done():
+		return
+	}
+	defer func() { <-sc.sem }()
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		if rel == "" {
+			sc.rootErr = err
+		}
+		return
+	}
+
+	var found []model.Wallpaper
+	var seen []string
+	fresh := make(map[string]*IndexEntry)
+	for _, entry := range entries {
+		if sc.ctx.Err() != nil {
+			return
+		}
+
+		name := entry.Name()
+		if !sc.opts.IncludeHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		full := filepath.Join(dir, name)
+		isDir := entry.IsDir()
+		var info fs.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			var err error
+			if info, err = os.Stat(full); err != nil {
+				continue
+			}
+			if info.IsDir() && !sc.opts.FollowSymlinks {
+				continue
+			}
+			isDir = info.IsDir()
+		}
+
+		relPath := path.Join(rel, name)
+		if sc.exclude.Match(relPath, isDir) {
+			continue
+		}
+
+		if isDir {
+			depth := strings.Count(relPath, "/") + 1
+			if sc.opts.MaxDepth > 0 && depth >= sc.opts.MaxDepth {
+				continue
+			}
+
+			childAncestors := ancestors
+			if sc.opts.FollowSymlinks {
+				id, ok := sc.directoryID(full)
+				if !ok || slices.Contains(ancestors, id) {
+					continue
+				}
+				childAncestors = append(slices.Clip(ancestors), id)
+			}
+
+			sc.wg.Add(1)
+			go sc.walk(full, relPath, childAncestors)
+			continue
+		}
+
+		if info == nil {
+			var err error
+			if info, err = entry.Info(); err != nil {
+				continue
+			}
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		seen = append(seen, full)
+		indexed, ok := sc.known[full]
+		if !ok || !indexed.matches(info.Size(), info.ModTime()) || indexed.outdated() {
+			var readable bool
+			indexed, readable = inspectFile(full, info)
+			if readable {
+				fresh[full] = indexed
+			}
+		}
+		if !indexed.Ignored {
+			found = append(found, indexed.wallpaper(full, "", rel))
+		}
+	}
+
+	sc.mutex.Lock()
+	sc.wallpapers = append(sc.wallpapers, found...)
+	sc.seen = append(sc.seen, seen...)
+	sc.dirs = append(sc.dirs, dir)
+	maps.Copy(sc.fresh, fresh)
+	sc.mutex.Unlock()
+}
+
+// directoryID identifies dir by device and inode, so a symlink leading back
+// to one of its own ancestors can be recognised as a loop. Loops are only
+// possible through symlinks, so nothing is tracked without FollowSymlinks.
+func (sc *directoryScanner) directoryID(dir string) (fileID, bool) {
+	if !sc.opts.FollowSymlinks {
+		return fileID{}, false
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fileID{}, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: stat.Ino}, true
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SunEvent is sunrise or sunset, which a ScheduleTime can be relative to.
+type SunEvent string
+
+const (
+	Sunrise SunEvent = "sunrise"
+	Sunset  SunEvent = "sunset"
+)
+
+// ScheduleTime is a time of day: Offset after midnight on the clock, or
+// Offset from sunrise or sunset when Sun is set.
+type ScheduleTime struct {
+	Sun    SunEvent
+	Offset time.Duration
+}
+
+// ParseScheduleTime parses a time on the clock such as "07:30", or one
+// relative to the sun such as "sunrise", "sunset-30m" or "sunrise+1h15m".
+func ParseScheduleTime(s string) (ScheduleTime, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	for _, event := range []SunEvent{Sunrise, Sunset} {
+		rest, ok := strings.CutPrefix(text, string(event))
+		if !ok {
+			continue
+		}
+		if rest == "" {
+			return ScheduleTime{Sun: event}, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			break
+		}
+		offset, err := time.ParseDuration(rest)
+		if err != nil {
+			return ScheduleTime{}, fmt.Errorf("schedule time %q: %w", s, err)
+		}
+		return ScheduleTime{Sun: event, Offset: offset}, nil
+	}
+
+	clock, err := time.Parse("15:04", text)
+	if err != nil {
+		return ScheduleTime{}, fmt.Errorf("schedule time %q: expected HH:MM, sunrise or sunset with an optional offset such as sunset-30m", s)
+	}
+	return ScheduleTime{Offset: time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute}, nil
+}
+
+func (t ScheduleTime) String() string {
+	if t.Sun == "" {
+		return fmt.Sprintf("%02d:%02d", int(t.Offset.Hours()), int(t.Offset.Minutes())%60)
+	}
+	switch {
+	case t.Offset > 0:
+		return fmt.Sprintf("%s+%s", t.Sun, t.Offset)
+	case t.Offset < 0:
+		return fmt.Sprintf("%s%s", t.Sun, t.Offset)
+	}
+	return string(t.Sun)
+}
+
+// weekdays are the names ParseWeekday accepts, by their first three
+// letters.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWeekday parses a day of the week such as "mon" or "Monday".
+func ParseWeekday(s string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if len(name) >= 3 {
+		if day, ok := weekdays[name[:3]]; ok && strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day of the week %q", s)
+}
+
+// ScheduleRule shows Path on Output, every output when empty, from At on the
+// days in Days, or every day when there are none. Transition defaults to
+// the default transition.
+type ScheduleRule struct {
+	At         ScheduleTime
+	Days       []time.Weekday
+	Path       string
+	Output     string
+	Transition TransitionType
+}
+
+// DynamicWallpaper spreads Images, or the images in Folder sorted by name,
+// over the day in order: evenly from midnight, or with Sun the first half
+// from sunrise to sunset and the rest from sunset to the next sunrise, so
+// they follow the light. Transition defaults to a fade, so the changes are
+// smooth.
+type DynamicWallpaper struct {
+	Images     []string
+	Folder     string
+	Sun        bool
+	Output     string
+	Transition TransitionType
+}
+
+// Schedule switches wallpapers at times of day. Sunrise and sunset are
+// computed for Latitude and Longitude, and days and times on the clock are
+// in Location, the local time zone when nil.
+type Schedule struct {
+	Rules     []ScheduleRule
+	Dynamic   []DynamicWallpaper
+	Latitude  float64
+	Longitude float64
+	Location  *time.Location
+}
+
+// ScheduledChange is the wallpaper the schedule shows on Output, every
+// output when empty, from At.
+type ScheduledChange struct {
+	At         time.Time      `json:"at"`
+	Output     string         `json:"output"`
+	Path       string         `json:"path"`
+	Transition TransitionType `json:"transition,omitempty"`
+}
+
+// scheduleLookback is how many days before a time changes are looked for,
+// enough for rules on one day of the week.
+const scheduleLookback = 8
+
+// ReadFolders lists the images in the folders of the dynamic wallpapers.
+func (s *Schedule) ReadFolders(ctx context.Context, opts ScanOptions) error {
+	opts.MaxDepth = 1
+	for i := range s.Dynamic {
+		d := &s.Dynamic[i]
+		if d.Folder == "" {
+			continue
+		}
+		scan, err := ScanLibrary(ctx, NewLibraryRoots(d.Folder), opts, nil)
+		if err != nil {
+			return err
+		}
+		d.Images = nil
+		for _, wp := range scan.Wallpapers {
+			if wp.Unsupported == "" {
+				d.Images = append(d.Images, wp.Path)
+			}
+		}
+		if len(d.Images) == 0 {
+			return fmt.Errorf("dynamic wallpaper %s: %w", d.Folder, ErrNoWallpapers)
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the schedule has neither rules nor dynamic
+// wallpapers.
+func (s *Schedule) Empty() bool {
+	return len(s.Rules) == 0 && len(s.Dynamic) == 0
+}
+
+func (s *Schedule) location() *time.Location {
+	if s.Location == nil {
+		return time.Local
+	}
+	return s.Location
+}
+
+// midnight returns the start of the calendar day of t.
+func (s *Schedule) midnight(t time.Time) time.Time {
+	t = t.In(s.location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location())
+}
+
+// SunTimes returns when the sun rises and sets on the day of t, see SunTimes.
+func (s *Schedule) SunTimes(t time.Time) (sunrise, sunset time.Time, up, ok bool) {
+	return SunTimes(s.midnight(t), s.Latitude, s.Longitude)
+}
+
+// timeOn returns when t is on the calendar day starting at midnight, or
+// false if the sun does not rise or set that day.
+func (s *Schedule) timeOn(t ScheduleTime, midnight time.Time) (time.Time, bool) {
+	if t.Sun == "" {
+		// Set on the clock rather than added to midnight, so that 07:00
+		// stays 07:00 on the days daylight saving time starts or ends.
+		hours, minutes := int(t.Offset/time.Hour), int(t.Offset%time.Hour/time.Minute)
+		return time.Date(midnight.Year(), midnight.Month(), midnight.Day(), hours, minutes, 0, 0, midnight.Location()), true
+	}
+
+	sunrise, sunset, _, ok := s.SunTimes(midnight)
+	if !ok {
+		return time.Time{}, false
+	}
+	if t.Sun == Sunrise {
+		return sunrise.Add(t.Offset), true
+	}
+	return sunset.Add(t.Offset), true
+}
+
+// changesOn returns the changes of the calendar day starting at midnight,
+// in order. The night images of dynamic wallpapers following the sun may
+// fall on the next day.
+func (s *Schedule) changesOn(midnight time.Time) []ScheduledChange {
+	var changes []ScheduledChange
+	for _, rule := range s.Rules {
+		if len(rule.Days) > 0 && !slices.Contains(rule.Days, midnight.Weekday()) {
+			continue
+		}
+		if at, ok := s.timeOn(rule.At, midnight); ok {
+			changes = append(changes, ScheduledChange{At: at, Output: rule.Output, Path: rule.Path, Transition: rule.Transition})
+		}
+	}
+	for _, d := range s.Dynamic {
+		changes = append(changes, s.dynamicChanges(d, midnight)...)
+	}
+
+	slices.SortStableFunc(changes, func(a, b ScheduledChange) int {
+		return a.At.Compare(b.At)
+	})
+	return changes
+}
+
+// dynamicChanges spreads the images of d over the day starting at midnight.
+// On days without sunrise or sunset, the day or night images are spread
+// over the whole day.
+func (s *Schedule) dynamicChanges(d DynamicWallpaper, midnight time.Time) []ScheduledChange {
+	transition := d.Transition
+	if transition == "" {
+		transition = TransitionFade
+	}
+	spread := func(images []string, from, to time.Time) []ScheduledChange {
+		changes := make([]ScheduledChange, len(images))
+		for i, path := range images {
+			at := from.Add(to.Sub(from) * time.Duration(i) / time.Duration(len(images)))
+			changes[i] = ScheduledChange{At: at, Output: d.Output, Path: path, Transition: transition}
+		}
+		return changes
+	}
+
+	nextMidnight := s.midnight(midnight.Add(36 * time.Hour))
+	if !d.Sun || len(d.Images) < 2 {
+		return spread(d.Images, midnight, nextMidnight)
+	}
+
+	dayImages, nightImages := d.Images[:(len(d.Images)+1)/2], d.Images[(len(d.Images)+1)/2:]
+	sunrise, sunset, up, ok := s.SunTimes(midnight)
+	if !ok {
+		if up {
+			return spread(dayImages, midnight, nextMidnight)
+		}
+		return spread(nightImages, midnight, nextMidnight)
+	}
+	nextSunrise, _, _, ok := s.SunTimes(nextMidnight)
+	if !ok {
+		nextSunrise = sunrise.Add(24 * time.Hour)
+	}
+	return append(spread(dayImages, sunrise, sunset), spread(nightImages, sunset, nextSunrise)...)
+}
+
+// Active returns the change in effect at t on each output it was made for,
+// keyed like ScheduleRule.Output.
+func (s *Schedule) Active(t time.Time) map[string]ScheduledChange {
+	active := make(map[string]ScheduledChange)
+	today := s.midnight(t)
+	for days := -scheduleLookback; days <= 0; days++ {
+		for _, change := range s.changesOn(today.AddDate(0, 0, days)) {
+			if change.At.After(t) {
+				continue
+			}
+			if previous, ok := active[change.Output]; !ok || !change.At.Before(previous.At) {
+				active[change.Output] = change
+			}
+		}
+	}
+	return active
+}
+
+// ActiveOn returns the change in effect at t on output, the latest of those
+// made for it and for every output, or false if there is none.
+func (s *Schedule) ActiveOn(t time.Time, output string) (ScheduledChange, bool) {
+	active := s.Active(t)
+	change, ok := active[output]
+	if all, allOK := active[""]; allOK && (!ok || all.At.After(change.At)) {
+		return all, true
+	}
+	return change, ok
+}
+
+// Next returns the first change after t, or false if there is none within
+// a week.
+func (s *Schedule) Next(t time.Time) (ScheduledChange, bool) {
+	var next ScheduledChange
+	found := false
+	today := s.midnight(t)
+	// The night of a dynamic wallpaper following the sun starts the day
+	// before.
+	for days := -1; days <= scheduleLookback; days++ {
+		midnight := today.AddDate(0, 0, days)
+		if found && midnight.After(next.At) {
+			break
+		}
+		for _, change := range s.changesOn(midnight) {
+			if change.At.After(t) && (!found || change.At.Before(next.At)) {
+				next, found = change, true
+			}
+		}
+	}
+	return next, found
+}
+
+// Timeline returns the change in effect on output at the start of each
+// hour of the day of t, with a zero Path for hours without any.
+func (s *Schedule) Timeline(t time.Time, output string) []ScheduledChange {
+	midnight := s.midnight(t)
+	timeline := make([]ScheduledChange, 24)
+	for hour := range timeline {
+		at := time.Date(midnight.Year(), midnight.Month(), midnight.Day(), hour, 0, 0, 0, midnight.Location())
+		timeline[hour], _ = s.ActiveOn(at, output)
+	}
+	return timeline
+}
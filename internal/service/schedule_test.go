@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves on Advance. Every wait started
+// with After is reported on waits.
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	waits  chan time.Duration
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waits: make(chan time.Duration)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	timer := fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	c.mutex.Unlock()
+
+	c.waits <- d
+	return timer.c
+}
+
+// Advance moves the clock forward by d, firing the waits that are over.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+	c.timers = slices.DeleteFunc(c.timers, func(timer fakeTimer) bool {
+		if timer.at.After(c.now) {
+			return false
+		}
+		timer.c <- c.now
+		return true
+	})
+}
+
+// utc returns the time of day hour:minute on the date, in UTC.
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func mustScheduleTime(t *testing.T, s string) ScheduleTime {
+	t.Helper()
+	st, err := ParseScheduleTime(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestParseScheduleTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ScheduleTime
+		err  bool
+	}{
+		{in: "07:30", want: ScheduleTime{Offset: 7*time.Hour + 30*time.Minute}},
+		{in: " 23:05 ", want: ScheduleTime{Offset: 23*time.Hour + 5*time.Minute}},
+		{in: "sunrise", want: ScheduleTime{Sun: Sunrise}},
+		{in: "Sunset-30m", want: ScheduleTime{Sun: Sunset, Offset: -30 * time.Minute}},
+		{in: "sunrise+1h15m", want: ScheduleTime{Sun: Sunrise, Offset: 75 * time.Minute}},
+		{in: "24:00", err: true},
+		{in: "sunset30m", err: true},
+		{in: "sunrise+soon", err: true},
+		{in: "noon", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseScheduleTime(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseScheduleTime(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseScheduleTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+		if again, err := ParseScheduleTime(got.String()); err != nil || again != got {
+			t.Errorf("%v does not read back from %q", got, got.String())
+		}
+	}
+}
+
+func TestScheduleActiveAndNext(t *testing.T) {
+	schedule := &Schedule{
+		Location: time.UTC,
+		Rules: []ScheduleRule{
+			{At: mustScheduleTime(t, "07:00"), Path: "day.png"},
+			{At: mustScheduleTime(t, "19:00"), Path: "night.png"},
+			{At: mustScheduleTime(t, "09:00"), Days: []time.Weekday{time.Saturday}, Path: "weekend.png", Output: "DP-1"},
+		},
+	}
+
+	// 2026-03-06 is a Friday.
+	tests := []struct {
+		now      time.Time
+		active   string
+		activeDP string
+		next     time.Time
+		nextPath string
+	}{
+		{now: utc(2026, 3, 6, 6, 59), active: "night.png", activeDP: "night.png", next: utc(2026, 3, 6, 7, 0), nextPath: "day.png"},
+		{now: utc(2026, 3, 6, 7, 0), active: "day.png", activeDP: "day.png", next: utc(2026, 3, 6, 19, 0), nextPath: "night.png"},
+		{now: utc(2026, 3, 7, 8, 0), active: "day.png", activeDP: "day.png", next: utc(2026, 3, 7, 9, 0), nextPath: "weekend.png"},
+		{now: utc(2026, 3, 7, 12, 0), active: "day.png", activeDP: "weekend.png", next: utc(2026, 3, 7, 19, 0), nextPath: "night.png"},
+		{now: utc(2026, 3, 7, 20, 0), active: "night.png", activeDP: "night.png", next: utc(2026, 3, 8, 7, 0), nextPath: "day.png"},
+	}
+	for _, tt := range tests {
+		if got, ok := schedule.ActiveOn(tt.now, ""); !ok || got.Path != tt.active {
+			t.Errorf("at %v every output shows %q, want %q", tt.now, got.Path, tt.active)
+		}
+		if got, ok := schedule.ActiveOn(tt.now, "DP-1"); !ok || got.Path != tt.activeDP {
+			t.Errorf("at %v DP-1 shows %q, want %q", tt.now, got.Path, tt.activeDP)
+		}
+		next, ok := schedule.Next(tt.now)
+		if !ok || !next.At.Equal(tt.next) || next.Path != tt.nextPath {
+			t.Errorf("after %v the next change is %v to %q, want %v to %q", tt.now, next.At, next.Path, tt.next, tt.nextPath)
+		}
+	}
+
+	if _, ok := (&Schedule{}).Next(utc(2026, 3, 6, 0, 0)); ok {
+		t.Error("an empty schedule has a next change")
+	}
+}
+
+func TestScheduleTimeline(t *testing.T) {
+	schedule := &Schedule{
+		Location: time.UTC,
+		Dynamic:  []DynamicWallpaper{{Images: []string{"0.png", "1.png", "2.png", "3.png"}}},
+	}
+
+	timeline := schedule.Timeline(utc(2026, 3, 6, 15, 30), "")
+	if len(timeline) != 24 {
+		t.Fatalf("the timeline has %d hours, want 24", len(timeline))
+	}
+	for hour, change := range timeline {
+		want := []string{"0.png", "1.png", "2.png", "3.png"}[hour/6]
+		if change.Path != want || change.Transition != TransitionFade {
+			t.Errorf("at %02d:00 the timeline shows %q with %q, want %q with a fade", hour, change.Path, change.Transition, want)
+		}
+	}
+
+	if timeline := (&Schedule{Location: time.UTC}).Timeline(utc(2026, 3, 6, 0, 0), ""); timeline[12].Path != "" {
+		t.Errorf("an empty schedule shows %q at noon", timeline[12].Path)
+	}
+}
+
+func TestScheduleSun(t *testing.T) {
+	// Berlin on the summer solstice: sunrise at 04:43 and sunset at 21:33
+	// in summer time.
+	cest := time.FixedZone("CEST", 2*60*60)
+	schedule := &Schedule{Latitude: 52.52, Longitude: 13.405, Location: cest}
+	day := time.Date(2026, 6, 21, 12, 0, 0, 0, cest)
+
+	sunrise, sunset, _, ok := schedule.SunTimes(day)
+	if !ok {
+		t.Fatal("the sun does not rise in Berlin in June")
+	}
+	near := func(got time.Time, hour, minute int) bool {
+		want := time.Date(2026, 6, 21, hour, minute, 0, 0, cest)
+		return got.Sub(want).Abs() <= 3*time.Minute
+	}
+	if !near(sunrise, 4, 43) || !near(sunset, 21, 33) {
+		t.Errorf("the sun rises at %v and sets at %v, want about 04:43 and 21:33", sunrise, sunset)
+	}
+
+	schedule.Rules = []ScheduleRule{{At: mustScheduleTime(t, "sunset-30m"), Path: "evening.png"}}
+	if next, ok := schedule.Next(day); !ok || !next.At.Equal(sunset.Add(-30*time.Minute)) {
+		t.Errorf("the next change is at %v, want 30 minutes before sunset at %v", next.At, sunset)
+	}
+
+	// Day images are spread from sunrise to sunset, night images until the
+	// next sunrise.
+	schedule.Rules = nil
+	schedule.Dynamic = []DynamicWallpaper{{Images: []string{"morning.png", "afternoon.png", "evening.png", "night.png"}, Sun: true}}
+	for _, tt := range []struct {
+		hour int
+		want string
+	}{{3, "night.png"}, {6, "morning.png"}, {15, "afternoon.png"}, {22, "evening.png"}} {
+		now := time.Date(2026, 6, 21, tt.hour, 0, 0, 0, cest)
+		if got, _ := schedule.ActiveOn(now, ""); got.Path != tt.want {
+			t.Errorf("at %02d:00 the dynamic wallpaper shows %q, want %q", tt.hour, got.Path, tt.want)
+		}
+	}
+
+	// The sun does not set in the far north in June: the day images take
+	// the whole day.
+	schedule.Latitude = 80
+	if _, _, up, ok := schedule.SunTimes(day); ok || !up {
+		t.Errorf("the sun sets at latitude 80 in June")
+	}
+	if got, _ := schedule.ActiveOn(day, ""); got.Path != "afternoon.png" {
+		t.Errorf("at noon under the midnight sun the dynamic wallpaper shows %q, want afternoon.png", got.Path)
+	}
+}
+
+func TestSchedulerApply(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	day, night, side := filepath.Join(dir, "day.png"), filepath.Join(dir, "night.png"), filepath.Join(dir, "side.png")
+	writePNG(t, day, yellow)
+	writePNG(t, night, blue)
+	writePNG(t, side, green)
+
+	backend := newFakeBackend(Output{Name: "DP-1"}, Output{Name: "HDMI-1"})
+	s := &WallpaperService{Backend: backend, HistorySize: DefaultHistorySize}
+	schedule := &Schedule{
+		Location: time.UTC,
+		Rules: []ScheduleRule{
+			{At: mustScheduleTime(t, "07:00"), Path: day},
+			{At: mustScheduleTime(t, "12:00"), Path: side, Output: "DP-1"},
+			{At: mustScheduleTime(t, "19:00"), Path: night},
+		},
+	}
+	clock := newFakeClock(utc(2026, 3, 6, 8, 0))
+	scheduler := NewScheduler(s, schedule)
+	scheduler.Clock = clock
+
+	var changes []string
+	scheduler.OnChange = func(output, path string) { changes = append(changes, output+"="+filepath.Base(path)) }
+
+	applied := make(map[string]string)
+	steps := []struct {
+		at   time.Time
+		want []string
+	}{
+		{at: utc(2026, 3, 6, 8, 0), want: []string{"=day.png"}},
+		// Nothing changed since.
+		{at: utc(2026, 3, 6, 9, 0), want: nil},
+		// A single output changes after the wallpaper for every output.
+		{at: utc(2026, 3, 6, 12, 0), want: []string{"DP-1=side.png"}},
+		{at: utc(2026, 3, 6, 19, 30), want: []string{"=night.png"}},
+		// The next day, the wallpaper for every output came last.
+		{at: utc(2026, 3, 7, 8, 0), want: []string{"=day.png"}},
+	}
+	for _, step := range steps {
+		clock.Advance(step.at.Sub(clock.Now()))
+		changes = nil
+		if err := scheduler.Apply(applied); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(changes, step.want) {
+			t.Errorf("at %v the scheduler changed %q, want %q", step.at, changes, step.want)
+		}
+	}
+	if !slices.Equal(backend.take(), []string{"=" + day, "DP-1=" + side, "=" + night, "=" + day}) {
+		t.Error("the backend was not asked to show the scheduled wallpapers")
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	day, night := filepath.Join(dir, "day.png"), filepath.Join(dir, "night.png")
+	writePNG(t, day, yellow)
+	writePNG(t, night, blue)
+
+	backend := newFakeBackend(Output{Name: "DP-1"})
+	s := &WallpaperService{Backend: backend, HistorySize: DefaultHistorySize}
+	schedule := &Schedule{
+		Location: time.UTC,
+		Rules: []ScheduleRule{
+			{At: mustScheduleTime(t, "07:00"), Path: day},
+			{At: mustScheduleTime(t, "19:00"), Path: night},
+		},
+	}
+	clock := newFakeClock(utc(2026, 3, 6, 6, 59).Add(30 * time.Second))
+	scheduler := NewScheduler(s, schedule)
+	scheduler.Clock = clock
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- scheduler.Run(ctx, func(err error) { t.Error(err) })
+	}()
+
+	// What is in effect is shown right away, then the scheduler sleeps
+	// until the next change.
+	if wait := <-clock.waits; wait != 30*time.Second {
+		t.Errorf("the scheduler waits %v for the change at 07:00, want 30s", wait)
+	}
+	if got := backend.take(); !slices.Equal(got, []string{"=" + night}) {
+		t.Errorf("on start the scheduler showed %q, want the night wallpaper", got)
+	}
+	if !ScheduleRunning() {
+		t.Error("the schedule is not reported as running")
+	}
+	if err := NewScheduler(s, schedule).Run(ctx, nil); !errors.Is(err, ErrScheduleRunning) {
+		t.Errorf("a second scheduler returned %v, want ErrScheduleRunning", err)
+	}
+
+	clock.Advance(30 * time.Second)
+	if wait := <-clock.waits; wait != schedulerMaxWait {
+		t.Errorf("the scheduler waits %v, want at most %v", wait, schedulerMaxWait)
+	}
+	if got := backend.take(); !slices.Equal(got, []string{"=" + day}) {
+		t.Errorf("at 07:00 the scheduler showed %q, want the day wallpaper", got)
+	}
+
+	// Waking up without a change due shows nothing new.
+	clock.Advance(schedulerMaxWait)
+	<-clock.waits
+	if got := backend.take(); len(got) != 0 {
+		t.Errorf("the scheduler showed %q with no change due", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := NewScheduler(s, &Schedule{}).Run(context.Background(), nil); !errors.Is(err, ErrEmptySchedule) {
+		t.Errorf("running an empty schedule returned %v, want ErrEmptySchedule", err)
+	}
+}
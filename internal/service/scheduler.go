@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// ErrScheduleRunning is returned by Scheduler.Run when another process runs
+// the schedule.
+var ErrScheduleRunning = errors.New("the schedule is already running")
+
+// ErrEmptySchedule is returned by Scheduler.Run when the schedule has
+// nothing to switch to.
+var ErrEmptySchedule = errors.New("the schedule has no rules or dynamic wallpapers")
+
+// schedulerMaxWait bounds how long the scheduler sleeps before looking at
+// the clock again, like rotationMaxWait.
+const schedulerMaxWait = time.Minute
+
+func scheduleLockPath() string {
+	return filepath.Join(filepath.Dir(StatePath()), "schedule.lock")
+}
+
+// ScheduleRunning reports whether a process is running the schedule.
+func ScheduleRunning() bool {
+	return locked(scheduleLockPath())
+}
+
+// Scheduler applies the wallpapers of a Schedule as they change.
+type Scheduler struct {
+	service  *WallpaperService
+	schedule *Schedule
+
+	// Clock tells the time, SystemClock unless replaced.
+	Clock Clock
+	// OnChange is called after the wallpaper of output, "" for every
+	// output, was changed to path.
+	OnChange func(output, path string)
+}
+
+func NewScheduler(s *WallpaperService, schedule *Schedule) *Scheduler {
+	return &Scheduler{service: s, schedule: schedule, Clock: SystemClock}
+}
+
+// Apply shows what the schedule has in effect now on every output, except
+// where applied says it is already shown, and updates applied, which is
+// keyed like ScheduleRule.Output. A wallpaper for every output replaces
+// those of single outputs made before it.
+func (s *Scheduler) Apply(applied map[string]string) error {
+	active := s.schedule.Active(s.Clock.Now())
+	all, hasAll := active[""]
+
+	var errs []error
+	apply := func(change ScheduledChange) {
+		transition := s.service.DefaultTransition
+		if change.Transition != "" {
+			transition = transition.WithType(change.Transition)
+		}
+		if err := s.service.ApplyWallpaper(change.Output, change.Path, transition); err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if change.Output == "" {
+			clear(applied)
+		}
+		applied[change.Output] = change.Path
+		if s.OnChange != nil {
+			s.OnChange(change.Output, change.Path)
+		}
+	}
+
+	if hasAll && applied[""] != all.Path {
+		apply(all)
+	}
+	for _, output := range sortedKeys(active) {
+		change := active[output]
+		if output == "" || hasAll && all.At.After(change.At) || applied[output] == change.Path {
+			continue
+		}
+		apply(change)
+	}
+	return errors.Join(errs...)
+}
+
+// Run applies the schedule until ctx is done, starting with what is in
+// effect now, so the wallpapers are right after logging in. Only one process
+// can run the schedule at a time; others get ErrScheduleRunning. Failures to
+// change a wallpaper are passed to onError and retried at the next check.
+func (s *Scheduler) Run(ctx context.Context, onError func(error)) error {
+	if s.schedule.Empty() {
+		return ErrEmptySchedule
+	}
+	lock, err := lockFile(scheduleLockPath(), ErrScheduleRunning)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	applied := make(map[string]string)
+	if current, err := s.service.CurrentWallpapers(); err == nil {
+		for output, path := range current {
+			applied[output] = path
+		}
+	}
+
+	for {
+		if err := s.Apply(applied); err != nil {
+			onError(err)
+		}
+
+		now := s.Clock.Now()
+		wait := schedulerMaxWait
+		if next, ok := s.schedule.Next(now); ok {
+			wait = min(wait, next.At.Sub(now))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.Clock.After(max(wait, 0)):
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+var (
+	ErrNoWallpapers = errors.New("no wallpapers found")
+	ErrNoFavorites  = errors.New("no favorite wallpapers found")
+	ErrNoTagMatches = errors.New("no wallpapers match the tag query")
+)
+
+// RandomOptions narrows down the wallpapers RandomWallpaper picks from.
+type RandomOptions struct {
+	// Exclude is skipped when there is another choice, usually the
+	// wallpaper on screen.
+	Exclude string
+	// FavoritesOnly picks among the favorites.
+	FavoritesOnly bool
+	// Tags picks among the wallpapers whose tags match, if set.
+	Tags *TagQuery
+}
+
+// CurrentWallpapers reports what each output is showing according to the
+// backend, falling back to the persisted state when the backend cannot tell.
+// Outputs showing a slice of a spanned image report the image itself.
+func (s *WallpaperService) CurrentWallpapers() (map[string]string, error) {
+	if s.Backend != nil {
+		if current, err := s.Backend.Current(); err == nil && len(current) > 0 {
+			return spanSources(current), nil
+		}
+	}
+	active, err := LoadActiveWallpapers()
+	if err != nil {
+		return nil, err
+	}
+	return ActivePaths(active), nil
+}
+
+// RandomWallpaper picks a wallpaper according to opts, skipping images that
+// cannot be decoded. Wallpapers with more stars are picked more often, and
+// favorites twice as often as their stars alone would make them.
+func (s *WallpaperService) RandomWallpaper(opts RandomOptions) (*model.Wallpaper, error) {
+	wallpapers, err := s.selectableWallpapers()
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := s.Annotations()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []model.Wallpaper
+	var weights []float64
+	for _, wp := range wallpapers {
+		annotation := annotations.Get(wp.Path)
+		if opts.FavoritesOnly && !annotation.Favorite || !opts.Tags.Match(wp.Tags) {
+			continue
+		}
+		candidates = append(candidates, wp)
+		weights = append(weights, annotation.weight())
+	}
+	if len(candidates) == 0 {
+		if opts.Tags != nil {
+			return nil, ErrNoTagMatches
+		}
+		return nil, ErrNoFavorites
+	}
+
+	// Only leave out the excluded wallpaper if something else remains.
+	if len(candidates) > 1 {
+		for i, wp := range candidates {
+			if wp.Path == opts.Exclude {
+				weights[i] = 0
+			}
+		}
+	}
+	return &candidates[weightedIndex(weights)], nil
+}
+
+// weightedIndex picks an index of weights with a probability proportional to
+// its weight. At least one weight must be positive.
+func weightedIndex(weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	target := rand.Float64() * total
+	last := 0
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		if target < w {
+			return i
+		}
+		target -= w
+		last = i
+	}
+	return last
+}
+
+// AdjacentWallpaper returns the wallpaper delta positions away from current,
+// wrapping around like the list navigation in the GUI and skipping images
+// that cannot be decoded. If current is not among them, the first (or last,
+// for a negative delta) wallpaper is used.
+func (s *WallpaperService) AdjacentWallpaper(current string, delta int) (*model.Wallpaper, error) {
+	wallpapers, err := s.selectableWallpapers()
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, wp := range wallpapers {
+		if wp.Path == current {
+			index = i
+			break
+		}
+	}
+
+	var next int
+	switch {
+	case index >= 0:
+		next = ((index+delta)%len(wallpapers) + len(wallpapers)) % len(wallpapers)
+	case delta < 0:
+		next = len(wallpapers) - 1
+	}
+	return &wallpapers[next], nil
+}
+
+// selectableWallpapers lists the library without the images that cannot be
+// decoded, which are never picked automatically.
+func (s *WallpaperService) selectableWallpapers() ([]model.Wallpaper, error) {
+	wallpapers, err := s.GetWallpapers()
+	if err != nil {
+		return nil, err
+	}
+
+	selectable := wallpapers[:0]
+	for _, wp := range wallpapers {
+		if wp.Unsupported == "" {
+			selectable = append(selectable, wp)
+		}
+	}
+	if len(selectable) == 0 {
+		return nil, ErrNoWallpapers
+	}
+	return selectable, nil
+}
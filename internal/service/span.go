@@ -0,0 +1,283 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// spanCacheEntries is how many spanned images and layouts keep their slices
+// cached, the most recently used ones, so going back and forth between a few
+// does not render them again but a rotation does not fill the cache.
+const spanCacheEntries = 4
+
+// LogicalSize returns the output's size in compositor layout coordinates:
+// rotated by Transform and divided by Scale.
+func (o Output) LogicalSize() (int, int) {
+	width, height := o.Width, o.Height
+	if o.Transform%2 == 1 {
+		width, height = height, width
+	}
+
+	scale := o.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	return int(math.Round(float64(width) / scale)), int(math.Round(float64(height) / scale))
+}
+
+// SpanSlice is the part of a spanned image shown on one output.
+type SpanSlice struct {
+	Output string
+	Image  image.Image
+}
+
+// SliceSpan fills the bounding box of all outputs with src and cuts it into
+// one image per output. The box is rendered at the highest output scale and
+// each slice is resized to its output's rotated pixel size, so mixed-DPI
+// setups stay sharp and every slice lines up with its physical position.
+func SliceSpan(src image.Image, outputs []Output) ([]SpanSlice, error) {
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no outputs to span")
+	}
+
+	minX, minY := math.MaxInt, math.MaxInt
+	maxX, maxY := math.MinInt, math.MinInt
+	maxScale := 1.0
+	for _, o := range outputs {
+		width, height := o.LogicalSize()
+		if width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("output %s has no size", o.Name)
+		}
+		minX, minY = min(minX, o.X), min(minY, o.Y)
+		maxX, maxY = max(maxX, o.X+width), max(maxY, o.Y+height)
+		maxScale = max(maxScale, o.Scale)
+	}
+
+	canvasWidth := int(math.Round(float64(maxX-minX) * maxScale))
+	canvasHeight := int(math.Round(float64(maxY-minY) * maxScale))
+	canvas := imaging.Fill(src, canvasWidth, canvasHeight, imaging.Center, imaging.Lanczos)
+
+	slices := make([]SpanSlice, 0, len(outputs))
+	for _, o := range outputs {
+		width, height := o.LogicalSize()
+		rect := image.Rect(
+			int(math.Round(float64(o.X-minX)*maxScale)),
+			int(math.Round(float64(o.Y-minY)*maxScale)),
+			int(math.Round(float64(o.X-minX+width)*maxScale)),
+			int(math.Round(float64(o.Y-minY+height)*maxScale)),
+		)
+
+		scale := o.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+		pixelWidth := int(math.Round(float64(width) * scale))
+		pixelHeight := int(math.Round(float64(height) * scale))
+
+		slice := imaging.Crop(canvas, rect)
+		if slice.Bounds().Dx() != pixelWidth || slice.Bounds().Dy() != pixelHeight {
+			slice = imaging.Resize(slice, pixelWidth, pixelHeight, imaging.Lanczos)
+		}
+		slices = append(slices, SpanSlice{Output: o.Name, Image: slice})
+	}
+	return slices, nil
+}
+
+// SpanWallpaper slices path across every output according to their layout
+// and applies each piece to its output with DefaultTransition.
+func (s *WallpaperService) SpanWallpaper(path string) error {
+	return s.SpanWallpaperWithTransition(path, s.DefaultTransition)
+}
+
+// SpanWallpaperWithTransition is SpanWallpaper with an explicit transition,
+// resolved once so every output animates the same way. The source image is
+// recorded as the wallpaper of every output with Span set, and restoring it
+// slices it again for the outputs present then.
+func (s *WallpaperService) SpanWallpaperWithTransition(path string, transition TransitionOptions) error {
+	if err := transition.Validate(); err != nil {
+		return err
+	}
+	transition = transition.Resolve()
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := s.applySpan(absPath, transition); err != nil {
+		return err
+	}
+
+	wp := s.activeWallpaper(absPath, transition)
+	wp.Span = true
+	active := map[string]ActiveWallpaper{"": wp}
+	previous, err := updateActiveWallpapers(func(map[string]ActiveWallpaper) map[string]ActiveWallpaper {
+		return active
+	})
+	if err != nil {
+		return err
+	}
+	return s.recordHistory(active, previous)
+}
+
+// applySpan applies a slice of path to every output. Slices are cached on
+// disk per image and layout, so re-applying a spanned wallpaper does not
+// re-render it.
+func (s *WallpaperService) applySpan(path string, transition TransitionOptions) error {
+	if s.Backend == nil {
+		return ErrNoBackend
+	}
+	if !s.Backend.Capabilities().MultiOutput {
+		return errPerOutputUnsupported(s.Backend)
+	}
+
+	outputs, err := s.Backend.Outputs()
+	if err != nil {
+		return err
+	}
+
+	slicePaths, err := spanSlicePaths(path, outputs)
+	if err != nil {
+		return err
+	}
+	for _, o := range outputs {
+		if err := s.apply(o.Name, slicePaths[o.Name], transition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spanSources replaces the slices in current, as reported by a backend,
+// with the spanned image they were cut from.
+func spanSources(current map[string]string) map[string]string {
+	active, err := LoadActiveWallpapers()
+	if err != nil || !active[""].Span {
+		return current
+	}
+
+	root := spanCacheRoot()
+	for output, path := range current {
+		if root != "" && strings.HasPrefix(path, root+string(filepath.Separator)) {
+			current[output] = active[""].Path
+		}
+	}
+	return current
+}
+
+// spanSlicePaths returns the cached slice for every output, rendering and
+// writing them first if the cache is missing any.
+func spanSlicePaths(path string, outputs []Output) (map[string]string, error) {
+	dir, err := spanCacheDir(path, outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string, len(outputs))
+	complete := true
+	for _, o := range outputs {
+		paths[o.Name] = filepath.Join(dir, o.Name+".png")
+		if _, err := os.Stat(paths[o.Name]); err != nil {
+			complete = false
+		}
+	}
+	if complete {
+		pruneSpanCache(dir)
+		return paths, nil
+	}
+
+	src, err := imaging.Open(path, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	slices, err := SliceSpan(src, outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for _, slice := range slices {
+		if err := imaging.Save(slice.Image, paths[slice.Output]); err != nil {
+			return nil, err
+		}
+	}
+	pruneSpanCache(dir)
+	return paths, nil
+}
+
+// pruneSpanCache marks the slices in dir as just used and removes the least
+// recently used ones beyond spanCacheEntries.
+func pruneSpanCache(dir string) {
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if err != nil {
+		return
+	}
+	type cached struct {
+		path string
+		used time.Time
+	}
+	var others []cached
+	for _, entry := range entries {
+		path := filepath.Join(filepath.Dir(dir), entry.Name())
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() || path == dir {
+			continue
+		}
+		others = append(others, cached{path: path, used: info.ModTime()})
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].used.After(others[j].used)
+	})
+	for _, old := range others[min(len(others), spanCacheEntries-1):] {
+		_ = os.RemoveAll(old.path)
+	}
+}
+
+// spanCacheDir keys the cache on the source file's identity and the output
+// layout, so editing the image or rearranging monitors renders new slices.
+func spanCacheDir(path string, outputs []Output) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	cacheRoot := spanCacheRoot()
+	if cacheRoot == "" {
+		return "", fmt.Errorf("no cache directory for span slices")
+	}
+
+	layout := make([]string, 0, len(outputs))
+	for _, o := range outputs {
+		layout = append(layout, fmt.Sprintf("%s:%d,%d:%dx%d@%g/%d", o.Name, o.X, o.Y, o.Width, o.Height, o.Scale, o.Transform))
+	}
+	sort.Strings(layout)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%d\n%s", path, info.Size(), info.ModTime().UnixNano(), strings.Join(layout, ";"))
+	return filepath.Join(cacheRoot, hex.EncodeToString(h.Sum(nil))[:32]), nil
+}
+
+// spanCacheRoot returns the directory holding the slices of every spanned
+// image, or "" if there is no cache directory.
+func spanCacheRoot() string {
+	cacheRoot, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheRoot, "wallpaper-manager", "span")
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBackend is a multi-output backend that records what it was asked to
+// show on which output.
+type fakeBackend struct {
+	mutex   sync.Mutex
+	outputs []Output
+	current map[string]string
+	applied []string
+}
+
+func newFakeBackend(outputs ...Output) *fakeBackend {
+	return &fakeBackend{outputs: outputs, current: make(map[string]string)}
+}
+
+func (b *fakeBackend) Name() string               { return "fake" }
+func (b *fakeBackend) Available() bool            { return true }
+func (b *fakeBackend) Capabilities() Capabilities { return Capabilities{MultiOutput: true} }
+func (b *fakeBackend) Outputs() ([]Output, error) { return b.outputs, nil }
+
+func (b *fakeBackend) Apply(output, path string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.applied = append(b.applied, output+"="+path)
+	if output == "" {
+		clear(b.current)
+		for _, o := range b.outputs {
+			b.current[o.Name] = path
+		}
+	} else {
+		b.current[output] = path
+	}
+	return nil
+}
+
+func (b *fakeBackend) Current() (map[string]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	current := make(map[string]string, len(b.current))
+	for output, path := range b.current {
+		current[output] = path
+	}
+	return current, nil
+}
+
+// take returns the applies since the last call.
+func (b *fakeBackend) take() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	applied := b.applied
+	b.applied = nil
+	return applied
+}
+
+// useStateDirs points the state and cache directories into the test's
+// temporary directory.
+func useStateDirs(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+}
+
+// quadrants returns an image whose top left, top right, bottom left and
+// bottom right quarters have the given colours.
+func quadrants(width, height int, colors [4]color.Color) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			i := 0
+			if x >= width/2 {
+				i++
+			}
+			if y >= height/2 {
+				i += 2
+			}
+			img.Set(x, y, colors[i])
+		}
+	}
+	return img
+}
+
+var (
+	red    = color.NRGBA{R: 0xff, A: 0xff}
+	green  = color.NRGBA{G: 0xff, A: 0xff}
+	blue   = color.NRGBA{B: 0xff, A: 0xff}
+	yellow = color.NRGBA{R: 0xff, G: 0xff, A: 0xff}
+)
+
+// colorAt returns the colour of img at the fractions fx, fy of its size.
+func colorAt(img image.Image, fx, fy float64) color.NRGBA {
+	b := img.Bounds()
+	x := b.Min.X + int(fx*float64(b.Dx()))
+	y := b.Min.Y + int(fy*float64(b.Dy()))
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
+
+func TestSliceSpan(t *testing.T) {
+	type probe struct {
+		fx, fy float64
+		want   color.NRGBA
+	}
+	tests := []struct {
+		name    string
+		outputs []Output
+		// size is the pixel size of each slice.
+		size   map[string]image.Point
+		probes map[string][]probe
+	}{
+		{
+			name: "side by side",
+			outputs: []Output{
+				{Name: "DP-1", Width: 192, Height: 108, Scale: 1},
+				{Name: "DP-2", X: 192, Width: 192, Height: 108, Scale: 1},
+			},
+			size: map[string]image.Point{"DP-1": {192, 108}, "DP-2": {192, 108}},
+			probes: map[string][]probe{
+				"DP-1": {{0.9, 0.1, red}, {0.9, 0.9, blue}},
+				"DP-2": {{0.1, 0.1, green}, {0.1, 0.9, yellow}},
+			},
+		},
+		{
+			name: "stacked",
+			outputs: []Output{
+				{Name: "top", Width: 192, Height: 108, Scale: 1},
+				{Name: "bottom", Y: 108, Width: 192, Height: 108, Scale: 1},
+			},
+			size: map[string]image.Point{"top": {192, 108}, "bottom": {192, 108}},
+			probes: map[string][]probe{
+				"top":    {{0.1, 0.9, red}, {0.9, 0.9, green}},
+				"bottom": {{0.1, 0.1, blue}, {0.9, 0.1, yellow}},
+			},
+		},
+		{
+			name: "mixed DPI",
+			outputs: []Output{
+				// A 2x laptop panel left of a 1x monitor of the same
+				// logical size.
+				{Name: "eDP-1", Width: 256, Height: 144, Scale: 2},
+				{Name: "HDMI-A-1", X: 128, Width: 128, Height: 72, Scale: 1},
+			},
+			size: map[string]image.Point{"eDP-1": {256, 144}, "HDMI-A-1": {128, 72}},
+			probes: map[string][]probe{
+				"eDP-1":    {{0.95, 0.05, red}, {0.95, 0.95, blue}},
+				"HDMI-A-1": {{0.05, 0.05, green}, {0.05, 0.95, yellow}},
+			},
+		},
+		{
+			name: "rotated",
+			outputs: []Output{
+				{Name: "DP-1", Width: 192, Height: 108, Scale: 1, Transform: 1},
+				{Name: "DP-2", X: 108, Width: 108, Height: 192, Scale: 1},
+			},
+			size: map[string]image.Point{"DP-1": {108, 192}, "DP-2": {108, 192}},
+			probes: map[string][]probe{
+				"DP-1": {{0.9, 0.1, red}, {0.9, 0.9, blue}},
+				"DP-2": {{0.1, 0.1, green}, {0.1, 0.9, yellow}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Sized like the bounding box, so filling it crops nothing.
+			maxX, maxY := 0, 0
+			for _, o := range tt.outputs {
+				width, height := o.LogicalSize()
+				maxX, maxY = max(maxX, o.X+width), max(maxY, o.Y+height)
+			}
+			src := quadrants(maxX, maxY, [4]color.Color{red, green, blue, yellow})
+
+			slices, err := SliceSpan(src, tt.outputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(slices) != len(tt.outputs) {
+				t.Fatalf("got %d slices, want %d", len(slices), len(tt.outputs))
+			}
+			for _, slice := range slices {
+				if got := slice.Image.Bounds().Size(); got != tt.size[slice.Output] {
+					t.Errorf("%s: size = %v, want %v", slice.Output, got, tt.size[slice.Output])
+				}
+				for _, p := range tt.probes[slice.Output] {
+					if got := colorAt(slice.Image, p.fx, p.fy); got != p.want {
+						t.Errorf("%s: colour at %g,%g = %v, want %v", slice.Output, p.fx, p.fy, got, p.want)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := SliceSpan(quadrants(4, 4, [4]color.Color{red, green, blue, yellow}), nil); err == nil {
+		t.Error("SliceSpan() without outputs succeeded")
+	}
+}
+
+func TestSpanWallpaper(t *testing.T) {
+	useStateDirs(t)
+	backend := newFakeBackend(
+		Output{Name: "DP-1", Width: 192, Height: 108, Scale: 1},
+		Output{Name: "DP-2", X: 192, Width: 192, Height: 108, Scale: 1},
+	)
+	s := &WallpaperService{Backend: backend, HistorySize: DefaultHistorySize}
+	path := writeHalves(t, "panorama.png", 384, 108, red, green)
+
+	if err := s.SpanWallpaper(path); err != nil {
+		t.Fatal(err)
+	}
+	applied := backend.take()
+	if len(applied) != 2 {
+		t.Fatalf("applied = %q, want one slice per output", applied)
+	}
+	for _, a := range applied {
+		if !strings.HasPrefix(a, "DP-") || !strings.Contains(a, filepath.Join("wallpaper-manager", "span")) {
+			t.Errorf("applied %q, want a cached slice on one output", a)
+		}
+	}
+
+	// State, history and current wallpapers name the image, not its slices.
+	active, err := LoadActiveWallpapers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[""].Path != path || !active[""].Span {
+		t.Errorf("state = %+v, want %s spanned", active, path)
+	}
+	history, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recent := history.Recent(0); len(recent) != 1 || recent[0].Path != path || !recent[0].Span {
+		t.Errorf("history = %+v, want %s spanned", recent, path)
+	}
+	current, err := s.CurrentWallpapers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"DP-1": path, "DP-2": path}; !reflect.DeepEqual(current, want) {
+		t.Errorf("CurrentWallpapers() = %v, want %v", current, want)
+	}
+
+	// Restoring after the layout changed slices the image for the new one.
+	backend.outputs = append(backend.outputs, Output{Name: "DP-3", X: 384, Width: 192, Height: 108, Scale: 1})
+	restored, err := s.RestoreWallpapers(RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"": path}; !reflect.DeepEqual(restored, want) {
+		t.Errorf("RestoreWallpapers() = %v, want %v", restored, want)
+	}
+	applied = backend.take()
+	if len(applied) != 3 || !strings.HasPrefix(applied[2], "DP-3=") {
+		t.Errorf("applied = %q, want a slice on each of the three outputs", applied)
+	}
+
+	// Undo goes back to the plain wallpaper and redo slices again.
+	plain := writeHalves(t, "plain.png", 64, 48, blue, blue)
+	if err := s.SetWallpaper(plain); err != nil {
+		t.Fatal(err)
+	}
+	backend.take()
+	if _, err := s.Undo(""); err != nil {
+		t.Fatal(err)
+	}
+	if applied := backend.take(); len(applied) != 3 {
+		t.Errorf("undo applied %q, want the spanned slices", applied)
+	}
+	if active, _ := LoadActiveWallpapers(); active[""].Path != path || !active[""].Span {
+		t.Errorf("state after undo = %+v, want %s spanned", active, path)
+	}
+}
+
+// TestSpanCachePruned spans more images than the cache keeps, which must
+// leave only the most recent slices.
+func TestSpanCachePruned(t *testing.T) {
+	useStateDirs(t)
+	outputs := []Output{
+		{Name: "DP-1", Width: 8, Height: 4, Scale: 1},
+		{Name: "DP-2", X: 8, Width: 8, Height: 4, Scale: 1},
+	}
+	var last string
+	for i := range spanCacheEntries + 2 {
+		path := writeHalves(t, fmt.Sprintf("%d.png", i), 16, 4, red, green)
+		paths, err := spanSlicePaths(path, outputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = filepath.Dir(paths["DP-1"])
+	}
+
+	entries, err := os.ReadDir(spanCacheRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != spanCacheEntries {
+		t.Errorf("the cache has %d entries, want %d", len(entries), spanCacheEntries)
+	}
+	if _, err := os.Stat(last); err != nil {
+		t.Errorf("the slices just rendered were pruned: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// julianUnixEpoch is the Julian date of the Unix epoch, and julian2000
+	// that of noon on 1 January 2000, the epoch of the formulas below.
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+	// sunAltitude is the altitude of the centre of the sun at sunrise and
+	// sunset, accounting for atmospheric refraction and the sun's radius.
+	sunAltitude = -0.833
+	// earthTilt is the obliquity of the ecliptic.
+	earthTilt = 23.4397
+)
+
+// SunTimes returns when the sun rises and sets on the calendar day of day,
+// in its location, at latitude and longitude in degrees (north and east are
+// positive). It follows the sunrise equation, which is accurate to about a
+// minute away from the poles. ok is false when the sun does not rise or set
+// that day, during polar night or midnight sun; up tells which.
+func SunTimes(day time.Time, latitude, longitude float64) (sunrise, sunset time.Time, up, ok bool) {
+	// The solar noon nearest to noon on the clock.
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location())
+	n := math.Round(julianDate(noon) - julian2000 + longitude/360)
+
+	meanSolarNoon := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarNoon, 360)
+	center := 1.9148*sinDeg(anomaly) + 0.0200*sinDeg(2*anomaly) + 0.0003*sinDeg(3*anomaly)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + meanSolarNoon + 0.0053*sinDeg(anomaly) - 0.0069*sinDeg(2*eclipticLongitude)
+
+	sinDeclination := sinDeg(eclipticLongitude) * sinDeg(earthTilt)
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+	cosHourAngle := (sinDeg(sunAltitude) - sinDeg(latitude)*sinDeclination) / (cosDeg(latitude) * cosDeclination)
+	switch {
+	case cosHourAngle > 1:
+		return time.Time{}, time.Time{}, false, false
+	case cosHourAngle < -1:
+		return time.Time{}, time.Time{}, true, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	sunrise = fromJulianDate(transit - hourAngle/360).Round(time.Second).In(day.Location())
+	sunset = fromJulianDate(transit + hourAngle/360).Round(time.Second).In(day.Location())
+	return sunrise, sunset, true, true
+}
+
+func julianDate(t time.Time) float64 {
+	return float64(t.UnixMilli())/(24*60*60*1000) + julianUnixEpoch
+}
+
+func fromJulianDate(j float64) time.Time {
+	return time.UnixMilli(int64(math.Round((j - julianUnixEpoch) * 24 * 60 * 60 * 1000)))
+}
+
+func sinDeg(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+func cosDeg(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type SwwwBackend struct {
+	Binary string
+}
+
+func NewSwwwBackend() *SwwwBackend {
+	return &SwwwBackend{Binary: "swww"}
+}
+
+func (b *SwwwBackend) Name() string {
+	return "swww"
+}
+
+func (b *SwwwBackend) Available() bool {
+	return commandExists(b.Binary)
+}
+
+// Ready checks that swww-daemon answers queries.
+func (b *SwwwBackend) Ready() error {
+	_, err := b.query()
+	return err
+}
+
+func (b *SwwwBackend) Capabilities() Capabilities {
+	return Capabilities{Transitions: true, MultiOutput: true}
+}
+
+// Outputs prefers the compositor's view, which includes positions, and falls
+// back to the names and sizes reported by `swww query`.
+func (b *SwwwBackend) Outputs() ([]Output, error) {
+	if outputs, err := DetectOutputs(); err == nil {
+		return outputs, nil
+	}
+
+	lines, err := b.query()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]Output, 0, len(lines))
+	for _, l := range lines {
+		outputs = append(outputs, Output{Name: l.output, Width: l.width, Height: l.height, Scale: l.scale})
+	}
+	return outputs, nil
+}
+
+func (b *SwwwBackend) Apply(output, path string) error {
+	return b.ApplyTransition(output, path, DefaultTransition())
+}
+
+func (b *SwwwBackend) ApplyTransition(output, path string, transition TransitionOptions) error {
+	if err := runCommand(b.Binary, "clear-cache"); err != nil {
+		return err
+	}
+
+	args := append([]string{"img", path}, transition.Args()...)
+	if output != "" {
+		args = append(args, "--outputs", output)
+	}
+	return runCommand(b.Binary, args...)
+}
+
+func (b *SwwwBackend) Current() (map[string]string, error) {
+	lines, err := b.query()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string)
+	for _, l := range lines {
+		if l.image != "" {
+			current[l.output] = l.image
+		}
+	}
+	return current, nil
+}
+
+type swwwQueryLine struct {
+	output string
+	width  int
+	height int
+	scale  float64
+	image  string
+}
+
+// query parses `swww query`, whose lines look like
+// "DP-1: 1920x1080, scale: 1, currently displaying: image: /path/to.png".
+// Newer releases prefix each line with ": ".
+func (b *SwwwBackend) query() ([]swwwQueryLine, error) {
+	out, err := commandOutput(b.Binary, "query")
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []swwwQueryLine
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), ": ")
+		output, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		l := swwwQueryLine{output: strings.TrimSpace(output), scale: 1}
+		fields := strings.Split(rest, ",")
+		if len(fields) > 0 {
+			fmt.Sscanf(strings.TrimSpace(fields[0]), "%dx%d", &l.width, &l.height)
+		}
+		for _, field := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(field), "scale: "); ok {
+				if scale, err := strconv.ParseFloat(value, 64); err == nil {
+					l.scale = scale
+				}
+			}
+		}
+		if _, image, ok := strings.Cut(rest, "image: "); ok {
+			l.image = strings.TrimSpace(image)
+		}
+		lines = append(lines, l)
+	}
+	return lines, scanner.Err()
+}
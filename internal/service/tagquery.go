@@ -0,0 +1,191 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TagQuery is a boolean expression over tags, such as
+// "dark AND NOT (anime OR people)". NOT binds tighter than AND, which binds
+// tighter than OR, and tags next to each other without an operator must all
+// be present. Operators are case-insensitive, and tags are compared after
+// NormalizeTag. A nil TagQuery matches every wallpaper.
+type TagQuery struct {
+	text string
+	expr tagExpr
+}
+
+type tagExpr interface {
+	match(tags map[string]bool) bool
+}
+
+type (
+	tagTerm string
+	tagNot  struct{ expr tagExpr }
+	tagAnd  []tagExpr
+	tagOr   []tagExpr
+)
+
+func (t tagTerm) match(tags map[string]bool) bool {
+	return tags[string(t)]
+}
+
+func (n tagNot) match(tags map[string]bool) bool {
+	return !n.expr.match(tags)
+}
+
+func (a tagAnd) match(tags map[string]bool) bool {
+	for _, expr := range a {
+		if !expr.match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o tagOr) match(tags map[string]bool) bool {
+	for _, expr := range o {
+		if expr.match(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTagQuery parses query, returning nil for a blank query.
+func ParseTagQuery(query string) (*TagQuery, error) {
+	p := &tagParser{tokens: tokenizeTagQuery(query)}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+
+	expr, err := p.or()
+	if err == nil && p.peek() != "" {
+		err = fmt.Errorf("unexpected %q", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tag query: %w", err)
+	}
+	return &TagQuery{text: strings.TrimSpace(query), expr: expr}, nil
+}
+
+// Match reports whether tags satisfy q.
+func (q *TagQuery) Match(tags []string) bool {
+	if q == nil {
+		return true
+	}
+	set := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	return q.expr.match(set)
+}
+
+func (q *TagQuery) String() string {
+	if q == nil {
+		return ""
+	}
+	return q.text
+}
+
+// tokenizeTagQuery splits query into words and parentheses.
+func tokenizeTagQuery(query string) []string {
+	query = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(query)
+	return strings.Fields(query)
+}
+
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *tagParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tagParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func isTagOperator(token string) bool {
+	return strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR") || strings.EqualFold(token, "NOT")
+}
+
+func (p *tagParser) or() (tagExpr, error) {
+	var terms tagOr
+	for {
+		term, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !strings.EqualFold(p.peek(), "OR") {
+			break
+		}
+		p.next()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *tagParser) and() (tagExpr, error) {
+	var terms tagAnd
+	for {
+		term, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+
+		next := p.peek()
+		if strings.EqualFold(next, "AND") {
+			p.next()
+		} else if next == "" || next == ")" || strings.EqualFold(next, "OR") {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *tagParser) not() (tagExpr, error) {
+	if !strings.EqualFold(p.peek(), "NOT") {
+		return p.primary()
+	}
+	p.next()
+	expr, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	return tagNot{expr}, nil
+}
+
+func (p *tagParser) primary() (tagExpr, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, errors.New("expected a tag at the end")
+	case token == "(":
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New(`missing ")"`)
+		}
+		return expr, nil
+	case token == ")" || isTagOperator(token):
+		return nil, fmt.Errorf("expected a tag before %q", token)
+	}
+	return tagTerm(NormalizeTag(token)), nil
+}
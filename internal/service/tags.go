@@ -0,0 +1,56 @@
+package service
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// NormalizeTag lowercases tag and joins its words with dashes, so "Night Sky"
+// becomes "night-sky". Parentheses are dropped, since they group tag queries.
+func NormalizeTag(tag string) string {
+	tag = strings.Map(func(r rune) rune {
+		if r == '(' || r == ')' {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, tag)
+	return strings.Join(strings.Fields(tag), "-")
+}
+
+// NormalizeTags normalizes every tag, dropping empty ones and duplicates, and
+// sorts them.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// SetTags replaces the tags of the wallpaper at path and returns them as
+// stored, normalized with NormalizeTags. Tags are kept with the annotations,
+// so they follow the image when it is moved.
+func (s *WallpaperService) SetTags(path string, tags []string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := s.Annotations()
+	if err != nil {
+		return nil, err
+	}
+
+	tags = NormalizeTags(tags)
+	wp := model.Wallpaper{Path: path, Size: info.Size()}
+	if err := annotations.Update(wp, func(annotation *Annotation) { annotation.Tags = tags }); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
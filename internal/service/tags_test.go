@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writePNG writes a small PNG of a single colour to path.
+func writePNG(t *testing.T, path string, c color.Color) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for y := range 3 {
+		for x := range 4 {
+			img.Set(x, y, c)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// scannedTags scans the library of s and returns the tags of every wallpaper
+// found, keyed by name.
+func scannedTags(t *testing.T, s *WallpaperService) map[string][]string {
+	t.Helper()
+	scan, err := s.ScanLibrary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string][]string)
+	for _, wp := range scan.Wallpapers {
+		tags[wp.Name] = wp.Tags
+	}
+	return tags
+}
+
+func TestTagsSurviveScans(t *testing.T) {
+	useStateDirs(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.png"), filepath.Join(dir, "b.png")
+	writePNG(t, a, red)
+	writePNG(t, b, green)
+
+	newService := func() *WallpaperService {
+		return &WallpaperService{Roots: NewLibraryRoots(dir), Index: NewIndex(IndexPath())}
+	}
+	s := newService()
+	if _, err := s.SetTags(a, []string{"Night Sky"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetTags(b, []string{"forest"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A scan that excludes a file must not forget its tags.
+	s.Scan.Exclude = []string{"b.png"}
+	if tags := scannedTags(t, s); !slices.Equal(tags["a.png"], []string{"night-sky"}) {
+		t.Errorf("a.png has tags %q, want night-sky", tags["a.png"])
+	}
+	s.Scan.Exclude = nil
+	if tags := scannedTags(t, s); !slices.Equal(tags["b.png"], []string{"forest"}) {
+		t.Errorf("b.png has tags %q after being excluded, want forest", tags["b.png"])
+	}
+
+	// Tags are not in the cache.
+	if err := os.Remove(IndexPath()); err != nil {
+		t.Fatal(err)
+	}
+	// A file moved while the app is closed keeps its tags.
+	moved := filepath.Join(dir, "sub", "c.png")
+	if err := os.MkdirAll(filepath.Dir(moved), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(a, moved); err != nil {
+		t.Fatal(err)
+	}
+	tags := scannedTags(t, newService())
+	if !slices.Equal(tags["c.png"], []string{"night-sky"}) {
+		t.Errorf("moved c.png has tags %q, want night-sky", tags["c.png"])
+	}
+	if !slices.Equal(tags["b.png"], []string{"forest"}) {
+		t.Errorf("b.png has tags %q without the index, want forest", tags["b.png"])
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// ThumbnailSize is the largest width or height of a thumbnail. Each size has
+// its own directory in the cache.
+type ThumbnailSize int
+
+const (
+	ThumbnailNormal ThumbnailSize = 128
+	ThumbnailLarge  ThumbnailSize = 256
+)
+
+func (s ThumbnailSize) dir() string {
+	if s > ThumbnailNormal {
+		return "large"
+	}
+	return "normal"
+}
+
+// ErrThumbnailFailed is returned for images a thumbnail could not be made of
+// before, until they change.
+var ErrThumbnailFailed = errors.New("thumbnail failed before")
+
+// thumbnailFailDir is where failures are recorded, per the standard, so that
+// broken images are not decoded again on every start.
+const thumbnailFailDir = "fail/wallpaper-manager"
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ThumbnailCache reads and writes thumbnails following the freedesktop
+// Thumbnail Managing Standard, so they are shared with file managers and
+// other image viewers. A thumbnail is a PNG named after the MD5 of the file's
+// URI, whose Thumb::URI and Thumb::MTime attributes tell whether it is still
+// valid for the file.
+type ThumbnailCache struct {
+	dir string
+}
+
+// ThumbnailDir returns $XDG_CACHE_HOME/thumbnails, where XDG_CACHE_HOME
+// defaults to ~/.cache.
+func ThumbnailDir() string {
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		cacheHome = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(cacheHome, "thumbnails")
+}
+
+func NewThumbnailCache(dir string) *ThumbnailCache {
+	return &ThumbnailCache{dir: dir}
+}
+
+// Path returns where the thumbnail of file is stored for size.
+func (c *ThumbnailCache) Path(file string, size ThumbnailSize) string {
+	return filepath.Join(c.dir, size.dir(), thumbnailName(file))
+}
+
+// Thumbnail returns the path of a valid thumbnail of file, making it first if
+// there is none. Images that cannot be decoded are recorded as failed, and
+// return ErrThumbnailFailed until they change. When ctx is cancelled before
+// the thumbnail has been made, ctx's error is returned.
+func (c *ThumbnailCache) Thumbnail(ctx context.Context, file string, size ThumbnailSize) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	uri := thumbnailURI(file)
+
+	thumbPath := c.Path(file, size)
+	if thumbnailValid(thumbPath, uri, info) {
+		return thumbPath, nil
+	}
+	failPath := filepath.Join(c.dir, thumbnailFailDir, thumbnailName(file))
+	if thumbnailValid(failPath, uri, info) {
+		return "", ErrThumbnailFailed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	img, err := imaging.Open(file, imaging.AutoOrientation(true))
+	if err != nil {
+		// Recording the failure is best effort; the next attempt only
+		// costs another decode.
+		_ = writeThumbnail(failPath, image.NewNRGBA(image.Rect(0, 0, 1, 1)), uri, info, image.Point{})
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	original := img.Bounds().Size()
+	if original.X > int(size) || original.Y > int(size) {
+		img = imaging.Fit(img, int(size), int(size), imaging.Lanczos)
+	}
+	if err := writeThumbnail(thumbPath, img, uri, info, original); err != nil {
+		return "", err
+	}
+	return thumbPath, nil
+}
+
+// thumbnailName is the file name of the thumbnail of file in every size
+// directory.
+func thumbnailName(file string) string {
+	sum := md5.Sum([]byte(thumbnailURI(file)))
+	return hex.EncodeToString(sum[:]) + ".png"
+}
+
+// thumbnailURI returns the file:// URI of file, escaped the way GLib does so
+// that thumbnails made by GTK applications are found and the other way round.
+func thumbnailURI(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	b.WriteString("file://")
+	for i := 0; i < len(file); i++ {
+		c := file[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!$&'()*+,-./:=@_~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0xf])
+	}
+	return b.String()
+}
+
+// thumbnailValid reports whether the thumbnail at thumbPath was made from the
+// current version of the file at uri.
+func thumbnailValid(thumbPath, uri string, info os.FileInfo) bool {
+	attrs, err := readPNGText(thumbPath)
+	if err != nil {
+		return false
+	}
+	return attrs["Thumb::URI"] == uri && attrs["Thumb::MTime"] == strconv.FormatInt(info.ModTime().Unix(), 10)
+}
+
+// readPNGText returns the tEXt chunks of the PNG at path, which come before
+// the image data in thumbnails.
+func readPNGText(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil || !bytes.Equal(signature, pngSignature) {
+		return nil, fmt.Errorf("%s: not a PNG file", path)
+	}
+
+	attrs := make(map[string]string)
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		length, kind := binary.BigEndian.Uint32(header[:4]), string(header[4:])
+		if kind == "IDAT" || kind == "IEND" {
+			return attrs, nil
+		}
+		if kind != "tEXt" {
+			if _, err := r.Discard(int(length) + 4); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		data := make([]byte, length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		if key, value, ok := bytes.Cut(data[:length], []byte{0}); ok {
+			attrs[string(key)] = string(value)
+		}
+	}
+}
+
+// writeThumbnail stores img at thumbPath with the attributes of the standard.
+// original is the size of the full image, if known. The file is written
+// under a temporary name and renamed, so readers never see part of it.
+func writeThumbnail(thumbPath string, img image.Image, uri string, info os.FileInfo, original image.Point) error {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return err
+	}
+
+	attrs := [][2]string{
+		{"Thumb::URI", uri},
+		{"Thumb::MTime", strconv.FormatInt(info.ModTime().Unix(), 10)},
+		{"Thumb::Size", strconv.FormatInt(info.Size(), 10)},
+		{"Software", "wallpaper-manager"},
+	}
+	if original != (image.Point{}) {
+		attrs = append(attrs,
+			[2]string{"Thumb::Image::Width", strconv.Itoa(original.X)},
+			[2]string{"Thumb::Image::Height", strconv.Itoa(original.Y)},
+		)
+	}
+
+	// The attributes go right after the IHDR chunk, which follows the
+	// signature and is always 13 bytes long.
+	data := encoded.Bytes()
+	headerEnd := len(pngSignature) + 8 + 13 + 4
+	var out bytes.Buffer
+	out.Write(data[:headerEnd])
+	for _, attr := range attrs {
+		writePNGChunk(&out, "tEXt", []byte(attr[0]+"\x00"+attr[1]))
+	}
+	out.Write(data[headerEnd:])
+
+	// The standard asks for the directories and thumbnails to be private
+	// to the user.
+	dir := filepath.Dir(thumbPath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "wallpaper-manager-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), thumbPath)
+}
+
+func writePNGChunk(w *bytes.Buffer, kind string, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	w.Write(length[:])
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(kind))
+	crc.Write(data)
+	w.WriteString(kind)
+	w.Write(data)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	w.Write(sum[:])
+}
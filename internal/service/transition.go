@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// TransitionType is one of swww's --transition-type values, or
+// TransitionRandom which is resolved here so the chosen type can be recorded.
+type TransitionType string
+
+const (
+	TransitionNone   TransitionType = "none"
+	TransitionSimple TransitionType = "simple"
+	TransitionFade   TransitionType = "fade"
+	TransitionLeft   TransitionType = "left"
+	TransitionRight  TransitionType = "right"
+	TransitionTop    TransitionType = "top"
+	TransitionBottom TransitionType = "bottom"
+	TransitionWipe   TransitionType = "wipe"
+	TransitionWave   TransitionType = "wave"
+	TransitionGrow   TransitionType = "grow"
+	TransitionCenter TransitionType = "center"
+	TransitionAny    TransitionType = "any"
+	TransitionOuter  TransitionType = "outer"
+	TransitionRandom TransitionType = "random"
+)
+
+// TransitionTypes lists every accepted type, in the order shown in pickers.
+var TransitionTypes = []TransitionType{
+	TransitionOuter, TransitionRandom, TransitionNone, TransitionSimple, TransitionFade,
+	TransitionLeft, TransitionRight, TransitionTop, TransitionBottom, TransitionWipe,
+	TransitionWave, TransitionGrow, TransitionCenter, TransitionAny,
+}
+
+// randomTransitionTypes are the animated types TransitionRandom picks from.
+var randomTransitionTypes = []TransitionType{
+	TransitionFade, TransitionLeft, TransitionRight, TransitionTop, TransitionBottom,
+	TransitionWipe, TransitionWave, TransitionGrow, TransitionCenter, TransitionOuter,
+}
+
+var transitionPositionPattern = regexp.MustCompile(`^(center|top|left|right|bottom|top-left|top-right|bottom-left|bottom-right|-?\d+(\.\d+)?,-?\d+(\.\d+)?)$`)
+
+// Bezier is the cubic bezier curve controlling transition speed.
+type Bezier struct {
+	X1, Y1, X2, Y2 float64
+}
+
+// Wave is the width and height of the wave transition's waves.
+type Wave struct {
+	Width, Height float64
+}
+
+// TransitionOptions mirrors swww's transition flags. Zero values leave the
+// corresponding flag unset so swww's defaults apply.
+type TransitionOptions struct {
+	Type     TransitionType
+	Step     int
+	FPS      int
+	Duration float64
+	Angle    float64
+	Position string
+	Bezier   *Bezier
+	Wave     *Wave
+}
+
+func DefaultTransition() TransitionOptions {
+	return TransitionOptions{Type: TransitionOuter}
+}
+
+// Validate rejects unknown types, out-of-range values and options that have
+// no effect with the chosen type, so mistakes surface before swww runs.
+func (t TransitionOptions) Validate() error {
+	if t.Type != "" && !slices.Contains(TransitionTypes, t.Type) {
+		return fmt.Errorf("unknown transition type %q", t.Type)
+	}
+	if t.Step < 0 || t.Step > 255 {
+		return fmt.Errorf("transition step must be 0 for the default or between 1 and 255, got %d", t.Step)
+	}
+	if t.FPS < 0 {
+		return fmt.Errorf("transition fps must be positive, got %d", t.FPS)
+	}
+	if t.Duration < 0 {
+		return fmt.Errorf("transition duration must be positive, got %g", t.Duration)
+	}
+	if t.Angle < 0 || t.Angle > 360 {
+		return fmt.Errorf("transition angle must be between 0 and 360, got %g", t.Angle)
+	}
+	if t.Position != "" && !transitionPositionPattern.MatchString(t.Position) {
+		return fmt.Errorf("invalid transition position %q", t.Position)
+	}
+	if t.Bezier != nil && (t.Bezier.X1 < 0 || t.Bezier.X1 > 1 || t.Bezier.X2 < 0 || t.Bezier.X2 > 1) {
+		return fmt.Errorf("transition bezier x values must be between 0 and 1")
+	}
+	if t.Wave != nil && (t.Wave.Width <= 0 || t.Wave.Height <= 0) {
+		return fmt.Errorf("transition wave size must be positive")
+	}
+
+	// Random picks a type later and drops whatever does not apply to it.
+	if t.Type == TransitionRandom {
+		return nil
+	}
+	if t.Duration > 0 && (t.Type == TransitionNone || t.Type == TransitionSimple) {
+		return fmt.Errorf("transition duration has no effect with type %q", t.Type)
+	}
+	if t.Angle != 0 && t.Type != TransitionWipe && t.Type != TransitionWave {
+		return fmt.Errorf("transition angle requires type wipe or wave, got %q", t.Type)
+	}
+	if t.Wave != nil && t.Type != TransitionWave {
+		return fmt.Errorf("transition wave requires type wave, got %q", t.Type)
+	}
+	if t.Position != "" && !slices.Contains([]TransitionType{TransitionGrow, TransitionOuter, TransitionAny}, t.Type) {
+		return fmt.Errorf("transition position requires type grow, outer or any, got %q", t.Type)
+	}
+	return nil
+}
+
+// Resolve replaces TransitionRandom with a concrete type and clears the
+// options that type does not use.
+func (t TransitionOptions) Resolve() TransitionOptions {
+	if t.Type != TransitionRandom {
+		return t
+	}
+
+	return t.WithType(randomTransitionTypes[rand.IntN(len(randomTransitionTypes))])
+}
+
+// WithType returns t with its type replaced by typ, clearing the options typ
+// does not use.
+func (t TransitionOptions) WithType(typ TransitionType) TransitionOptions {
+	t.Type = typ
+	if typ == TransitionRandom {
+		return t
+	}
+	if typ == TransitionNone || typ == TransitionSimple {
+		t.Duration = 0
+	}
+	if typ != TransitionWipe && typ != TransitionWave {
+		t.Angle = 0
+	}
+	if typ != TransitionWave {
+		t.Wave = nil
+	}
+	if typ != TransitionGrow && typ != TransitionOuter && typ != TransitionAny {
+		t.Position = ""
+	}
+	return t
+}
+
+// Args returns the swww img flags for t.
+func (t TransitionOptions) Args() []string {
+	var args []string
+	if t.Type != "" {
+		args = append(args, "--transition-type", string(t.Type))
+	}
+	if t.Step > 0 {
+		args = append(args, "--transition-step", strconv.Itoa(t.Step))
+	}
+	if t.FPS > 0 {
+		args = append(args, "--transition-fps", strconv.Itoa(t.FPS))
+	}
+	if t.Duration > 0 {
+		args = append(args, "--transition-duration", formatFloat(t.Duration))
+	}
+	if t.Angle != 0 {
+		args = append(args, "--transition-angle", formatFloat(t.Angle))
+	}
+	if t.Position != "" {
+		args = append(args, "--transition-pos", t.Position)
+	}
+	if t.Bezier != nil {
+		args = append(args, "--transition-bezier", fmt.Sprintf("%s,%s,%s,%s",
+			formatFloat(t.Bezier.X1), formatFloat(t.Bezier.Y1), formatFloat(t.Bezier.X2), formatFloat(t.Bezier.Y2)))
+	}
+	if t.Wave != nil {
+		args = append(args, "--transition-wave", fmt.Sprintf("%s,%s", formatFloat(t.Wave.Width), formatFloat(t.Wave.Height)))
+	}
+	return args
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
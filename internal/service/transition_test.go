@@ -0,0 +1,151 @@
+package service
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestTransitionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TransitionOptions
+		ok   bool
+	}{
+		{"zero", TransitionOptions{}, true},
+		{"default", DefaultTransition(), true},
+		{"unknown type", TransitionOptions{Type: "spiral"}, false},
+		{"default step", TransitionOptions{Type: TransitionFade, Step: 0}, true},
+		{"smallest step", TransitionOptions{Type: TransitionFade, Step: 1}, true},
+		{"largest step", TransitionOptions{Type: TransitionFade, Step: 255}, true},
+		{"negative step", TransitionOptions{Type: TransitionFade, Step: -1}, false},
+		{"step too large", TransitionOptions{Type: TransitionFade, Step: 256}, false},
+		{"fps", TransitionOptions{Type: TransitionFade, FPS: 144}, true},
+		{"negative fps", TransitionOptions{Type: TransitionFade, FPS: -1}, false},
+		{"negative duration", TransitionOptions{Type: TransitionFade, Duration: -1}, false},
+		{"angle", TransitionOptions{Type: TransitionWipe, Angle: 360}, true},
+		{"angle too large", TransitionOptions{Type: TransitionWipe, Angle: 361}, false},
+		{"negative angle", TransitionOptions{Type: TransitionWave, Angle: -1}, false},
+		{"named position", TransitionOptions{Type: TransitionGrow, Position: "top-left"}, true},
+		{"coordinate position", TransitionOptions{Type: TransitionOuter, Position: "0.5,-10"}, true},
+		{"invalid position", TransitionOptions{Type: TransitionGrow, Position: "middle"}, false},
+		{"bezier", TransitionOptions{Type: TransitionFade, Bezier: &Bezier{0.5, -2, 1, 3}}, true},
+		{"bezier x out of range", TransitionOptions{Type: TransitionFade, Bezier: &Bezier{1.5, 0, 1, 1}}, false},
+		{"wave", TransitionOptions{Type: TransitionWave, Wave: &Wave{20, 10}}, true},
+		{"empty wave", TransitionOptions{Type: TransitionWave, Wave: &Wave{0, 10}}, false},
+		{"duration without animation", TransitionOptions{Type: TransitionSimple, Duration: 2}, false},
+		{"angle without wipe or wave", TransitionOptions{Type: TransitionFade, Angle: 45}, false},
+		{"wave without wave type", TransitionOptions{Type: TransitionWipe, Wave: &Wave{20, 10}}, false},
+		{"position without grow", TransitionOptions{Type: TransitionLeft, Position: "center"}, false},
+		{"random keeps every option", TransitionOptions{
+			Type: TransitionRandom, Duration: 2, Angle: 45, Position: "center", Wave: &Wave{20, 10},
+		}, true},
+		{"random still checks ranges", TransitionOptions{Type: TransitionRandom, Step: 300}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.opts.Validate()
+			if test.ok && err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			if !test.ok && err == nil {
+				t.Error("Validate() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestTransitionWithType(t *testing.T) {
+	all := TransitionOptions{
+		Type:     TransitionRandom,
+		Step:     90,
+		FPS:      60,
+		Duration: 2,
+		Angle:    45,
+		Position: "center",
+		Bezier:   &Bezier{0, 0, 1, 1},
+		Wave:     &Wave{20, 10},
+	}
+	tests := []struct {
+		typ  TransitionType
+		want TransitionOptions
+	}{
+		{TransitionRandom, all},
+		{TransitionSimple, TransitionOptions{Type: TransitionSimple, Step: 90, FPS: 60, Bezier: all.Bezier}},
+		{TransitionFade, TransitionOptions{Type: TransitionFade, Step: 90, FPS: 60, Duration: 2, Bezier: all.Bezier}},
+		{TransitionWipe, TransitionOptions{Type: TransitionWipe, Step: 90, FPS: 60, Duration: 2, Angle: 45, Bezier: all.Bezier}},
+		{TransitionWave, TransitionOptions{
+			Type: TransitionWave, Step: 90, FPS: 60, Duration: 2, Angle: 45, Bezier: all.Bezier, Wave: all.Wave,
+		}},
+		{TransitionGrow, TransitionOptions{
+			Type: TransitionGrow, Step: 90, FPS: 60, Duration: 2, Position: "center", Bezier: all.Bezier,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.typ), func(t *testing.T) {
+			got := all.WithType(test.typ)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("WithType(%s) = %+v, want %+v", test.typ, got, test.want)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("WithType(%s) is invalid: %v", test.typ, err)
+			}
+		})
+	}
+}
+
+func TestTransitionResolve(t *testing.T) {
+	fixed := TransitionOptions{Type: TransitionFade, Duration: 2}
+	if got := fixed.Resolve(); !reflect.DeepEqual(got, fixed) {
+		t.Errorf("Resolve() = %+v, want %+v unchanged", got, fixed)
+	}
+
+	random := TransitionOptions{Type: TransitionRandom, Duration: 2, Angle: 45, Wave: &Wave{20, 10}}
+	for range 50 {
+		got := random.Resolve()
+		if !slices.Contains(randomTransitionTypes, got.Type) {
+			t.Fatalf("Resolve() picked %q, want one of %q", got.Type, randomTransitionTypes)
+		}
+		if err := got.Validate(); err != nil {
+			t.Fatalf("Resolve() picked %q with options it does not use: %v", got.Type, err)
+		}
+	}
+}
+
+func TestTransitionArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts TransitionOptions
+		want []string
+	}{
+		{"zero", TransitionOptions{}, nil},
+		{"type only", DefaultTransition(), []string{"--transition-type", "outer"}},
+		{"every flag", TransitionOptions{
+			Type:     TransitionWave,
+			Step:     90,
+			FPS:      144,
+			Duration: 1.5,
+			Angle:    30,
+			Bezier:   &Bezier{0.25, 0.1, 0.25, 1},
+			Wave:     &Wave{20, 10.5},
+		}, []string{
+			"--transition-type", "wave",
+			"--transition-step", "90",
+			"--transition-fps", "144",
+			"--transition-duration", "1.5",
+			"--transition-angle", "30",
+			"--transition-bezier", "0.25,0.1,0.25,1",
+			"--transition-wave", "20,10.5",
+		}},
+		{"position", TransitionOptions{Type: TransitionGrow, Position: "0.5,0.5"}, []string{
+			"--transition-type", "grow", "--transition-pos", "0.5,0.5",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.opts.Args(); !slices.Equal(got, test.want) {
+				t.Errorf("Args() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
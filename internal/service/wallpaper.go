@@ -1,83 +1,169 @@
 package service
 
 import (
-	"os"
-	"os/exec"
+	"context"
+	"maps"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
 	"github.com/hambosto/wallpaper-manager/internal/model"
 )
 
 type WallpaperService struct {
-	WallpaperDir string
+	Roots             []LibraryRoot
+	Backend           Backend
+	DefaultTransition TransitionOptions
+	Scan              ScanOptions
+	// HistorySize is how many wallpapers are remembered per output for
+	// undo; 0 disables the history.
+	HistorySize int
+	// Index persists what scans and metadata extraction found, see Index.
+	// It may be nil.
+	Index *Index
+	// Metadata caches the metadata of library images, in Index as well as
+	// for the lifetime of the service.
+	Metadata *MetadataExtractor
+	// Thumbnails is the freedesktop thumbnail cache shared with other
+	// applications.
+	Thumbnails *ThumbnailCache
+
+	annotationsOnce sync.Once
+	annotations     *Annotations
+	annotationsErr  error
 }
 
-func NewWallpaperService(wallpaperDir string) *WallpaperService {
+// NewWallpaperService creates a service using backend, such as the one
+// returned by DetectBackend. If it is nil, SetWallpaper returns ErrNoBackend
+// until one is set.
+func NewWallpaperService(roots []LibraryRoot, backend Backend) *WallpaperService {
+	index := NewIndex(IndexPath())
 	return &WallpaperService{
-		WallpaperDir: wallpaperDir,
+		Roots:             roots,
+		Backend:           backend,
+		DefaultTransition: DefaultTransition(),
+		HistorySize:       DefaultHistorySize,
+		Index:             index,
+		Metadata:          NewMetadataExtractor(index),
+		Thumbnails:        NewThumbnailCache(ThumbnailDir()),
 	}
 }
 
+// GetWallpapers lists the wallpapers of every root according to Scan,
+// skipping roots that are unavailable.
 func (s *WallpaperService) GetWallpapers() ([]model.Wallpaper, error) {
-	var wallpapers []model.Wallpaper
-	files, err := os.ReadDir(s.WallpaperDir)
+	scan, err := s.ScanLibrary(context.Background())
+	return scan.Wallpapers, err
+}
+
+// ScanLibrary is GetWallpapers with a context to cancel long scans, also
+// reporting the roots that could not be read. The wallpapers come with their
+// tags, after following the rated and tagged images that were moved.
+func (s *WallpaperService) ScanLibrary(ctx context.Context) (LibraryScan, error) {
+	scan, err := ScanLibrary(ctx, s.Roots, s.Scan, s.Index)
 	if err != nil {
-		return nil, err
+		return scan, err
 	}
-
-	for _, file := range files {
-		if !file.IsDir() {
-			ext := strings.ToLower(filepath.Ext(file.Name()))
-			if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" {
-				wallpapers = append(wallpapers, model.Wallpaper{
-					Name: file.Name(),
-					Path: filepath.Join(s.WallpaperDir, file.Name()),
-				})
-			}
-		}
+	annotations, err := s.Annotations()
+	if err != nil {
+		return scan, err
 	}
-	return wallpapers, nil
+	err = annotations.Relink(scan.Wallpapers)
+	annotations.FillTags(scan.Wallpapers)
+	return scan, err
 }
 
 func (s *WallpaperService) SetWallpaper(path string) error {
+	return s.SetWallpaperForOutput("", path)
+}
+
+// SetWallpaperForOutput applies path to a single output, or to every output
+// when output is empty, using DefaultTransition.
+func (s *WallpaperService) SetWallpaperForOutput(output, path string) error {
+	return s.ApplyWallpaper(output, path, s.DefaultTransition)
+}
+
+// ApplyWallpaper applies path to output with transition and records it for
+// restoration and undo. The transition is ignored by backends without
+// transitions.
+func (s *WallpaperService) ApplyWallpaper(output, path string, transition TransitionOptions) error {
+	if s.Backend == nil {
+		return ErrNoBackend
+	}
+	if output != "" && !s.Backend.Capabilities().MultiOutput {
+		return errPerOutputUnsupported(s.Backend)
+	}
+	if err := transition.Validate(); err != nil {
+		return err
+	}
+
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return err
 	}
 
-	cacheFile := filepath.Join(os.Getenv("HOME"), ".cache", ".active_wallpaper")
-	cacheDir := filepath.Dir(cacheFile)
-	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+	transition = transition.Resolve()
+	if err := s.apply(output, absPath, transition); err != nil {
 		return err
 	}
 
-	if err := os.WriteFile(cacheFile, []byte(absPath), 0o644); err != nil {
+	wp := s.activeWallpaper(absPath, transition)
+	previous, err := updateActiveWallpapers(func(previous map[string]ActiveWallpaper) map[string]ActiveWallpaper {
+		active := make(map[string]ActiveWallpaper)
+		if output != "" {
+			maps.Copy(active, previous)
+		}
+		active[output] = wp
+		return active
+	})
+	if err != nil {
 		return err
 	}
+	return s.recordHistory(map[string]ActiveWallpaper{output: wp}, previous)
+}
 
-	clearCache := exec.Command("swww", "clear-cache")
-	if err := clearCache.Run(); err != nil {
-		return err
+// activeWallpaper records the settings path was just applied with.
+func (s *WallpaperService) activeWallpaper(path string, transition TransitionOptions) ActiveWallpaper {
+	wp := ActiveWallpaper{Path: path, Backend: s.Backend.Name(), SetAt: time.Now()}
+	if hash, err := fileSHA256(path); err == nil {
+		wp.SHA256 = hash
+	}
+	if s.Backend.Capabilities().Transitions {
+		wp.Transition = transition.Type
+	}
+	if fitter, ok := s.Backend.(Fitter); ok {
+		wp.Mode = fitter.FitMode()
 	}
+	return wp
+}
 
-	// wallustCmd := exec.Command("wallust", "run", absPath)
-	// if err := wallustCmd.Run(); err != nil {
-	// 	return err
-	// }
+func (s *WallpaperService) apply(output, path string, transition TransitionOptions) error {
+	if applier, ok := s.Backend.(TransitionApplier); ok && s.Backend.Capabilities().Transitions {
+		return applier.ApplyTransition(output, path, transition)
+	}
+	return s.Backend.Apply(output, path)
+}
 
-	// swwwCmd := exec.Command("swww", "img", absPath, "--transition-type", "outer")
-	// if err := swwwCmd.Run(); err != nil {
-	// 	return err
-	// }
+// Outputs lists the outputs the active backend can target.
+func (s *WallpaperService) Outputs() ([]Output, error) {
+	if s.Backend == nil {
+		return nil, ErrNoBackend
+	}
+	return s.Backend.Outputs()
+}
 
-	// reloadCmd := exec.Command("hyprctl", "reload")
-	// return reloadCmd.Run()
+func (s *WallpaperService) SetRoots(roots []LibraryRoot) {
+	s.Roots = roots
+}
 
-	cmd := exec.Command("swww", "img", absPath, "--transition-type", "outer")
-	return cmd.Run()
+func (s *WallpaperService) SetBackend(backend Backend) {
+	s.Backend = backend
 }
 
-func (s *WallpaperService) UpdateWallpaperDirectory(newDir string) {
-	s.WallpaperDir = newDir
+// BackendName returns the active backend's name, or "none" if no backend is set.
+func (s *WallpaperService) BackendName() string {
+	if s.Backend == nil {
+		return "none"
+	}
+	return s.Backend.Name()
 }
@@ -0,0 +1,486 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+const (
+	// watchDebounce is how long the watcher waits for a burst of events,
+	// such as copying a folder of images, to settle.
+	watchDebounce = 300 * time.Millisecond
+	// watchMaxDelay bounds how long changes wait during a continuous burst.
+	watchMaxDelay = 2 * time.Second
+)
+
+// LibraryChange is a batch of changes below the library roots.
+type LibraryChange struct {
+	// Added holds new files and files whose content changed.
+	Added []model.Wallpaper
+	// Removed holds the paths of files that left the library.
+	Removed []string
+	// Renamed maps the old path of each moved file to the wallpaper at
+	// its new path.
+	Renamed map[string]model.Wallpaper
+	// Rescan is set when events were lost and the library has to be
+	// scanned again to be accurate.
+	Rescan bool
+}
+
+func (c LibraryChange) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Renamed) == 0 && !c.Rescan
+}
+
+// LibraryWatcher watches the directories of a library scan and reports what
+// changes below them, one batch per burst of filesystem events. New
+// directories are scanned and watched as they appear.
+//
+// A file removed and another added in the same batch with the same size and
+// modification time, which is what moving a file looks like, is reported as
+// a rename, and the state, history and index follow it.
+//
+// A root that is removed, such as a folder on a drive being unmounted, is
+// watched for from the closest directory above it that exists, and scanned
+// and watched again when it comes back.
+type LibraryWatcher struct {
+	service  *WallpaperService
+	roots    []LibraryRoot
+	opts     ScanOptions
+	exclude  *ExcludeMatcher
+	watcher  *fsnotify.Watcher
+	onChange func(LibraryChange)
+	done     chan struct{}
+
+	// known and watched are only used by the run goroutine once it has
+	// started.
+	known   map[string]model.Wallpaper
+	watched map[string]bool
+	// missing maps the roots that were removed to the directory watched
+	// for them to appear again.
+	missing map[string]string
+}
+
+// WatchLibrary watches the directories of scan, which must have been made
+// from the current Roots and Scan options, and calls onChange from the
+// watcher's goroutine with every batch of changes.
+func (s *WallpaperService) WatchLibrary(scan LibraryScan, onChange func(LibraryChange)) (*LibraryWatcher, error) {
+	exclude, err := NewExcludeMatcher(s.Scan.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &LibraryWatcher{
+		service:  s,
+		roots:    slices.Clone(s.Roots),
+		opts:     s.Scan,
+		exclude:  exclude,
+		watcher:  watcher,
+		onChange: onChange,
+		done:     make(chan struct{}),
+		known:    make(map[string]model.Wallpaper, len(scan.Wallpapers)),
+		watched:  make(map[string]bool, len(scan.Dirs)),
+		missing:  make(map[string]string),
+	}
+	for _, wp := range scan.Wallpapers {
+		w.known[wp.Path] = wp
+	}
+	for _, dir := range scan.Dirs {
+		if err := w.watch(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching and waits for a batch being processed to finish.
+func (w *LibraryWatcher) Close() error {
+	err := w.watcher.Close()
+	<-w.done
+	return err
+}
+
+func (w *LibraryWatcher) watch(dir string) error {
+	if w.watched[dir] {
+		return nil
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		return fmt.Errorf("watching %s: %w", dir, err)
+	}
+	w.watched[dir] = true
+	return nil
+}
+
+func (w *LibraryWatcher) run() {
+	defer close(w.done)
+
+	pending := make(map[string]bool)
+	var first time.Time
+	timer := time.NewTimer(0)
+	<-timer.C
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if len(pending) == 0 {
+				first = time.Now()
+			}
+			pending[filepath.Clean(event.Name)] = true
+			timer.Reset(min(watchDebounce, time.Until(first.Add(watchMaxDelay))))
+
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.onChange(LibraryChange{Rescan: true})
+			}
+
+		case <-timer.C:
+			if change := w.process(pending); !change.empty() {
+				w.onChange(change)
+			}
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// process works out what the events on paths changed in the library and
+// brings the index up to date.
+func (w *LibraryWatcher) process(paths map[string]bool) LibraryChange {
+	index := w.service.Index
+	added := make(map[string]model.Wallpaper)
+	var removed []model.Wallpaper
+
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	slices.Sort(sorted)
+
+	for _, wp := range w.restoreRoots() {
+		added[wp.Path] = wp
+	}
+	for _, p := range sorted {
+		root, rel, located := w.locate(p)
+		if !located && !w.aboveRoot(p) {
+			// Something next to a directory watched for a missing root.
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			removed = append(removed, w.forget(p)...)
+			continue
+		}
+		if !located {
+			// A root, or a directory above one, was created; restoreRoots
+			// took care of it.
+			continue
+		}
+		if !w.included(p, rel, info.IsDir()) {
+			removed = append(removed, w.forget(p)...)
+			continue
+		}
+
+		if info.IsDir() {
+			for _, wp := range w.scanNewDirectory(p, root, rel) {
+				added[wp.Path] = wp
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		if old, ok := w.known[p]; ok && old.Size == info.Size() && old.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+		entry, readable := inspectFile(p, info)
+		if readable && index != nil {
+			index.Update(p, func(*IndexEntry) *IndexEntry { return entry })
+		}
+		if entry.Ignored {
+			removed = append(removed, w.forget(p)...)
+			continue
+		}
+		dir := path.Dir(rel)
+		if dir == "." {
+			dir = ""
+		}
+		added[p] = entry.wallpaper(p, root.Label, dir)
+	}
+
+	var change LibraryChange
+	for _, old := range removed {
+		if wp, ok := w.renamedTo(old, added); ok {
+			delete(added, wp.Path)
+			wp.Metadata = old.Metadata
+			wp.Tags = old.Tags
+			if change.Renamed == nil {
+				change.Renamed = make(map[string]model.Wallpaper)
+			}
+			change.Renamed[old.Path] = wp
+			w.known[wp.Path] = wp
+			_ = w.service.RenameWallpaper(old.Path, wp.Path)
+			continue
+		}
+
+		change.Removed = append(change.Removed, old.Path)
+		if index != nil {
+			index.Update(old.Path, func(*IndexEntry) *IndexEntry { return nil })
+		}
+	}
+	for _, wp := range added {
+		change.Added = append(change.Added, wp)
+	}
+	slices.SortFunc(change.Added, func(a, b model.Wallpaper) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	if annotations, err := w.service.Annotations(); err == nil {
+		annotations.FillTags(change.Added)
+	}
+	for _, wp := range change.Added {
+		w.known[wp.Path] = wp
+	}
+
+	if index != nil {
+		_ = index.Flush()
+	}
+	return change
+}
+
+// renamedTo finds the wallpaper in added that old was moved to: a new file
+// with the same size and modification time, preferring one with the same
+// name.
+func (w *LibraryWatcher) renamedTo(old model.Wallpaper, added map[string]model.Wallpaper) (model.Wallpaper, bool) {
+	var match model.Wallpaper
+	found := false
+	for p, wp := range added {
+		if wp.Size != old.Size || !wp.ModTime.Equal(old.ModTime) || w.knownBefore(p) {
+			continue
+		}
+		if !found || (wp.Name == old.Name && match.Name != old.Name) || (wp.Name == match.Name && p < match.Path) {
+			match, found = wp, true
+		}
+	}
+	return match, found
+}
+
+// knownBefore reports whether path was in the library before the current
+// batch, in which case it was modified rather than moved there.
+func (w *LibraryWatcher) knownBefore(path string) bool {
+	_, ok := w.known[path]
+	return ok
+}
+
+// forget drops path, and everything below it if it was a directory, and
+// returns the wallpapers that were dropped.
+func (w *LibraryWatcher) forget(path string) []model.Wallpaper {
+	var removed []model.Wallpaper
+	if wp, ok := w.known[path]; ok {
+		removed = append(removed, wp)
+		delete(w.known, path)
+	}
+
+	prefix := dirPrefix(path)
+	for p, wp := range w.known {
+		if strings.HasPrefix(p, prefix) {
+			removed = append(removed, wp)
+			delete(w.known, p)
+		}
+	}
+	for dir := range w.watched {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			// The watch is already gone if the directory was deleted.
+			_ = w.watcher.Remove(dir)
+			delete(w.watched, dir)
+		}
+	}
+	for _, root := range w.roots {
+		root := filepath.Clean(root.Path)
+		dir, waiting := w.missing[root]
+		gone := root == path || strings.HasPrefix(root, prefix)
+		if waiting && (dir == path || strings.HasPrefix(dir, prefix)) {
+			gone = true
+		}
+		if _, err := os.Stat(root); gone && err != nil {
+			w.awaitRoot(root)
+		}
+	}
+
+	slices.SortFunc(removed, func(a, b model.Wallpaper) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return removed
+}
+
+// awaitRoot watches the closest directory above the missing root that
+// exists, so that the root is noticed when it is created again.
+func (w *LibraryWatcher) awaitRoot(root string) {
+	dir := filepath.Dir(root)
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+
+	old, waiting := w.missing[root]
+	w.missing[root] = dir
+	if waiting && old == dir {
+		return
+	}
+	_ = w.watcher.Add(dir)
+	if waiting {
+		w.release(old)
+	}
+}
+
+// release stops watching dir, which was watched for a missing root, unless
+// it is still needed.
+func (w *LibraryWatcher) release(dir string) {
+	if w.watched[dir] {
+		return
+	}
+	for _, d := range w.missing {
+		if d == dir {
+			return
+		}
+	}
+	_ = w.watcher.Remove(dir)
+}
+
+// restoreRoots scans and watches the missing roots that exist again, and
+// watches for the others from further down as the directories above them
+// are created.
+func (w *LibraryWatcher) restoreRoots() []model.Wallpaper {
+	var wallpapers []model.Wallpaper
+	for _, root := range w.roots {
+		path := filepath.Clean(root.Path)
+		dir, waiting := w.missing[path]
+		if !waiting {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			w.awaitRoot(path)
+			continue
+		}
+		delete(w.missing, path)
+		w.release(dir)
+		wallpapers = append(wallpapers, w.scanNewDirectory(path, root, "")...)
+	}
+	return wallpapers
+}
+
+// aboveRoot reports whether p is a root or a directory above one.
+func (w *LibraryWatcher) aboveRoot(p string) bool {
+	for _, root := range w.roots {
+		root := filepath.Clean(root.Path)
+		if root == p || strings.HasPrefix(root, dirPrefix(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// locate returns the root p is below, preferring the innermost one when
+// roots are nested, and the slash-separated path of p relative to it.
+func (w *LibraryWatcher) locate(p string) (LibraryRoot, string, bool) {
+	var best LibraryRoot
+	var bestRel string
+	found := false
+	for _, root := range w.roots {
+		if !strings.HasPrefix(p, dirPrefix(root.Path)) {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Clean(root.Path), p)
+		if err != nil {
+			continue
+		}
+		if !found || len(root.Path) > len(best.Path) {
+			best, bestRel, found = root, filepath.ToSlash(rel), true
+		}
+	}
+	return best, bestRel, found
+}
+
+// included applies the scan options to the file or directory p at rel below
+// its root. Its parent directories are already known to be included, since
+// only they are watched.
+func (w *LibraryWatcher) included(p, rel string, isDir bool) bool {
+	if !w.opts.IncludeHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return false
+	}
+	if isDir && !w.opts.FollowSymlinks {
+		if info, err := os.Lstat(p); err != nil || info.Mode()&fs.ModeSymlink != 0 {
+			return false
+		}
+	}
+	if w.exclude.Match(rel, isDir) {
+		return false
+	}
+	if isDir && w.opts.MaxDepth > 0 && strings.Count(rel, "/")+1 >= w.opts.MaxDepth {
+		return false
+	}
+	return true
+}
+
+// scanNewDirectory scans and watches a directory that appeared below root at
+// rel, and returns the wallpapers found in it.
+func (w *LibraryWatcher) scanNewDirectory(dir string, root LibraryRoot, rel string) []model.Wallpaper {
+	if w.watched[dir] {
+		return nil
+	}
+
+	var known map[string]*IndexEntry
+	if w.service.Index != nil {
+		known, _ = w.service.Index.Load([]string{dir})
+	}
+	sc, err := scanSubdirectory(context.Background(), dir, rel, w.opts, known)
+	if err != nil {
+		return nil
+	}
+
+	for _, d := range sc.dirs {
+		_ = w.watch(d)
+	}
+	if index := w.service.Index; index != nil {
+		for p, entry := range sc.fresh {
+			index.Update(p, func(*IndexEntry) *IndexEntry { return entry })
+		}
+	}
+
+	wallpapers := sc.wallpapers
+	for i := range wallpapers {
+		wallpapers[i].Root = root.Label
+	}
+	return wallpapers
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// TestWatchRootRemoved removes a library root and creates it again, below a
+// directory that is removed and created too, which must report its
+// wallpapers gone and then watch it again.
+func TestWatchRootRemoved(t *testing.T) {
+	useStateDirs(t)
+	mount := filepath.Join(t.TempDir(), "drive")
+	root := filepath.Join(mount, "wallpapers")
+	a := filepath.Join(root, "a.png")
+	writePNG(t, a, red)
+
+	s := &WallpaperService{Roots: NewLibraryRoots(root)}
+	scan, err := s.ScanLibrary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan LibraryChange, 16)
+	w, err := s.WatchLibrary(scan, func(change LibraryChange) { changes <- change })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// wait returns once a batch reports what done looks for.
+	wait := func(what string, done func(LibraryChange) bool) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case change := <-changes:
+				if done(change) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("no change reported %s", what)
+			}
+		}
+	}
+
+	if err := os.RemoveAll(mount); err != nil {
+		t.Fatal(err)
+	}
+	wait("a.png as removed", func(change LibraryChange) bool {
+		return slices.Contains(change.Removed, a)
+	})
+
+	writePNG(t, filepath.Join(root, "b.png"), green)
+	wait("b.png as added", func(change LibraryChange) bool {
+		return slices.ContainsFunc(change.Added, func(wp model.Wallpaper) bool {
+			return wp.Path == filepath.Join(root, "b.png")
+		})
+	})
+
+	// The root is watched again.
+	c := filepath.Join(root, "c.png")
+	writePNG(t, c, blue)
+	wait("c.png as added", func(change LibraryChange) bool {
+		return slices.ContainsFunc(change.Added, func(wp model.Wallpaper) bool { return wp.Path == c })
+	})
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"maps"
+	"os"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// X11Backend sets the root window background natively: the image is drawn
+// into a pixmap, filling each RandR monitor, that is kept alive after
+// disconnecting and advertised through the _XROOTPMAP_ID and ESETROOT_PMAP_ID
+// atoms so pseudo-transparent clients and later setters (feh, hsetroot, ...)
+// can find and free it. Which image each output shows is recorded in the
+// x11PathsProperty of the root window, so Current works from any process.
+type X11Backend struct {
+	Display string
+
+	mutex sync.Mutex
+}
+
+// x11PathsProperty is the root window property holding x11Paths.
+const x11PathsProperty = "_WALLPAPER_MANAGER_PATHS"
+
+// x11Paths records the image shown on each output, keyed like
+// State.Outputs, and the root pixmap they were drawn into. The record only
+// holds while that pixmap is the root background, which another setter may
+// have replaced since.
+type x11Paths struct {
+	Pixmap  uint32            `json:"pixmap"`
+	Outputs map[string]string `json:"outputs"`
+}
+
+func NewX11Backend() *X11Backend {
+	return &X11Backend{Display: os.Getenv("DISPLAY")}
+}
+
+func (b *X11Backend) Name() string {
+	return "x11"
+}
+
+func (b *X11Backend) Available() bool {
+	return b.Display != ""
+}
+
+// Ready checks that the X server accepts connections.
+func (b *X11Backend) Ready() error {
+	conn, err := xgb.NewConnDisplay(b.Display)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+func (b *X11Backend) Capabilities() Capabilities {
+	return Capabilities{Transitions: false, MultiOutput: true}
+}
+
+func (b *X11Backend) Outputs() ([]Output, error) {
+	return x11Outputs(b.Display)
+}
+
+func (b *X11Backend) Apply(output, path string) error {
+	src, err := imaging.Open(path, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	conn, err := xgb.NewConnDisplay(b.Display)
+	if err != nil {
+		return fmt.Errorf("x11: %w", err)
+	}
+	defer conn.Close()
+
+	current, err := readPaths(conn)
+	if err != nil {
+		return fmt.Errorf("x11: %w", err)
+	}
+	pixmap, err := setRootPixmap(conn, output, src)
+	if err != nil {
+		return fmt.Errorf("x11: %w", err)
+	}
+
+	if output == "" {
+		clear(current)
+	}
+	current[output] = path
+	if err := writePaths(conn, x11Paths{Pixmap: uint32(pixmap), Outputs: current}); err != nil {
+		return fmt.Errorf("x11: %w", err)
+	}
+	return nil
+}
+
+// Current reads back what Apply recorded on the root window, from this or
+// another process. It is empty once another program set the background.
+func (b *X11Backend) Current() (map[string]string, error) {
+	conn, err := xgb.NewConnDisplay(b.Display)
+	if err != nil {
+		return nil, fmt.Errorf("x11: %w", err)
+	}
+	defer conn.Close()
+
+	current, err := readPaths(conn)
+	if err != nil {
+		return nil, fmt.Errorf("x11: %w", err)
+	}
+	return current, nil
+}
+
+// readPaths returns the images recorded by writePaths by output, or none
+// when the root pixmap is not the one they were drawn into.
+func readPaths(conn *xgb.Conn) (map[string]string, error) {
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	rootAtom, err := internAtom(conn, "_XROOTPMAP_ID")
+	if err != nil {
+		return nil, err
+	}
+	pathsAtom, err := internAtom(conn, x11PathsProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]string)
+	pixmap, ok := pixmapProperty(conn, root, rootAtom)
+	if !ok {
+		return current, nil
+	}
+	// The length is in 32-bit units; the record is far smaller.
+	reply, err := xproto.GetProperty(conn, false, root, pathsAtom, xproto.AtomString, 0, 1<<16).Reply()
+	if err != nil {
+		return nil, err
+	}
+	var paths x11Paths
+	if reply.Format != 8 || json.Unmarshal(reply.Value, &paths) != nil || paths.Pixmap != pixmap {
+		return current, nil
+	}
+	maps.Copy(current, paths.Outputs)
+	return current, nil
+}
+
+func writePaths(conn *xgb.Conn, paths x11Paths) error {
+	data, err := json.Marshal(paths)
+	if err != nil {
+		return err
+	}
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	atom, err := internAtom(conn, x11PathsProperty)
+	if err != nil {
+		return err
+	}
+	return xproto.ChangePropertyChecked(conn, xproto.PropModeReplace, root, atom, xproto.AtomString, 8, uint32(len(data)), data).Check()
+}
+
+// setRootPixmap fills each targeted monitor with src and returns the new
+// root pixmap. When a single output is targeted the previous root pixmap is
+// copied first, so the other monitors keep their wallpaper.
+func setRootPixmap(conn *xgb.Conn, output string, src image.Image) (xproto.Pixmap, error) {
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+	width, height := screen.WidthInPixels, screen.HeightInPixels
+
+	if setup.ImageByteOrder != xproto.ImageOrderLSBFirst {
+		return 0, fmt.Errorf("unsupported image byte order")
+	}
+	if !hasPixmapFormat(setup, screen.RootDepth, 32) {
+		return 0, fmt.Errorf("unsupported root depth %d", screen.RootDepth)
+	}
+
+	monitors, err := randrMonitors(conn)
+	if err != nil || len(monitors) == 0 {
+		monitors = []Output{{Width: int(width), Height: int(height), Scale: 1}}
+	}
+
+	targets := monitors
+	if output != "" {
+		targets = nil
+		for _, m := range monitors {
+			if m.Name == output {
+				targets = append(targets, m)
+			}
+		}
+		if len(targets) == 0 {
+			return 0, fmt.Errorf("unknown output %q", output)
+		}
+	}
+
+	rootAtom, err := internAtom(conn, "_XROOTPMAP_ID")
+	if err != nil {
+		return 0, err
+	}
+	esetrootAtom, err := internAtom(conn, "ESETROOT_PMAP_ID")
+	if err != nil {
+		return 0, err
+	}
+
+	pixmap, err := xproto.NewPixmapId(conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := xproto.CreatePixmapChecked(conn, screen.RootDepth, pixmap, xproto.Drawable(screen.Root), width, height).Check(); err != nil {
+		return 0, err
+	}
+
+	gc, err := xproto.NewGcontextId(conn)
+	if err != nil {
+		return 0, err
+	}
+	if err := xproto.CreateGCChecked(conn, gc, xproto.Drawable(pixmap), 0, nil).Check(); err != nil {
+		return 0, err
+	}
+
+	if previous, ok := pixmapProperty(conn, screen.Root, rootAtom); ok && output != "" {
+		xproto.CopyArea(conn, xproto.Drawable(previous), xproto.Drawable(pixmap), gc, 0, 0, 0, 0, width, height)
+	}
+
+	for _, m := range targets {
+		filled := imaging.Fill(src, m.Width, m.Height, imaging.Center, imaging.Lanczos)
+		putImage(conn, setup, pixmap, gc, screen.RootDepth, m.X, m.Y, filled)
+	}
+	xproto.FreeGC(conn, gc)
+
+	freeOwnedRootPixmap(conn, screen.Root, rootAtom, esetrootAtom)
+
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint32(value, uint32(pixmap))
+	for _, atom := range []xproto.Atom{rootAtom, esetrootAtom} {
+		xproto.ChangeProperty(conn, xproto.PropModeReplace, screen.Root, atom, xproto.AtomPixmap, 32, 1, value)
+	}
+
+	xproto.ChangeWindowAttributes(conn, screen.Root, xproto.CwBackPixmap, []uint32{uint32(pixmap)})
+	xproto.ClearArea(conn, false, screen.Root, 0, 0, 0, 0)
+	xproto.SetCloseDownMode(conn, xproto.CloseDownRetainPermanent)
+
+	// Round-trip so every request above is processed before disconnecting.
+	if _, err := xproto.GetInputFocus(conn).Reply(); err != nil {
+		return 0, err
+	}
+	return pixmap, nil
+}
+
+func hasPixmapFormat(setup *xproto.SetupInfo, depth, bitsPerPixel byte) bool {
+	for _, format := range setup.PixmapFormats {
+		if format.Depth == depth && format.BitsPerPixel == bitsPerPixel {
+			return true
+		}
+	}
+	return false
+}
+
+// putImage uploads img as BGRX scanlines, split into as many PutImage
+// requests as the server's maximum request length requires.
+func putImage(conn *xgb.Conn, setup *xproto.SetupInfo, pixmap xproto.Pixmap, gc xproto.Gcontext, depth byte, dstX, dstY int, img *image.NRGBA) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	stride := width * 4
+
+	const putImageHeader = 24
+	rowsPerRequest := (int(setup.MaximumRequestLength)*4 - putImageHeader) / stride
+	if rowsPerRequest < 1 {
+		rowsPerRequest = 1
+	}
+
+	for y := 0; y < height; y += rowsPerRequest {
+		rows := min(rowsPerRequest, height-y)
+		data := make([]byte, rows*stride)
+		for row := 0; row < rows; row++ {
+			src := img.Pix[(y+row)*img.Stride:]
+			dst := data[row*stride:]
+			for x := 0; x < width; x++ {
+				dst[x*4+0] = src[x*4+2]
+				dst[x*4+1] = src[x*4+1]
+				dst[x*4+2] = src[x*4+0]
+				dst[x*4+3] = 0xff
+			}
+		}
+		xproto.PutImage(conn, xproto.ImageFormatZPixmap, xproto.Drawable(pixmap), gc,
+			uint16(width), uint16(rows), int16(dstX), int16(dstY+y), 0, depth, data)
+	}
+}
+
+func internAtom(conn *xgb.Conn, name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return reply.Atom, nil
+}
+
+// freeOwnedRootPixmap kills the client retaining the previous root pixmap,
+// but only when both atoms agree, which is how setters mark a pixmap as
+// theirs to reclaim.
+func freeOwnedRootPixmap(conn *xgb.Conn, root xproto.Window, rootAtom, esetrootAtom xproto.Atom) {
+	rootPixmap, ok := pixmapProperty(conn, root, rootAtom)
+	if !ok {
+		return
+	}
+	esetrootPixmap, ok := pixmapProperty(conn, root, esetrootAtom)
+	if ok && rootPixmap == esetrootPixmap {
+		xproto.KillClient(conn, rootPixmap)
+	}
+}
+
+func pixmapProperty(conn *xgb.Conn, window xproto.Window, atom xproto.Atom) (uint32, bool) {
+	reply, err := xproto.GetProperty(conn, false, window, atom, xproto.AtomPixmap, 0, 1).Reply()
+	if err != nil || reply.Format != 32 || len(reply.Value) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(reply.Value), true
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// startXvfb runs an X server with one screen of width × height on a free
+// display for the duration of the test and returns the display. The test
+// is skipped where Xvfb is not installed.
+func startXvfb(t *testing.T, width, height int) string {
+	t.Helper()
+	xvfb, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb not found")
+	}
+
+	// Xvfb picks a free display and writes its number to -displayfd.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cmd := exec.Command(xvfb, "-displayfd", "3", "-nolisten", "tcp",
+		"-screen", "0", fmt.Sprintf("%dx%dx24", width, height))
+	cmd.ExtraFiles = []*os.File{w}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	number := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		number <- strings.TrimSpace(line)
+	}()
+	select {
+	case n := <-number:
+		if n == "" {
+			t.Fatal("Xvfb did not start")
+		}
+		return ":" + n
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for Xvfb")
+	}
+	return ""
+}
+
+// writeHalves writes a PNG whose left half is left and right half right.
+func writeHalves(t *testing.T, name string, width, height int, left, right color.Color) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			if x < width/2 {
+				img.Set(x, y, left)
+			} else {
+				img.Set(x, y, right)
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rootPixmap returns the pixmaps advertised by the two root pixmap atoms.
+func rootPixmap(t *testing.T, conn *xgb.Conn) (rootID, esetrootID uint32) {
+	t.Helper()
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	ids := make([]uint32, 2)
+	for i, name := range []string{"_XROOTPMAP_ID", "ESETROOT_PMAP_ID"} {
+		atom, err := internAtom(conn, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, ok := pixmapProperty(conn, root, atom)
+		if !ok {
+			t.Fatalf("%s is not set", name)
+		}
+		ids[i] = id
+	}
+	return ids[0], ids[1]
+}
+
+// pixel returns the colour of the pixel at x, y of pixmap.
+func pixel(t *testing.T, conn *xgb.Conn, pixmap uint32, x, y int16) color.RGBA {
+	t.Helper()
+	reply, err := xproto.GetImage(conn, xproto.ImageFormatZPixmap, xproto.Drawable(pixmap), x, y, 1, 1, 0xffffffff).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Data) < 4 {
+		t.Fatalf("GetImage returned %d bytes", len(reply.Data))
+	}
+	return color.RGBA{R: reply.Data[2], G: reply.Data[1], B: reply.Data[0], A: 0xff}
+}
+
+func TestX11Backend(t *testing.T) {
+	display := startXvfb(t, 640, 480)
+	red, blue, green := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}, color.RGBA{G: 0xff, A: 0xff}
+	halves := writeHalves(t, "halves.png", 64, 48, red, blue)
+	plain := writeHalves(t, "green.png", 64, 48, green, green)
+
+	b := &X11Backend{Display: display}
+	if err := b.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := b.Outputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Width != 640 || outputs[0].Height != 480 {
+		t.Fatalf("Outputs() = %+v, want one 640x480 monitor", outputs)
+	}
+
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := b.Apply("", halves); err != nil {
+		t.Fatal(err)
+	}
+	first, esetroot := rootPixmap(t, conn)
+	if first != esetroot {
+		t.Errorf("_XROOTPMAP_ID = %#x, ESETROOT_PMAP_ID = %#x, want the same pixmap", first, esetroot)
+	}
+	if got := pixel(t, conn, first, 10, 240); got != red {
+		t.Errorf("left pixel = %v, want %v", got, red)
+	}
+	if got := pixel(t, conn, first, 630, 240); got != blue {
+		t.Errorf("right pixel = %v, want %v", got, blue)
+	}
+
+	if err := b.Apply(outputs[0].Name, plain); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := rootPixmap(t, conn)
+	if second == first {
+		t.Error("the root pixmap was not replaced")
+	}
+	if got := pixel(t, conn, second, 10, 240); got != green {
+		t.Errorf("pixel = %v, want %v", got, green)
+	}
+	// The client that retained the first pixmap is killed to free it.
+	if _, err := xproto.GetGeometry(conn, xproto.Drawable(first)).Reply(); err == nil {
+		t.Error("the previous root pixmap was not freed")
+	}
+
+	if err := b.Apply("NOPE-1", plain); err == nil {
+		t.Error("Apply() on an unknown output succeeded")
+	}
+	// Another process, such as `wallpaper-manager current`, reads the
+	// images back from the root window.
+	current, err := (&X11Backend{Display: display}).Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"": halves, outputs[0].Name: plain}; !reflect.DeepEqual(current, want) {
+		t.Errorf("Current() = %v, want %v", current, want)
+	}
+
+	// Once another setter replaces the root pixmap, nothing is known.
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	atom, err := internAtom(conn, "_XROOTPMAP_ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xproto.ChangePropertyChecked(conn, xproto.PropModeReplace, root, atom, xproto.AtomPixmap, 32, 1, []byte{1, 0, 0, 0}).Check(); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := b.Current(); err != nil || len(current) != 0 {
+		t.Errorf("Current() = %v, %v after another setter, want nothing", current, err)
+	}
+}
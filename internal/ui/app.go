@@ -2,80 +2,185 @@ package ui
 
 import (
 	"fmt"
+	"math"
 	"net/url"
+	"os"
+	"slices"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/config"
+	"github.com/hambosto/wallpaper-manager/internal/model"
 	"github.com/hambosto/wallpaper-manager/internal/service"
 )
 
 type App struct {
 	fyneApp          fyne.App
 	mainWindow       fyne.Window
+	config           *config.Config
 	wallpaperService *service.WallpaperService
 	previewManager   *PreviewManager
+	tagEditor        *TagEditor
 	listManager      *ListManager
+	thumbnails       *ThumbnailLoader
 	statusLabel      *widget.Label
-	folderLabel      *widget.Label
+	rootSelect       *widget.Select
+	unavailableRoots []*service.RootError
+	watcher          *service.LibraryWatcher
+	outputSelect     *widget.Select
+	outputs          []service.Output
+	selectedOutput   string
+	spanOutputs      bool
+	matchMonitor     *widget.Check
+	transitionSelect *widget.Select
+	transition       service.TransitionOptions
+	rotation         *RotationControls
+	startupError     string
 }
 
-func NewApp(defaultWallpaperDir string) *App {
+const (
+	allOutputsLabel  = "All outputs"
+	spanOutputsLabel = "Span across outputs"
+)
+
+// sortLabels names config.SortOrders in the sort selector.
+var sortLabels = map[string]string{
+	config.SortFolder:     "Folder",
+	config.SortName:       "Name",
+	config.SortDate:       "Date modified",
+	config.SortSize:       "File size",
+	config.SortResolution: "Resolution",
+	config.SortLastUsed:   "Last used",
+	config.SortRating:     "Annotation",
+}
+
+const anyOrientationLabel = "Any orientation"
+
+var orientationLabels = map[string]model.Orientation{
+	anyOrientationLabel: "",
+	"Landscape":         model.Landscape,
+	"Portrait":          model.Portrait,
+	"Square":            model.Square,
+}
+
+// minResolutions are the choices of the minimum size filter, smallest first.
+var minResolutions = []struct {
+	label         string
+	width, height int
+}{
+	{"Any size", 0, 0},
+	{"1280 × 720 or larger", 1280, 720},
+	{"1920 × 1080 or larger", 1920, 1080},
+	{"2560 × 1440 or larger", 2560, 1440},
+	{"3840 × 2160 or larger", 3840, 2160},
+}
+
+func NewApp(cfg *config.Config, roots []service.LibraryRoot) *App {
 	fyneApp := app.New()
 	mainWindow := fyneApp.NewWindow("Wallpaper Manager")
-	mainWindow.Resize(fyne.NewSize(1000, 600))
+	mainWindow.Resize(fyne.NewSize(cfg.Window.Width, cfg.Window.Height))
 
 	statusLabel := widget.NewLabel("Loading wallpapers...")
-	folderLabel := widget.NewLabel(fmt.Sprintf("Current folder: %s", defaultWallpaperDir))
 
-	wallpaperServ := service.NewWallpaperService(defaultWallpaperDir)
+	backend, _ := cfg.NewBackend()
+	wallpaperServ := service.NewWallpaperService(roots, backend)
+	wallpaperServ.DefaultTransition = cfg.TransitionOptions()
+	wallpaperServ.HistorySize = cfg.History.Size
+	wallpaperServ.Scan = cfg.ScanOptions()
 
 	return &App{
 		fyneApp:          fyneApp,
 		mainWindow:       mainWindow,
+		config:           cfg,
 		wallpaperService: wallpaperServ,
 		statusLabel:      statusLabel,
-		folderLabel:      folderLabel,
+		transition:       wallpaperServ.DefaultTransition,
 	}
 }
 
 func (a *App) Run() {
-	a.previewManager = NewPreviewManager()
-
-	a.listManager = NewListManager(a.wallpaperService, func(wp int) {
-		a.updateStatusText(fmt.Sprintf("Selected wallpaper %d", wp))
+	metadata := NewMetadataLoader(a.wallpaperService.Metadata, int64(a.config.Preview.MaxConcurrent))
+	a.tagEditor = NewTagEditor(a.wallpaperService)
+	a.previewManager = NewPreviewManager(a.config.Preview.CacheSizeMB, int64(a.config.Preview.MaxConcurrent), a.config.Preview.MaxSize, metadata, a.tagEditor)
+
+	a.thumbnails = NewThumbnailLoader(a.wallpaperService.Thumbnails, service.ThumbnailNormal, a.config.Preview.MaxConcurrent)
+	a.listManager = NewListManager(a.wallpaperService, metadata, a.thumbnails, func(wp int) {
+		if wp >= 0 {
+			a.updateStatusText(fmt.Sprintf("Selected wallpaper %d", wp))
+		}
 		a.previewManager.UpdatePreview(a.listManager.GetWallpaper(wp))
 	})
+	a.listManager.OnError = func(err error) {
+		a.showError(fmt.Sprintf("Error saving rating: %v", err))
+	}
+	a.tagEditor.OnChanged = a.listManager.SetTags
+	a.tagEditor.OnError = func(err error) {
+		a.showError(fmt.Sprintf("Error saving tags: %v", err))
+	}
+	if _, err := a.wallpaperService.Annotations(); err != nil {
+		a.ReportError(fmt.Sprintf("Ratings and tags are disabled: %v", err))
+	}
 
+	a.rootSelect = a.createRootSelect()
+	a.listManager.SetGridView(a.config.Window.View == config.GridView)
+	a.listManager.SetSort(a.config.Window.Sort, a.config.Window.SortDescending)
 	a.refreshWallpapers()
 
 	setBtn := a.createSetButton()
-	changeFolderBtn := a.createChangeFolderButton()
+	a.outputSelect = a.createOutputSelect()
+	a.transitionSelect = a.createTransitionSelect()
+	foldersBtn := widget.NewButton("Folders", func() { a.showFoldersWindow() })
+	viewBtn := a.createViewButton()
+	favoritesCheck := widget.NewCheck("Favorites only", func(checked bool) {
+		a.listManager.SetFavoritesOnly(checked)
+	})
+	tagQueryEntry := a.createTagQueryEntry()
+	searchEntry := a.createSearchEntry()
+	sortSelect, sortDirectionBtn := a.createSortControls()
+	orientationSelect := a.createOrientationSelect()
+	minResolutionSelect := a.createMinResolutionSelect()
+	a.matchMonitor = widget.NewCheck("Match monitor", func(bool) { a.updateAspectFilter() })
+	a.updateAspectFilter()
 	refreshBtn := a.createRefreshButton()
+	a.rotation = a.createRotationControls()
+	historyBtn := widget.NewButton("History", func() { a.showHistoryWindow() })
+	scheduleBtn := widget.NewButton("Schedule", func() { a.showScheduleWindow() })
 	aboutBtn := widget.NewButton("About", func() { a.showAboutDialog() })
 
 	leftPanel := container.NewBorder(
 		container.NewVBox(
-			widget.NewLabel("Wallpapers:"),
-			a.folderLabel,
-			changeFolderBtn,
+			container.NewBorder(nil, nil, widget.NewLabel("Wallpapers:"), viewBtn),
+			searchEntry,
+			container.NewBorder(nil, nil, widget.NewLabel("Sort:"), sortDirectionBtn, sortSelect),
+			container.NewGridWithColumns(2, orientationSelect, minResolutionSelect),
+			a.matchMonitor,
+			container.NewBorder(nil, nil, widget.NewLabel("Folder:"), foldersBtn, a.rootSelect),
+			favoritesCheck,
+			container.NewBorder(nil, nil, widget.NewLabel("Tags:"), nil, tagQueryEntry),
 		),
 		container.NewVBox(
+			container.NewBorder(nil, nil, widget.NewLabel("Output:"), nil, a.outputSelect),
+			container.NewBorder(nil, nil, widget.NewLabel("Transition:"), nil, a.transitionSelect),
 			setBtn,
+			a.rotation.GetContainer(),
+			container.NewGridWithColumns(2, historyBtn, scheduleBtn),
 			refreshBtn,
 			aboutBtn,
 		),
 		nil,
 		nil,
-		container.NewVScroll(a.listManager.GetListWidget()),
+		a.listManager.GetView(),
 	)
 
 	rightPanel := container.NewBorder(
 		widget.NewLabel("Preview:"),
-		nil,
+		a.previewManager.GetDetailsContainer(),
 		nil,
 		nil,
 		a.previewManager.GetPreviewContainer(),
@@ -85,7 +190,7 @@ func (a *App) Run() {
 		leftPanel,
 		rightPanel,
 	)
-	split.Offset = 0.3
+	split.Offset = a.config.Window.SplitOffset
 
 	content := container.NewBorder(
 		nil,
@@ -106,13 +211,59 @@ func (a *App) Run() {
 			a.navigateWallpaper(1)
 		case fyne.KeyReturn:
 			a.setCurrentWallpaper()
+		case fyne.KeyF:
+			a.listManager.ToggleFavorite(a.listManager.GetSelectedIndex())
+		case fyne.Key0, fyne.Key1, fyne.Key2, fyne.Key3, fyne.Key4, fyne.Key5:
+			a.listManager.SetRating(a.listManager.GetSelectedIndex(), int(key.Name[0]-'0'))
+		}
+	})
+	a.mainWindow.Canvas().AddShortcut(
+		&desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault},
+		func(fyne.Shortcut) { a.stepHistory(true) },
+	)
+	a.mainWindow.Canvas().AddShortcut(
+		&desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift},
+		func(fyne.Shortcut) { a.stepHistory(false) },
+	)
+	a.mainWindow.Canvas().AddShortcut(
+		&desktop.CustomShortcut{KeyName: fyne.KeyF, Modifier: fyne.KeyModifierShortcutDefault},
+		func(fyne.Shortcut) { a.mainWindow.Canvas().Focus(searchEntry) },
+	)
+
+	a.mainWindow.SetOnClosed(func() {
+		size := a.mainWindow.Canvas().Size()
+		a.config.Window.Width = size.Width
+		a.config.Window.Height = size.Height
+		a.config.Window.SplitOffset = split.Offset
+		a.config.Window.View = config.ListView
+		if a.listManager.IsGridView() {
+			a.config.Window.View = config.GridView
+		}
+		a.config.Window.Sort, a.config.Window.SortDescending = a.listManager.Sort()
+		if err := a.config.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
+		}
+		a.stopWatching()
+		if err := a.wallpaperService.Index.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving library index: %v\n", err)
 		}
 	})
 
 	a.mainWindow.SetContent(content)
+	if a.startupError != "" {
+		a.showError(a.startupError)
+	}
 	a.mainWindow.ShowAndRun()
 }
 
+// ReportError shows message once the main window is up.
+func (a *App) ReportError(message string) {
+	if a.startupError != "" {
+		message = a.startupError + "\n" + message
+	}
+	a.startupError = message
+}
+
 func (a *App) showAboutDialog() {
 	const (
 		windowTitle  = "About Wallpaper Manager"
@@ -153,7 +304,7 @@ func (a *App) showAboutDialog() {
 	)
 
 	backendInfo := widget.NewLabelWithStyle(
-		"Powered by SWWW Wallpaper Daemon",
+		fmt.Sprintf("Wallpaper backend: %s", a.wallpaperService.BackendName()),
 		fyne.TextAlignCenter,
 		fyne.TextStyle{Italic: true},
 	)
@@ -181,13 +332,25 @@ func (a *App) showAboutDialog() {
 
 func (a *App) setCurrentWallpaper() {
 	if selectedWP := a.listManager.GetSelectedWallpaper(); selectedWP != nil {
-		a.updateStatusText(fmt.Sprintf("Setting wallpaper: %s", selectedWP.Name))
+		target := a.selectedOutput
+		if a.spanOutputs {
+			target = "spanned outputs"
+		} else if target == "" {
+			target = allOutputsLabel
+		}
+		a.updateStatusText(fmt.Sprintf("Setting wallpaper on %s: %s", target, selectedWP.Name))
 
-		err := a.wallpaperService.SetWallpaper(selectedWP.Path)
+		var err error
+		if a.spanOutputs {
+			err = a.wallpaperService.SpanWallpaperWithTransition(selectedWP.Path, a.transition)
+		} else {
+			err = a.wallpaperService.ApplyWallpaper(a.selectedOutput, selectedWP.Path, a.transition)
+		}
 		if err != nil {
 			a.showError(fmt.Sprintf("Error setting wallpaper: %v", err))
 		} else {
-			a.updateStatusText(fmt.Sprintf("Wallpaper set: %s", selectedWP.Name))
+			a.updateStatusText(fmt.Sprintf("Wallpaper set on %s: %s", target, selectedWP.Name))
+			a.listManager.RefreshLastUsed()
 		}
 	}
 }
@@ -218,54 +381,327 @@ func (a *App) navigateWallpaper(delta int) {
 
 func (a *App) createSetButton() *widget.Button {
 	return widget.NewButton("Set as Wallpaper", func() {
-		if selectedWP := a.listManager.GetSelectedWallpaper(); selectedWP != nil {
-			a.updateStatusText(fmt.Sprintf("Setting wallpaper: %s", selectedWP.Name))
+		a.setCurrentWallpaper()
+	})
+}
 
-			err := a.wallpaperService.SetWallpaper(selectedWP.Path)
-			if err != nil {
-				a.showError(fmt.Sprintf("Error setting wallpaper: %v", err))
-			} else {
-				a.updateStatusText(fmt.Sprintf("Wallpaper set: %s", selectedWP.Name))
-			}
+func (a *App) createOutputSelect() *widget.Select {
+	outputSelect := widget.NewSelect([]string{allOutputsLabel}, func(selected string) {
+		a.spanOutputs = selected == spanOutputsLabel
+		if selected == allOutputsLabel || a.spanOutputs {
+			a.selectedOutput = ""
+		} else {
+			a.selectedOutput = selected
 		}
+		a.updateAspectFilter()
 	})
+	outputSelect.SetSelected(allOutputsLabel)
+	a.refreshOutputs(outputSelect)
+	return outputSelect
+}
+
+func (a *App) createTransitionSelect() *widget.Select {
+	options := make([]string, 0, len(service.TransitionTypes))
+	for _, t := range service.TransitionTypes {
+		options = append(options, string(t))
+	}
+
+	transitionSelect := widget.NewSelect(options, func(selected string) {
+		a.transition = a.wallpaperService.DefaultTransition.WithType(service.TransitionType(selected))
+	})
+	transitionSelect.SetSelected(string(a.transition.Type))
+
+	if backend := a.wallpaperService.Backend; backend == nil || !backend.Capabilities().Transitions {
+		transitionSelect.Disable()
+	}
+	return transitionSelect
+}
+
+// refreshOutputs fills outputSelect with the backend's outputs. Backends that
+// can only set every output at once leave the selector disabled.
+func (a *App) refreshOutputs(outputSelect *widget.Select) {
+	options := []string{allOutputsLabel}
+
+	backend := a.wallpaperService.Backend
+	if backend == nil || !backend.Capabilities().MultiOutput {
+		a.outputs = nil
+		a.updateAspectFilter()
+		outputSelect.SetOptions(options)
+		outputSelect.SetSelected(allOutputsLabel)
+		outputSelect.Disable()
+		return
+	}
+
+	outputs, err := a.wallpaperService.Outputs()
+	if err != nil {
+		a.updateStatusText(fmt.Sprintf("Could not list outputs: %v", err))
+	}
+	a.outputs = outputs
+	a.updateAspectFilter()
+	if len(outputs) > 1 {
+		options = append(options, spanOutputsLabel)
+	}
+	for _, output := range outputs {
+		options = append(options, output.Name)
+	}
+	outputSelect.SetOptions(options)
+
+	if !slices.Contains(options, outputSelect.Selected) {
+		outputSelect.SetSelected(allOutputsLabel)
+	}
+	outputSelect.Enable()
+}
+
+// createViewButton switches between the list and the thumbnail grid. Its
+// icon shows the view it switches to.
+func (a *App) createViewButton() *widget.Button {
+	viewBtn := widget.NewButtonWithIcon("", theme.GridIcon(), nil)
+	updateIcon := func() {
+		if a.listManager.IsGridView() {
+			viewBtn.SetIcon(theme.ListIcon())
+		} else {
+			viewBtn.SetIcon(theme.GridIcon())
+		}
+	}
+	viewBtn.OnTapped = func() {
+		a.listManager.SetGridView(!a.listManager.IsGridView())
+		updateIcon()
+	}
+	updateIcon()
+	return viewBtn
+}
+
+// createTagQueryEntry filters the list by a tag query as it is typed. While
+// the query is incomplete or invalid, the list stays as it was.
+func (a *App) createTagQueryEntry() *widget.Entry {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("dark AND NOT anime")
+	entry.Validator = func(text string) error {
+		_, err := service.ParseTagQuery(text)
+		return err
+	}
+	entry.OnChanged = func(text string) {
+		if query, err := service.ParseTagQuery(text); err == nil {
+			a.listManager.SetTagQuery(query)
+		}
+	}
+	return entry
+}
+
+// createSearchEntry filters the list by file name as it is typed. The up and
+// down keys move through the results without leaving the entry.
+func (a *App) createSearchEntry() *searchEntry {
+	entry := newSearchEntry(a.navigateWallpaper)
+	entry.SetPlaceHolder("Search file names")
+	entry.OnChanged = a.listManager.SetSearch
+	entry.OnSubmitted = func(string) { a.setCurrentWallpaper() }
+	return entry
 }
 
-func (a *App) createChangeFolderButton() *widget.Button {
-	return widget.NewButton("Change Folder", func() {
-		a.listManager.ShowFolderDialog(a.mainWindow, func(newPath string) {
-			a.wallpaperService.UpdateWallpaperDirectory(newPath)
-			a.folderLabel.SetText(fmt.Sprintf("Current folder: %s", newPath))
+// createSortControls returns the sort order selector and the button that
+// flips its direction, whose icon shows the current direction.
+func (a *App) createSortControls() (*widget.Select, *widget.Button) {
+	options := make([]string, len(config.SortOrders))
+	for i, order := range config.SortOrders {
+		options[i] = sortLabels[order]
+	}
 
-			a.refreshWallpapers()
+	order, _ := a.listManager.Sort()
+	sortSelect := widget.NewSelect(options, nil)
+	sortSelect.SetSelected(sortLabels[order])
+	sortSelect.OnChanged = func(selected string) {
+		for order, label := range sortLabels {
+			if label == selected {
+				_, descending := a.listManager.Sort()
+				a.listManager.SetSort(order, descending)
+			}
+		}
+	}
 
-			a.updateStatusText(fmt.Sprintf("Changed folder to: %s", newPath))
-		})
+	directionBtn := widget.NewButtonWithIcon("", theme.MenuDropUpIcon(), nil)
+	updateIcon := func() {
+		if _, descending := a.listManager.Sort(); descending {
+			directionBtn.SetIcon(theme.MenuDropDownIcon())
+		} else {
+			directionBtn.SetIcon(theme.MenuDropUpIcon())
+		}
+	}
+	directionBtn.OnTapped = func() {
+		order, descending := a.listManager.Sort()
+		a.listManager.SetSort(order, !descending)
+		updateIcon()
+	}
+	updateIcon()
+	return sortSelect, directionBtn
+}
+
+func (a *App) createOrientationSelect() *widget.Select {
+	orientationSelect := widget.NewSelect([]string{anyOrientationLabel, "Landscape", "Portrait", "Square"}, func(selected string) {
+		a.listManager.SetOrientation(orientationLabels[selected])
+	})
+	orientationSelect.SetSelected(anyOrientationLabel)
+	return orientationSelect
+}
+
+func (a *App) createMinResolutionSelect() *widget.Select {
+	options := make([]string, len(minResolutions))
+	for i, r := range minResolutions {
+		options[i] = r.label
+	}
+	minResolutionSelect := widget.NewSelect(options, func(selected string) {
+		for _, r := range minResolutions {
+			if r.label == selected {
+				a.listManager.SetMinResolution(r.width, r.height)
+			}
+		}
 	})
+	minResolutionSelect.SetSelected(options[0])
+	return minResolutionSelect
+}
+
+// updateAspectFilter shows only the wallpapers shaped like the monitor the
+// wallpaper would be set on, while "Match monitor" is checked: the selected
+// output, any output for all outputs, or all of them together when spanning.
+// Without known outputs the check is disabled.
+func (a *App) updateAspectFilter() {
+	if a.matchMonitor == nil || a.listManager == nil {
+		return
+	}
+	if len(a.outputs) == 0 {
+		a.matchMonitor.Disable()
+	} else {
+		a.matchMonitor.Enable()
+	}
+	if !a.matchMonitor.Checked || len(a.outputs) == 0 {
+		a.listManager.SetAspectRatios(nil)
+		return
+	}
+
+	var ratios []float64
+	switch {
+	case a.spanOutputs:
+		minX, minY, maxX, maxY := math.MaxInt, math.MaxInt, math.MinInt, math.MinInt
+		for _, output := range a.outputs {
+			width, height := output.LogicalSize()
+			minX, minY = min(minX, output.X), min(minY, output.Y)
+			maxX, maxY = max(maxX, output.X+width), max(maxY, output.Y+height)
+		}
+		if maxX > minX && maxY > minY {
+			ratios = append(ratios, float64(maxX-minX)/float64(maxY-minY))
+		}
+	default:
+		for _, output := range a.outputs {
+			if a.selectedOutput != "" && output.Name != a.selectedOutput {
+				continue
+			}
+			if width, height := output.LogicalSize(); width > 0 && height > 0 {
+				ratios = append(ratios, float64(width)/float64(height))
+			}
+		}
+	}
+	a.listManager.SetAspectRatios(ratios)
+}
+
+func (a *App) createRotationControls() *RotationControls {
+	controls := NewRotationControls(service.NewRotation(a.wallpaperService, a.config.RotationOptions()))
+	controls.OnSkipped = func() {
+		a.updateStatusText("Skipped to the next wallpaper of the rotation")
+		a.listManager.RefreshLastUsed()
+	}
+	controls.OnError = func(err error) {
+		a.showError(fmt.Sprintf("Error controlling the rotation: %v", err))
+	}
+	return controls
 }
 
 func (a *App) createRefreshButton() *widget.Button {
 	return widget.NewButton("Refresh", func() {
+		a.refreshOutputs(a.outputSelect)
 		a.refreshWallpapers()
+		a.rotation.Refresh()
 	})
 }
 
 func (a *App) refreshWallpapers() {
+	a.stopWatching()
 	a.updateStatusText("Loading wallpapers...")
-	err := a.listManager.LoadWallpapers()
+	a.listManager.LoadWallpapers(func(scan service.LibraryScan, err error) {
+		a.unavailableRoots = scan.Unavailable
+		if err != nil {
+			a.showError(fmt.Sprintf("Error loading wallpapers: %v", err))
+			return
+		}
 
-	if err != nil {
-		a.showError(fmt.Sprintf("Error loading wallpapers: %v", err))
-	} else {
 		wallpaperCount := a.listManager.GetWallpaperCount()
-		a.updateStatusText(fmt.Sprintf("Found %d wallpapers", wallpaperCount))
+		status := fmt.Sprintf("Found %d wallpapers", wallpaperCount)
+		if len(scan.Unavailable) > 0 {
+			status += fmt.Sprintf(" (%d folder(s) unavailable)", len(scan.Unavailable))
+		}
+		a.updateStatusText(status)
 
-		if wallpaperCount > 0 {
-			a.listManager.SelectWallpaper(0)
-		} else {
-			a.previewManager.ClearPreview()
+		if a.listManager.GetSelectedWallpaper() == nil {
+			if wallpaperCount > 0 {
+				a.listManager.SelectWallpaper(0)
+			} else {
+				a.previewManager.ClearPreview()
+			}
 		}
+
+		a.watchWallpapers(scan)
+	})
+}
+
+// watchWallpapers keeps the list up to date with changes below the folders
+// of scan until the next refresh.
+func (a *App) watchWallpapers(scan service.LibraryScan) {
+	watcher, err := a.wallpaperService.WatchLibrary(scan, func(change service.LibraryChange) {
+		fyne.Do(func() { a.applyLibraryChange(change) })
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not watching wallpaper folders: %v\n", err)
+		return
+	}
+	a.watcher = watcher
+}
+
+func (a *App) stopWatching() {
+	if a.watcher != nil {
+		a.watcher.Close()
+		a.watcher = nil
+	}
+}
+
+func (a *App) applyLibraryChange(change service.LibraryChange) {
+	if change.Rescan {
+		a.refreshWallpapers()
+		return
+	}
+
+	stale := slices.Clone(change.Removed)
+	for oldPath := range change.Renamed {
+		stale = append(stale, oldPath)
+	}
+	for _, wp := range change.Added {
+		stale = append(stale, wp.Path)
+	}
+	a.previewManager.Forget(stale...)
+
+	a.listManager.ApplyChange(change)
+	if a.listManager.GetSelectedWallpaper() == nil {
+		a.previewManager.ClearPreview()
+	}
+
+	var parts []string
+	if n := len(change.Added); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d added or changed", n))
+	}
+	if n := len(change.Renamed); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d moved", n))
+	}
+	if n := len(change.Removed); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d removed", n))
 	}
+	a.updateStatusText(fmt.Sprintf("Library updated: %s (%d wallpapers)", strings.Join(parts, ", "), a.listManager.GetWallpaperCount()))
 }
 
 func (a *App) updateStatusText(text string) {
@@ -0,0 +1,230 @@
+package ui
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/hambosto/wallpaper-manager/internal/config"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// aspectTolerance is how far, relative to a monitor's aspect ratio, that of a
+// wallpaper may be for it to count as matching the monitor.
+const aspectTolerance = 0.03
+
+// SetSearch shows only the wallpapers whose file name fuzzily matches query,
+// best matches first.
+func (l *ListManager) SetSearch(query string) {
+	l.search = strings.TrimSpace(query)
+	l.applyFilter()
+}
+
+// SetSort orders the wallpapers by one of config.SortOrders.
+func (l *ListManager) SetSort(order string, descending bool) {
+	l.sortOrder, l.sortDescending = order, descending
+	if order == config.SortLastUsed {
+		l.RefreshLastUsed()
+		return
+	}
+	l.applyFilter()
+}
+
+// Sort returns the sort order and whether it is descending.
+func (l *ListManager) Sort() (string, bool) {
+	return l.sortOrder, l.sortDescending
+}
+
+// RefreshLastUsed reads again when each wallpaper was last used, such as
+// after setting one, if the list is sorted by it.
+func (l *ListManager) RefreshLastUsed() {
+	if l.sortOrder != config.SortLastUsed {
+		return
+	}
+	// An unreadable history sorts as if nothing was used; the History
+	// window reports why.
+	l.lastUsed, _ = service.LastUsed()
+	l.applyFilter()
+}
+
+// SetOrientation shows only the wallpapers with orientation, or all of them
+// when it is empty.
+func (l *ListManager) SetOrientation(orientation model.Orientation) {
+	l.orientation = orientation
+	l.applyFilter()
+}
+
+// SetMinResolution shows only the wallpapers at least width × height in
+// either orientation, or all of them when both are 0.
+func (l *ListManager) SetMinResolution(width, height int) {
+	l.minLongSide, l.minShortSide = max(width, height), min(width, height)
+	l.applyFilter()
+}
+
+// SetAspectRatios shows only the wallpapers whose aspect ratio is close to
+// one of ratios, such as those of the monitors, or all of them when there
+// are none.
+func (l *ListManager) SetAspectRatios(ratios []float64) {
+	l.aspectRatios = ratios
+	l.applyFilter()
+}
+
+// filtered returns the wallpapers that pass every filter, in the order they
+// are shown.
+func (l *ListManager) filtered() []model.Wallpaper {
+	if l.needsMetadata() {
+		l.loadMetadata()
+	}
+
+	var matches []listMatch
+	for i, wp := range l.allWallpapers {
+		if l.rootFilter != "" && wp.Root != l.rootFilter {
+			continue
+		}
+		if l.favoritesOnly && l.annotations != nil && !l.annotations.Get(wp.Path).Favorite {
+			continue
+		}
+		if !l.tagQuery.Match(wp.Tags) || !l.matchesImage(wp) {
+			continue
+		}
+		score, ok := fuzzyScore(l.search, wp.Name)
+		if !ok {
+			continue
+		}
+		matches = append(matches, listMatch{wp: wp, index: i, score: score})
+	}
+
+	slices.SortFunc(matches, func(a, b listMatch) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), l.compare(a, b))
+	})
+
+	wallpapers := make([]model.Wallpaper, len(matches))
+	for i, m := range matches {
+		wallpapers[i] = m.wp
+	}
+	return wallpapers
+}
+
+// listMatch is a wallpaper that passed the filters, with its position in the
+// library and how well it matches the search.
+type listMatch struct {
+	wp    model.Wallpaper
+	index int
+	score int
+}
+
+// compare orders a and b by the sort order, keeping the library order
+// between equal ones. Wallpapers without a value to sort by, such as those
+// never used when sorting by last use, come last in either direction.
+func (l *ListManager) compare(a, b listMatch) int {
+	c := 0
+	switch l.sortOrder {
+	case config.SortName:
+		c = cmp.Compare(strings.ToLower(a.wp.Name), strings.ToLower(b.wp.Name))
+	case config.SortDate:
+		c = a.wp.ModTime.Compare(b.wp.ModTime)
+	case config.SortSize:
+		c = cmp.Compare(a.wp.Size, b.wp.Size)
+	case config.SortResolution:
+		ma, mb := l.metadata.Cached(a.wp), l.metadata.Cached(b.wp)
+		if ma == nil || mb == nil {
+			return cmp.Or(unknownLast(ma != nil, mb != nil), cmp.Compare(a.index, b.index))
+		}
+		c = cmp.Compare(ma.Width*ma.Height, mb.Width*mb.Height)
+	case config.SortLastUsed:
+		ta, okA := l.lastUsed[a.wp.Path]
+		tb, okB := l.lastUsed[b.wp.Path]
+		if !okA || !okB {
+			return cmp.Or(unknownLast(okA, okB), cmp.Compare(a.index, b.index))
+		}
+		c = ta.Compare(tb)
+	case config.SortRating:
+		if l.annotations != nil {
+			ra, rb := l.annotations.Get(a.wp.Path), l.annotations.Get(b.wp.Path)
+			c = cmp.Or(compareBool(ra.Favorite, rb.Favorite), cmp.Compare(ra.Stars, rb.Stars))
+		}
+	default:
+		c = cmp.Compare(a.index, b.index)
+	}
+
+	if l.sortDescending {
+		c = -c
+	}
+	return cmp.Or(c, cmp.Compare(a.index, b.index))
+}
+
+// unknownLast orders a known value before an unknown one.
+func unknownLast(aKnown, bKnown bool) int {
+	return compareBool(bKnown, aKnown)
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// needsMetadata reports whether the filters or sort order need the
+// dimensions of every wallpaper.
+func (l *ListManager) needsMetadata() bool {
+	return l.sortOrder == config.SortResolution || l.orientation != "" || l.minLongSide > 0 || len(l.aspectRatios) > 0
+}
+
+// matchesImage reports whether wp passes the filters on its dimensions.
+func (l *ListManager) matchesImage(wp model.Wallpaper) bool {
+	if l.orientation == "" && l.minLongSide == 0 && len(l.aspectRatios) == 0 {
+		return true
+	}
+
+	m := l.metadata.Cached(wp)
+	if m == nil {
+		// Until the library has been read, the wallpapers not read yet
+		// are shown as long as they can be decoded.
+		return !l.metadataLoaded && wp.Unsupported == ""
+	}
+	if l.orientation != "" && m.Orientation != l.orientation {
+		return false
+	}
+	if max(m.Width, m.Height) < l.minLongSide || min(m.Width, m.Height) < l.minShortSide {
+		return false
+	}
+	if len(l.aspectRatios) > 0 && !slices.ContainsFunc(l.aspectRatios, func(ratio float64) bool {
+		return math.Abs(m.AspectRatio-ratio) <= ratio*aspectTolerance
+	}) {
+		return false
+	}
+	return true
+}
+
+// loadMetadata reads the metadata of the whole library in the background,
+// unless it already has been, and filters the list again once it is done.
+func (l *ListManager) loadMetadata() {
+	if l.metadataLoaded || l.cancelMetadata != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancelMetadata = cancel
+	l.metadata.LoadAll(ctx, l.allWallpapers, func() {
+		l.cancelMetadata = nil
+		l.metadataLoaded = true
+		l.applyFilter()
+	})
+}
+
+// setLibrary replaces the wallpapers the list is filtered from, without
+// filtering it yet.
+func (l *ListManager) setLibrary(wallpapers []model.Wallpaper) {
+	l.allWallpapers = wallpapers
+	if l.cancelMetadata != nil {
+		l.cancelMetadata()
+		l.cancelMetadata = nil
+	}
+	l.metadataLoaded = false
+}
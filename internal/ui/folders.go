@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+const allFoldersLabel = "All folders"
+
+// createRootSelect filters the list to one library root.
+func (a *App) createRootSelect() *widget.Select {
+	rootSelect := widget.NewSelect(nil, func(selected string) {
+		filter := selected
+		if selected == allFoldersLabel {
+			filter = ""
+		}
+		a.listManager.SetRootFilter(filter)
+
+		if a.listManager.GetSelectedWallpaper() != nil {
+			return
+		}
+		if a.listManager.GetWallpaperCount() > 0 {
+			a.listManager.SelectWallpaper(0)
+		} else {
+			a.previewManager.ClearPreview()
+		}
+	})
+	a.refreshRootSelect(rootSelect)
+	return rootSelect
+}
+
+func (a *App) refreshRootSelect(rootSelect *widget.Select) {
+	options := []string{allFoldersLabel}
+	for _, root := range a.wallpaperService.Roots {
+		options = append(options, root.Label)
+	}
+	rootSelect.SetOptions(options)
+
+	if !slices.Contains(options, rootSelect.Selected) {
+		rootSelect.SetSelected(allFoldersLabel)
+	}
+	if len(options) > 2 {
+		rootSelect.Enable()
+	} else {
+		rootSelect.Disable()
+	}
+}
+
+// setRoots replaces the library roots, saves them and rescans.
+func (a *App) setRoots(roots []service.LibraryRoot) {
+	a.config.SetRoots(roots)
+	a.wallpaperService.SetRoots(a.config.Roots())
+	a.refreshRootSelect(a.rootSelect)
+	a.refreshWallpapers()
+
+	if err := a.config.Save(); err != nil {
+		a.showError(fmt.Sprintf("Error saving config: %v", err))
+	}
+}
+
+// showFoldersWindow lists the library roots, marking the ones that could not
+// be read during the last scan, and lets roots be added and removed.
+func (a *App) showFoldersWindow() {
+	foldersWindow := a.fyneApp.NewWindow("Wallpaper Folders")
+	foldersWindow.Resize(fyne.NewSize(560, 360))
+
+	var list *widget.List
+	list = widget.NewList(
+		func() int {
+			return len(a.wallpaperService.Roots)
+		},
+		func() fyne.CanvasObject {
+			path := widget.NewLabel("Path")
+			path.Importance = widget.LowImportance
+			path.Truncation = fyne.TextTruncateEllipsis
+
+			return container.NewBorder(
+				nil,
+				nil,
+				nil,
+				widget.NewButton("Remove", nil),
+				container.NewVBox(widget.NewLabel("Label"), path),
+			)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			root := a.wallpaperService.Roots[id]
+			row := item.(*fyne.Container)
+
+			label := root.Label
+			for _, unavailable := range a.unavailableRoots {
+				if unavailable.Root.Path == root.Path {
+					label += " (unavailable)"
+				}
+			}
+
+			labels := row.Objects[0].(*fyne.Container)
+			labels.Objects[0].(*widget.Label).SetText(label)
+			labels.Objects[1].(*widget.Label).SetText(root.Path)
+
+			removeBtn := row.Objects[1].(*widget.Button)
+			removeBtn.OnTapped = func() {
+				roots := slices.Delete(slices.Clone(a.wallpaperService.Roots), id, id+1)
+				a.setRoots(roots)
+				list.Refresh()
+			}
+			if len(a.wallpaperService.Roots) > 1 {
+				removeBtn.Enable()
+			} else {
+				removeBtn.Disable()
+			}
+		},
+	)
+
+	addBtn := widget.NewButton("Add Folder", func() {
+		a.listManager.ShowFolderDialog(foldersWindow, func(newPath string) {
+			for _, root := range a.wallpaperService.Roots {
+				if root.Path == newPath {
+					return
+				}
+			}
+
+			roots := append(slices.Clone(a.wallpaperService.Roots), service.LibraryRoot{Path: newPath})
+			a.setRoots(roots)
+			list.Refresh()
+			a.updateStatusText(fmt.Sprintf("Added folder: %s", newPath))
+		})
+	})
+	addBtn.Importance = widget.HighImportance
+
+	foldersWindow.SetContent(container.NewBorder(
+		nil,
+		container.NewCenter(container.NewHBox(
+			addBtn,
+			widget.NewButton("Close", func() { foldersWindow.Close() }),
+		)),
+		nil,
+		nil,
+		list,
+	))
+	foldersWindow.CenterOnScreen()
+	foldersWindow.Show()
+}
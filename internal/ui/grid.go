@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"context"
+	"image"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// newGrid shows the same wallpapers as the list as thumbnails. Thumbnails
+// are only requested for the cells being shown, which are the ones the grid
+// updates.
+func (l *ListManager) newGrid() *widget.GridWrap {
+	grid := widget.NewGridWrap(
+		func() int {
+			return len(l.wallpapers)
+		},
+		func() fyne.CanvasObject {
+			return newThumbnailCell(float32(l.thumbnails.size))
+		},
+		func(id widget.GridWrapItemID, item fyne.CanvasObject) {
+			item.(*thumbnailCell).show(l.wallpapers[id], l.thumbnails)
+		},
+	)
+	grid.OnSelected = l.selected
+	return grid
+}
+
+// thumbnailCell is a thumbnail with the file name under it.
+type thumbnailCell struct {
+	widget.BaseWidget
+	image *canvas.Image
+	label *widget.Label
+
+	wp     model.Wallpaper
+	loaded bool
+	cancel context.CancelFunc
+}
+
+func newThumbnailCell(size float32) *thumbnailCell {
+	img := canvas.NewImageFromResource(theme.FileImageIcon())
+	img.FillMode = canvas.ImageFillContain
+	img.ScaleMode = canvas.ImageScaleSmooth
+	img.SetMinSize(fyne.NewSquareSize(size))
+
+	label := widget.NewLabel("")
+	label.Alignment = fyne.TextAlignCenter
+	label.Truncation = fyne.TextTruncateEllipsis
+
+	c := &thumbnailCell{image: img, label: label}
+	c.ExtendBaseWidget(c)
+	return c
+}
+
+func (c *thumbnailCell) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewBorder(nil, c.label, nil, nil, c.image))
+}
+
+// show binds the cell to wp, cancelling the thumbnail requested for the
+// wallpaper it showed before.
+func (c *thumbnailCell) show(wp model.Wallpaper, thumbnails *ThumbnailLoader) {
+	c.label.SetText(wp.Name)
+	if c.loaded && c.wp.Path == wp.Path && c.wp.Size == wp.Size && c.wp.ModTime.Equal(wp.ModTime) {
+		return
+	}
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wp = wp
+	c.loaded = false
+
+	img, ok, cancel := thumbnails.Get(wp, c.setImage)
+	c.cancel = cancel
+	if ok {
+		c.setImage(img)
+		return
+	}
+	c.image.Image = nil
+	c.image.Resource = theme.FileImageIcon()
+	c.image.Refresh()
+}
+
+// setImage shows img, or a broken image icon when there is no thumbnail.
+func (c *thumbnailCell) setImage(img image.Image) {
+	c.loaded = true
+	c.cancel = nil
+	if img == nil {
+		c.image.Image = nil
+		c.image.Resource = theme.BrokenImageIcon()
+	} else {
+		c.image.Resource = nil
+		c.image.Image = img
+	}
+	c.image.Refresh()
+}
@@ -0,0 +1,135 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+const (
+	historyViewLimit = 100
+	thumbnailWidth   = 96
+	thumbnailHeight  = 54
+)
+
+// showHistoryWindow lists recently set wallpapers, newest first, each with a
+// button to apply it again.
+func (a *App) showHistoryWindow() {
+	history, err := service.LoadHistory()
+	if err != nil {
+		a.showError(fmt.Sprintf("Error loading history: %v", err))
+		return
+	}
+	entries := history.Recent(historyViewLimit)
+
+	historyWindow := a.fyneApp.NewWindow("Wallpaper History")
+	historyWindow.Resize(fyne.NewSize(560, 480))
+
+	var list *widget.List
+	list = widget.NewList(
+		func() int {
+			return len(entries)
+		},
+		func() fyne.CanvasObject {
+			thumb := canvas.NewImageFromImage(nil)
+			thumb.FillMode = canvas.ImageFillContain
+			thumb.SetMinSize(fyne.NewSize(thumbnailWidth, thumbnailHeight))
+
+			return container.NewBorder(
+				nil,
+				nil,
+				thumb,
+				widget.NewButton("Apply", nil),
+				container.NewVBox(widget.NewLabel("Name"), widget.NewLabel("Details")),
+			)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			entry := entries[id]
+			row := item.(*fyne.Container)
+
+			labels := row.Objects[0].(*fyne.Container)
+			labels.Objects[0].(*widget.Label).SetText(filepath.Base(entry.Path))
+			labels.Objects[1].(*widget.Label).SetText(historyEntryDetails(entry))
+
+			thumb := row.Objects[1].(*canvas.Image)
+			thumb.Image, _, _ = a.thumbnails.Get(model.Wallpaper{Path: entry.Path}, func(image.Image) { list.RefreshItem(id) })
+			thumb.Refresh()
+
+			row.Objects[2].(*widget.Button).OnTapped = func() {
+				a.reapplyHistoryEntry(entry)
+
+				if history, err := service.LoadHistory(); err == nil {
+					entries = history.Recent(historyViewLimit)
+					list.Refresh()
+				}
+			}
+		},
+	)
+
+	var content fyne.CanvasObject = list
+	if len(entries) == 0 {
+		content = container.NewCenter(widget.NewLabel("No wallpapers have been set yet."))
+	}
+
+	historyWindow.SetContent(container.NewBorder(
+		nil,
+		container.NewCenter(widget.NewButton("Close", func() { historyWindow.Close() })),
+		nil,
+		nil,
+		content,
+	))
+	historyWindow.CenterOnScreen()
+	historyWindow.Show()
+}
+
+func historyEntryDetails(entry service.HistoryEntry) string {
+	output := entry.Output
+	if output == "" {
+		output = allOutputsLabel
+	}
+	return fmt.Sprintf("%s • %s", output, entry.SetAt.Local().Format(time.DateTime))
+}
+
+func (a *App) reapplyHistoryEntry(entry service.HistoryEntry) {
+	name := filepath.Base(entry.Path)
+	if err := a.wallpaperService.ReapplyHistoryEntry(entry); err != nil {
+		a.showError(fmt.Sprintf("Error setting wallpaper: %v", err))
+		return
+	}
+	a.updateStatusText(fmt.Sprintf("Wallpaper set: %s", name))
+}
+
+// stepHistory undoes or redoes the last change on the selected output. When
+// spanning, every output steps back together.
+func (a *App) stepHistory(undo bool) {
+	output := a.selectedOutput
+	if a.spanOutputs {
+		output = ""
+	}
+
+	action := "Redo"
+	if undo {
+		action = "Undo"
+	}
+
+	var wp *service.ActiveWallpaper
+	var err error
+	if undo {
+		wp, err = a.wallpaperService.Undo(output)
+	} else {
+		wp, err = a.wallpaperService.Redo(output)
+	}
+	if err != nil {
+		a.updateStatusText(fmt.Sprintf("%s: %v", action, err))
+		return
+	}
+	a.updateStatusText(fmt.Sprintf("%s: wallpaper set to %s", action, filepath.Base(wp.Path)))
+}
@@ -1,25 +1,69 @@
 package ui
 
 import (
+	"cmp"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/config"
 	"github.com/hambosto/wallpaper-manager/internal/model"
 	"github.com/hambosto/wallpaper-manager/internal/service"
 )
 
+// ListManager shows the library, optionally filtered to one root, to the
+// favorites, by a tag query, by a search on file names or by the dimensions
+// of the images, and sorted, as a list of names or a grid of thumbnails.
+// Indexes refer to the filtered list.
 type ListManager struct {
 	wallpaperService  *service.WallpaperService
+	metadata          *MetadataLoader
+	thumbnails        *ThumbnailLoader
+	annotations       *service.Annotations
+	allWallpapers     []model.Wallpaper
 	wallpapers        []model.Wallpaper
+	rootFilter        string
+	favoritesOnly     bool
+	tagQuery          *service.TagQuery
+	search            string
+	sortOrder         string
+	sortDescending    bool
+	lastUsed          map[string]time.Time
+	orientation       model.Orientation
+	minLongSide       int
+	minShortSide      int
+	aspectRatios      []float64
+	metadataLoaded    bool
+	cancelMetadata    context.CancelFunc
 	wallpaperList     *widget.List
+	wallpaperGrid     *widget.GridWrap
+	gridView          bool
+	view              *fyne.Container
 	selectedIndex     int
 	onSelectionChange func(int)
+	cancelScan        context.CancelFunc
+
+	// OnError is called with errors saving annotations.
+	OnError func(error)
 }
 
-func NewListManager(wallpaperServ *service.WallpaperService, onSelectionChange func(int)) *ListManager {
+func NewListManager(wallpaperServ *service.WallpaperService, metadata *MetadataLoader, thumbnails *ThumbnailLoader, onSelectionChange func(int)) *ListManager {
+	// Without readable annotations, rating and tagging are disabled rather
+	// than risking overwriting them; the app reports why.
+	annotations, _ := wallpaperServ.Annotations()
+
 	lm := &ListManager{
 		wallpaperService:  wallpaperServ,
+		metadata:          metadata,
+		thumbnails:        thumbnails,
+		annotations:       annotations,
 		wallpapers:        []model.Wallpaper{},
 		selectedIndex:     -1,
 		onSelectionChange: onSelectionChange,
@@ -30,32 +74,325 @@ func NewListManager(wallpaperServ *service.WallpaperService, onSelectionChange f
 			return len(lm.wallpapers)
 		},
 		func() fyne.CanvasObject {
-			return widget.NewLabel("Template")
+			folder := widget.NewLabel("Folder")
+			folder.Importance = widget.LowImportance
+			favoriteBtn := widget.NewButtonWithIcon("", notFavorite, nil)
+			favoriteBtn.Importance = widget.LowImportance
+			return container.NewBorder(nil, nil, favoriteBtn, container.NewHBox(folder, newStarRating()), widget.NewLabel("Template"))
 		},
 		func(id widget.ListItemID, item fyne.CanvasObject) {
-			item.(*widget.Label).SetText(lm.wallpapers[id].Name)
+			wp := lm.wallpapers[id]
+			folder := wp.Dir
+			if len(lm.wallpaperService.Roots) > 1 && lm.rootFilter == "" {
+				folder = path.Join(wp.Root, wp.Dir)
+			}
+
+			row := item.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(wp.Name)
+			lm.updateRatingControls(row, id, wp)
+
+			detail := row.Objects[2].(*fyne.Container).Objects[0].(*widget.Label)
+			detail.Importance = widget.LowImportance
+			text := folder
+			if metadata := lm.metadata.Get(wp, func() { lm.wallpaperList.RefreshItem(id) }); metadata != nil {
+				text = fmt.Sprintf("%d×%d", metadata.Width, metadata.Height)
+				if folder != "" {
+					text += " • " + folder
+				}
+			}
+			if wp.Unsupported != "" {
+				detail.Importance = widget.WarningImportance
+				text = wp.Unsupported
+			}
+			detail.SetText(text)
 		},
 	)
 
-	lm.wallpaperList.OnSelected = func(id widget.ListItemID) {
-		lm.selectedIndex = id
-		if lm.onSelectionChange != nil {
-			lm.onSelectionChange(id)
+	lm.wallpaperList.OnSelected = lm.selected
+
+	lm.wallpaperGrid = lm.newGrid()
+	lm.wallpaperGrid.Hide()
+	lm.view = container.NewStack(lm.wallpaperList, lm.wallpaperGrid)
+
+	return lm
+}
+
+func (l *ListManager) selected(id int) {
+	l.selectedIndex = id
+	if l.onSelectionChange != nil {
+		l.onSelectionChange(id)
+	}
+}
+
+// SetGridView switches between the list and the thumbnail grid, keeping the
+// selection. Thumbnails still queued for the grid are cancelled when it is
+// hidden.
+func (l *ListManager) SetGridView(grid bool) {
+	if grid == l.gridView {
+		return
+	}
+	l.gridView = grid
+
+	if grid {
+		l.wallpaperList.Hide()
+		l.wallpaperList.UnselectAll()
+		l.wallpaperGrid.Show()
+	} else {
+		l.thumbnails.CancelAll()
+		l.wallpaperGrid.Hide()
+		l.wallpaperGrid.UnselectAll()
+		l.wallpaperList.Show()
+	}
+	l.SelectWallpaper(l.selectedIndex)
+}
+
+func (l *ListManager) IsGridView() bool {
+	return l.gridView
+}
+
+// LoadWallpapers rescans the library in the background, cancelling a scan
+// that is still running, and calls onDone on the UI goroutine with the scan
+// once the list has been updated.
+func (l *ListManager) LoadWallpapers(onDone func(scan service.LibraryScan, err error)) {
+	if l.cancelScan != nil {
+		l.cancelScan()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancelScan = cancel
+
+	roots, opts, index := l.wallpaperService.Roots, l.wallpaperService.Scan, l.wallpaperService.Index
+	firstLoad := len(l.allWallpapers) == 0
+	go func() {
+		// Show the indexed library right away on startup, then replace it
+		// with what the scan finds.
+		if firstLoad && index != nil {
+			if indexed, err := index.Wallpapers(roots); err == nil && len(indexed) > 0 {
+				if l.annotations != nil {
+					l.annotations.FillTags(indexed)
+				}
+				fyne.Do(func() {
+					if ctx.Err() == nil {
+						l.setLibrary(indexed)
+						l.applyFilter()
+					}
+				})
+			}
 		}
+
+		scan, err := service.ScanLibrary(ctx, roots, opts, index)
+
+		// Follow rated and tagged images that were moved while the app was
+		// closed, and fill in the tags.
+		var annotationsErr error
+		if err == nil && l.annotations != nil {
+			annotationsErr = l.annotations.Relink(scan.Wallpapers)
+			l.annotations.FillTags(scan.Wallpapers)
+		}
+
+		fyne.Do(func() {
+			if ctx.Err() != nil {
+				return
+			}
+			cancel()
+
+			if annotationsErr != nil && l.OnError != nil {
+				l.OnError(annotationsErr)
+			}
+			if err == nil {
+				l.setLibrary(scan.Wallpapers)
+				l.applyFilter()
+			}
+			onDone(scan, err)
+		})
+	}()
+}
+
+// updateRatingControls shows the rating of wp, at index id, in its row.
+func (l *ListManager) updateRatingControls(row *fyne.Container, id int, wp model.Wallpaper) {
+	favoriteBtn := row.Objects[1].(*widget.Button)
+	stars := row.Objects[2].(*fyne.Container).Objects[1].(*starRating)
+	if l.annotations == nil {
+		favoriteBtn.Hide()
+		stars.Hide()
+		return
 	}
 
-	return lm
+	annotation := l.annotations.Get(wp.Path)
+	favoriteBtn.SetIcon(favoriteIcon(annotation.Favorite))
+	favoriteBtn.OnTapped = func() { l.ToggleFavorite(id) }
+	stars.SetRating(annotation.Stars)
+	stars.OnChanged = func(n int) { l.SetRating(id, n) }
+}
+
+// ToggleFavorite marks the wallpaper at index as a favorite, or unmarks it.
+func (l *ListManager) ToggleFavorite(index int) {
+	l.updateAnnotation(index, func(annotation *service.Annotation) {
+		annotation.Favorite = !annotation.Favorite
+	})
+}
+
+// SetRating gives the wallpaper at index stars, where 0 clears the rating.
+func (l *ListManager) SetRating(index, stars int) {
+	l.updateAnnotation(index, func(annotation *service.Annotation) {
+		annotation.Stars = stars
+	})
+}
+
+func (l *ListManager) updateAnnotation(index int, update func(*service.Annotation)) {
+	wp := l.GetWallpaper(index)
+	if wp == nil || l.annotations == nil {
+		return
+	}
+	if err := l.annotations.Update(*wp, update); err != nil {
+		if l.OnError != nil {
+			l.OnError(err)
+		}
+		return
+	}
+
+	if l.favoritesOnly || l.sortOrder == config.SortRating {
+		l.applyFilter()
+	} else {
+		l.wallpaperList.RefreshItem(index)
+	}
+}
+
+// SetFavoritesOnly shows only the favorites, or every wallpaper.
+func (l *ListManager) SetFavoritesOnly(favoritesOnly bool) {
+	l.favoritesOnly = favoritesOnly
+	l.applyFilter()
 }
 
-func (l *ListManager) LoadWallpapers() error {
-	wallpapers, err := l.wallpaperService.GetWallpapers()
-	if err != nil {
-		return err
+// SetTagQuery shows only the wallpapers whose tags match query, or every
+// wallpaper when query is nil.
+func (l *ListManager) SetTagQuery(query *service.TagQuery) {
+	l.tagQuery = query
+	l.applyFilter()
+}
+
+// SetTags records that the wallpaper at path now has tags, which takes it
+// out of the list if it no longer matches the tag query.
+func (l *ListManager) SetTags(path string, tags []string) {
+	for i := range l.allWallpapers {
+		if l.allWallpapers[i].Path == path {
+			l.allWallpapers[i].Tags = tags
+		}
+	}
+	if l.tagQuery != nil {
+		l.applyFilter()
+		return
+	}
+	for i := range l.wallpapers {
+		if l.wallpapers[i].Path == path {
+			l.wallpapers[i].Tags = tags
+		}
+	}
+}
+
+// SetRootFilter shows only the wallpapers of the root with label, or every
+// wallpaper when label is empty.
+func (l *ListManager) SetRootFilter(label string) {
+	l.rootFilter = label
+	l.applyFilter()
+}
+
+// ApplyChange updates the list with a batch of changes to the library. The
+// selection is kept, and follows the selected file when it is renamed, as do
+// the tags of changed and renamed files.
+func (l *ListManager) ApplyChange(change service.LibraryChange) {
+	selected := l.selectedPath()
+	if wp, ok := change.Renamed[selected]; ok {
+		selected = wp.Path
 	}
-	l.wallpapers = wallpapers
+
+	tags := make(map[string][]string)
+	for _, wp := range l.allWallpapers {
+		tags[wp.Path] = wp.Tags
+	}
+	for i := range change.Added {
+		if current, ok := tags[change.Added[i].Path]; ok {
+			change.Added[i].Tags = current
+		}
+	}
+	for oldPath, wp := range change.Renamed {
+		if current, ok := tags[oldPath]; ok {
+			wp.Tags = current
+			change.Renamed[oldPath] = wp
+		}
+	}
+
+	replaced := make(map[string]bool)
+	for _, p := range change.Removed {
+		replaced[p] = true
+	}
+	for oldPath, wp := range change.Renamed {
+		replaced[oldPath] = true
+		replaced[wp.Path] = true
+	}
+	for _, wp := range change.Added {
+		replaced[wp.Path] = true
+	}
+
+	wallpapers := make([]model.Wallpaper, 0, len(l.allWallpapers)+len(change.Added))
+	for _, wp := range l.allWallpapers {
+		if !replaced[wp.Path] {
+			wallpapers = append(wallpapers, wp)
+		}
+	}
+	wallpapers = append(wallpapers, change.Added...)
+	for _, wp := range change.Renamed {
+		wallpapers = append(wallpapers, wp)
+	}
+
+	// Keep the order of a scan: by root, then by path within the root.
+	rootOrder := make(map[string]int)
+	for i, root := range l.wallpaperService.Roots {
+		rootOrder[root.Label] = i
+	}
+	slices.SortFunc(wallpapers, func(a, b model.Wallpaper) int {
+		return cmp.Or(
+			cmp.Compare(rootOrder[a.Root], rootOrder[b.Root]),
+			cmp.Compare(a.Dir, b.Dir),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+
+	l.setLibrary(wallpapers)
+	l.applyFilterSelecting(selected)
+}
+
+func (l *ListManager) applyFilter() {
+	l.applyFilterSelecting(l.selectedPath())
+}
+
+// applyFilterSelecting filters and sorts the list and selects the wallpaper
+// at path again if it is still shown.
+func (l *ListManager) applyFilterSelecting(path string) {
+	l.wallpapers = l.filtered()
+	l.selectedIndex = -1
+	l.wallpaperList.UnselectAll()
+	l.wallpaperGrid.UnselectAll()
 	l.wallpaperList.Refresh()
+	l.wallpaperGrid.Refresh()
 
-	return nil
+	if path == "" {
+		return
+	}
+	for i, wp := range l.wallpapers {
+		if wp.Path == path {
+			l.SelectWallpaper(i)
+			return
+		}
+	}
+	// The selected wallpaper was filtered out or removed.
+	l.selected(-1)
+}
+
+func (l *ListManager) selectedPath() string {
+	if wp := l.GetSelectedWallpaper(); wp != nil {
+		return wp.Path
+	}
+	return ""
 }
 
 func (l *ListManager) GetWallpaper(index int) *model.Wallpaper {
@@ -70,7 +407,12 @@ func (l *ListManager) GetSelectedWallpaper() *model.Wallpaper {
 }
 
 func (l *ListManager) SelectWallpaper(index int) {
-	if index >= 0 && index < len(l.wallpapers) {
+	if index < 0 || index >= len(l.wallpapers) {
+		return
+	}
+	if l.gridView {
+		l.wallpaperGrid.Select(index)
+	} else {
 		l.wallpaperList.Select(index)
 	}
 }
@@ -83,8 +425,9 @@ func (l *ListManager) GetWallpaperCount() int {
 	return len(l.wallpapers)
 }
 
-func (l *ListManager) GetListWidget() *widget.List {
-	return l.wallpaperList
+// GetView returns the list and the grid, of which one is shown.
+func (l *ListManager) GetView() *fyne.Container {
+	return l.view
 }
 
 func (l *ListManager) ShowFolderDialog(parent fyne.Window, onSelect func(string)) {
@@ -103,9 +446,11 @@ func (l *ListManager) ShowFolderDialog(parent fyne.Window, onSelect func(string)
 		}
 	}, parent)
 
-	startDir, _ := storage.ListerForURI(storage.NewFileURI(l.wallpaperService.WallpaperDir))
-	if startDir != nil {
-		folderDialog.SetLocation(startDir)
+	if roots := l.wallpaperService.Roots; len(roots) > 0 {
+		startDir, _ := storage.ListerForURI(storage.NewFileURI(roots[0].Path))
+		if startDir != nil {
+			folderDialog.SetLocation(startDir)
+		}
 	}
 
 	folderDialog.Show()
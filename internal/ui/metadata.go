@@ -0,0 +1,196 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+	"golang.org/x/sync/semaphore"
+)
+
+const swatchSize = 20
+
+// MetadataLoader extracts wallpaper metadata in the background, at most
+// maxConcurrent images at a time, for the list and preview to show once it
+// is ready.
+type MetadataLoader struct {
+	extractor     *service.MetadataExtractor
+	mutex         sync.Mutex
+	loading       map[string]bool
+	failed        map[string]error
+	sem           *semaphore.Weighted
+	maxConcurrent int64
+}
+
+func NewMetadataLoader(extractor *service.MetadataExtractor, maxConcurrent int64) *MetadataLoader {
+	return &MetadataLoader{
+		extractor:     extractor,
+		loading:       make(map[string]bool),
+		failed:        make(map[string]error),
+		sem:           semaphore.NewWeighted(maxConcurrent),
+		maxConcurrent: maxConcurrent,
+	}
+}
+
+// Get returns the metadata of wp if it has been extracted. Otherwise it
+// starts extracting it and calls onLoaded on the UI goroutine once it is
+// ready. Nothing is loaded for images that cannot be decoded.
+func (l *MetadataLoader) Get(wp model.Wallpaper, onLoaded func()) *model.Metadata {
+	if metadata := l.extractor.Cached(wp); metadata != nil || wp.Unsupported != "" {
+		return metadata
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.loading[wp.Path] {
+		l.loading[wp.Path] = true
+		go l.load(wp, onLoaded)
+	}
+	return nil
+}
+
+func (l *MetadataLoader) load(wp model.Wallpaper, onLoaded func()) {
+	if err := l.sem.Acquire(context.Background(), 1); err != nil {
+		return
+	}
+	defer l.sem.Release(1)
+
+	_, err := l.extractor.Extract(wp)
+
+	// Failed images stay marked as loading so they are not retried on
+	// every refresh of the list.
+	l.mutex.Lock()
+	if err != nil {
+		l.failed[wp.Path] = err
+	} else {
+		delete(l.loading, wp.Path)
+	}
+	l.mutex.Unlock()
+	fyne.Do(onLoaded)
+}
+
+// Cached returns the metadata of wp if it has been extracted, without
+// starting to extract it.
+func (l *MetadataLoader) Cached(wp model.Wallpaper) *model.Metadata {
+	return l.extractor.Cached(wp)
+}
+
+// LoadAll extracts the metadata of every wallpaper in the background and
+// calls onDone on the UI goroutine once all of it that can be read has been,
+// unless ctx is cancelled first.
+func (l *MetadataLoader) LoadAll(ctx context.Context, wallpapers []model.Wallpaper, onDone func()) {
+	wallpapers = slices.Clone(wallpapers)
+	go func() {
+		if l.extractor.ExtractAll(ctx, wallpapers, l.maxConcurrent) == nil {
+			fyne.Do(func() {
+				if ctx.Err() == nil {
+					onDone()
+				}
+			})
+		}
+	}()
+}
+
+// Err returns why the metadata of path could not be extracted, if it failed.
+func (l *MetadataLoader) Err(path string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.failed[path]
+}
+
+// Forget lets the metadata of path be extracted again after a failure,
+// because the file changed.
+func (l *MetadataLoader) Forget(path string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, failed := l.failed[path]; failed {
+		delete(l.failed, path)
+		delete(l.loading, path)
+	}
+}
+
+// formatDimensions describes the size and shape of an image, such as
+// "1920 × 1080 (16:9, landscape)".
+func formatDimensions(m *model.Metadata) string {
+	return fmt.Sprintf("%d × %d (%s, %s)", m.Width, m.Height, aspectLabel(m.Width, m.Height), m.Orientation)
+}
+
+// aspectLabel reduces width:height to a ratio like "16:9", falling back to
+// "1.78:1" when the reduced terms are not small enough to be recognisable.
+func aspectLabel(width, height int) string {
+	a, b := width, height
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if w, h := width/a, height/a; w <= 32 && h <= 32 {
+		return fmt.Sprintf("%d:%d", w, h)
+	}
+	return fmt.Sprintf("%.2f:1", float64(width)/float64(height))
+}
+
+func formatFileSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, suffix := float64(size)/unit, "KMGT"
+	for i := 0; ; i++ {
+		if value < unit || i == len(suffix)-1 {
+			return fmt.Sprintf("%.1f %ciB", value, suffix[i])
+		}
+		value /= unit
+	}
+}
+
+// metadataDetails is the text shown under the preview of wp. err is why the
+// metadata could not be read, if it could not.
+func metadataDetails(wp model.Wallpaper, m *model.Metadata, err error) string {
+	lines := []string{wp.Path}
+
+	file := []string{}
+	if wp.Format != "" {
+		file = append(file, strings.ToUpper(wp.Format))
+	}
+	file = append(file, formatFileSize(wp.Size))
+	if !wp.ModTime.IsZero() {
+		file = append(file, "modified "+wp.ModTime.Local().Format(time.DateTime))
+	}
+	lines = append(lines, strings.Join(file, " • "))
+
+	switch {
+	case wp.Unsupported != "":
+		lines = append(lines, wp.Unsupported)
+	case err != nil:
+		lines = append(lines, err.Error())
+	case m == nil:
+		lines = append(lines, "Reading image…")
+	default:
+		lines = append(lines, formatDimensions(m), "SHA-256 "+m.SHA256)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// colorSwatches shows the dominant colours of an image.
+func colorSwatches(colors []string) []fyne.CanvasObject {
+	swatches := make([]fyne.CanvasObject, 0, len(colors))
+	for _, hex := range colors {
+		var c color.NRGBA
+		if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+			continue
+		}
+		c.A = 0xff
+
+		swatch := canvas.NewRectangle(c)
+		swatch.SetMinSize(fyne.NewSize(swatchSize, swatchSize))
+		swatches = append(swatches, swatch)
+	}
+	return swatches
+}
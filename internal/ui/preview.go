@@ -2,6 +2,7 @@ package ui
 
 import (
 	"context"
+	"fmt"
 	"image"
 	"os"
 	"runtime"
@@ -15,6 +16,7 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"github.com/disintegration/imaging"
 	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -150,6 +152,17 @@ func (c *ImageCache) removeFromLRU(path string) {
 	}
 }
 
+func (c *ImageCache) Remove(path string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if img, exists := c.cache[path]; exists {
+		c.removeFromLRU(path)
+		delete(c.cache, path)
+		c.currentSize -= img.Size
+	}
+}
+
 func (c *ImageCache) Clear() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -162,6 +175,11 @@ func (c *ImageCache) Clear() {
 
 type PreviewManager struct {
 	previewContainer *fyne.Container
+	detailsContainer *fyne.Container
+	detailsLabel     *widget.Label
+	swatches         *fyne.Container
+	metadata         *MetadataLoader
+	tags             *TagEditor
 	imageContainer   *fyne.Container
 	placeholderImg   *canvas.Text
 	loadingText      *canvas.Text
@@ -175,11 +193,11 @@ type PreviewManager struct {
 }
 
 type previewUpdate struct {
-	img  *canvas.Image
-	path string
+	content fyne.CanvasObject
+	path    string
 }
 
-func NewPreviewManager() *PreviewManager {
+func NewPreviewManager(cacheSizeMB int, maxConcurrent int64, maxPreviewSize int, metadata *MetadataLoader, tags *TagEditor) *PreviewManager {
 	placeholderImg := canvas.NewText("No preview available", theme.Color(theme.ColorNameBackground))
 	placeholderImg.Alignment = fyne.TextAlignCenter
 
@@ -197,17 +215,26 @@ func NewPreviewManager() *PreviewManager {
 		container.NewVBox(loadingText, loadingProgress),
 	)
 
+	detailsLabel := widget.NewLabel("")
+	detailsLabel.Wrapping = fyne.TextWrapBreak
+	swatches := container.NewHBox()
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	pm := &PreviewManager{
 		previewContainer: mainContainer,
+		detailsContainer: container.NewVBox(detailsLabel, swatches, tags.GetContainer()),
+		detailsLabel:     detailsLabel,
+		swatches:         swatches,
+		metadata:         metadata,
+		tags:             tags,
 		imageContainer:   imageContainer,
 		placeholderImg:   placeholderImg,
 		loadingText:      loadingText,
 		loadingProgress:  loadingProgress,
-		imageCache:       NewImageCache(200, 3),
+		imageCache:       NewImageCache(cacheSizeMB, maxConcurrent),
 		updateChan:       make(chan previewUpdate, 2),
-		maxPreviewSize:   1200,
+		maxPreviewSize:   maxPreviewSize,
 		ctx:              ctx,
 		cancelLoading:    cancel,
 	}
@@ -223,7 +250,7 @@ func (p *PreviewManager) handleUpdates() {
 			continue
 		}
 		p.imageContainer.RemoveAll()
-		p.imageContainer.Add(update.img)
+		p.imageContainer.Add(update.content)
 		p.loadingText.Hide()
 		p.loadingProgress.Hide()
 		p.previewContainer.Refresh()
@@ -246,6 +273,12 @@ func (p *PreviewManager) UpdatePreview(wallpaper *model.Wallpaper) {
 	p.cancelLoading = cancel
 
 	p.currentPath = wallpaper.Path
+	p.updateDetails(*wallpaper)
+
+	if wallpaper.Unsupported != "" {
+		p.showMessage(wallpaper.Path, fmt.Sprintf("Cannot preview %s: %s", wallpaper.Name, wallpaper.Unsupported))
+		return
+	}
 
 	p.loadingText.Show()
 	p.loadingProgress.SetValue(0.0)
@@ -260,11 +293,38 @@ func (p *PreviewManager) UpdatePreview(wallpaper *model.Wallpaper) {
 	go p.loadAndCacheImage(wallpaper.Path, ctx)
 }
 
+// updateDetails shows the metadata and tags of wp under the preview, filling
+// in the metadata once it has been extracted.
+func (p *PreviewManager) updateDetails(wp model.Wallpaper) {
+	metadata := p.metadata.Get(wp, func() {
+		if p.currentPath == wp.Path {
+			p.updateDetails(wp)
+		}
+	})
+
+	p.detailsLabel.SetText(metadataDetails(wp, metadata, p.metadata.Err(wp.Path)))
+	p.swatches.RemoveAll()
+	if metadata != nil {
+		for _, swatch := range colorSwatches(metadata.Colors) {
+			p.swatches.Add(swatch)
+		}
+	}
+	p.tags.Show(wp, metadata)
+}
+
 func (p *PreviewManager) displayCachedImage(img image.Image, path string) {
 	canvasImg := canvas.NewImageFromImage(img)
 	canvasImg.FillMode = canvas.ImageFillContain
 	canvasImg.ScaleMode = canvas.ImageScaleSmooth
-	p.updateChan <- previewUpdate{img: canvasImg, path: path}
+	p.updateChan <- previewUpdate{content: canvasImg, path: path}
+}
+
+// showMessage replaces the preview of path with text, for images that cannot
+// be shown.
+func (p *PreviewManager) showMessage(path, text string) {
+	message := canvas.NewText(text, theme.Color(theme.ColorNameForeground))
+	message.Alignment = fyne.TextAlignCenter
+	p.updateChan <- previewUpdate{content: container.NewCenter(message), path: path}
 }
 
 func (p *PreviewManager) loadAndCacheImage(path string, ctx context.Context) {
@@ -281,11 +341,13 @@ func (p *PreviewManager) loadAndCacheImage(path string, ctx context.Context) {
 
 	dimensions, err := getImageDimensions(path)
 	if err != nil {
+		p.showMessage(path, fmt.Sprintf("Cannot preview: %v", err))
 		return
 	}
 
 	img, err := p.loadOptimizedImage(path, dimensions)
-	if err != nil || img == nil {
+	if err != nil {
+		p.showMessage(path, fmt.Sprintf("Cannot preview: %v", err))
 		return
 	}
 
@@ -353,13 +415,7 @@ func (p *PreviewManager) loadDownsampledImage(path string, dimensions image.Poin
 }
 
 func getImageDimensions(path string) (image.Point, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return image.Point{}, err
-	}
-	defer file.Close()
-
-	config, _, err := image.DecodeConfig(file)
+	config, err := service.DecodeImageConfig(path)
 	if err != nil {
 		return image.Point{}, err
 	}
@@ -374,6 +430,9 @@ func (p *PreviewManager) ClearPreview() {
 	p.cancelLoading = cancel
 
 	p.currentPath = ""
+	p.detailsLabel.SetText("")
+	p.swatches.RemoveAll()
+	p.tags.Clear()
 	p.imageContainer.RemoveAll()
 	p.imageContainer.Add(p.placeholderImg)
 	p.loadingText.Hide()
@@ -381,10 +440,22 @@ func (p *PreviewManager) ClearPreview() {
 	p.previewContainer.Refresh()
 }
 
+// Forget drops what is cached about paths, which changed on disk.
+func (p *PreviewManager) Forget(paths ...string) {
+	for _, path := range paths {
+		p.imageCache.Remove(path)
+		p.metadata.Forget(path)
+	}
+}
+
 func (p *PreviewManager) GetPreviewContainer() *fyne.Container {
 	return p.previewContainer
 }
 
+func (p *PreviewManager) GetDetailsContainer() *fyne.Container {
+	return p.detailsContainer
+}
+
 func (p *PreviewManager) Cleanup() {
 	p.cancelLoading()
 	p.imageCache.Clear()
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+const starSize = 14
+
+// The theme has no star or heart icons, so these are the Material Design
+// ones, recoloured by the themed resources below.
+var (
+	starIcon = fyne.NewStaticResource("star.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M12 17.27L18.18 21l-1.64-7.03L22 9.24l-7.19-.61L12 2 9.19 8.63 2 9.24l5.46 4.73L5.82 21z"/></svg>`))
+
+	heartIcon = fyne.NewStaticResource("favorite.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M12 21.35l-1.45-1.32C5.4 15.36 2 12.28 2 8.5 2 5.42 4.42 3 7.5 3c1.74 0 3.41.81 4.5 2.09C13.09 3.81 14.76 3 16.5 3 19.58 3 22 5.42 22 8.5c0 3.78-3.4 6.86-8.55 11.54L12 21.35z"/></svg>`))
+
+	heartBorderIcon = fyne.NewStaticResource("favorite_border.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M16.5 3c-1.74 0-3.41.81-4.5 2.09C10.91 3.81 9.24 3 7.5 3 4.42 3 2 5.42 2 8.5c0 3.78 3.4 6.86 8.55 11.54L12 21.35l1.45-1.32C18.6 15.36 22 12.28 22 8.5 22 5.42 19.58 3 16.5 3zm-4.4 15.55l-.1.1-.1-.1C7.14 14.24 4 11.39 4 8.5 4 6.5 5.5 5 7.5 5c1.54 0 3.04.99 3.57 2.36h1.87C13.46 5.99 14.96 5 16.5 5c2 0 3.5 1.5 3.5 3.5 0 2.89-3.14 5.74-7.9 10.05z"/></svg>`))
+)
+
+var (
+	ratedStar   = theme.NewPrimaryThemedResource(starIcon)
+	unratedStar = theme.NewDisabledResource(starIcon)
+	favorite    = theme.NewErrorThemedResource(heartIcon)
+	notFavorite = theme.NewThemedResource(heartBorderIcon)
+)
+
+// favoriteIcon is the icon of the favorite toggle in its current state.
+func favoriteIcon(isFavorite bool) fyne.Resource {
+	if isFavorite {
+		return favorite
+	}
+	return notFavorite
+}
+
+// starRating shows a rating as a row of stars. Tapping a star rates that
+// many stars, and tapping the current rating clears it.
+type starRating struct {
+	widget.BaseWidget
+	stars     []*canvas.Image
+	rating    int
+	OnChanged func(stars int)
+}
+
+func newStarRating() *starRating {
+	s := &starRating{}
+	for range service.MaxStars {
+		star := canvas.NewImageFromResource(unratedStar)
+		star.FillMode = canvas.ImageFillContain
+		star.SetMinSize(fyne.NewSquareSize(starSize))
+		s.stars = append(s.stars, star)
+	}
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+func (s *starRating) CreateRenderer() fyne.WidgetRenderer {
+	row := container.New(&starLayout{})
+	for _, star := range s.stars {
+		row.Add(star)
+	}
+	return widget.NewSimpleRenderer(row)
+}
+
+func (s *starRating) SetRating(stars int) {
+	if s.rating == stars {
+		return
+	}
+	s.rating = stars
+	for i, star := range s.stars {
+		if i < stars {
+			star.Resource = ratedStar
+		} else {
+			star.Resource = unratedStar
+		}
+		star.Refresh()
+	}
+}
+
+func (s *starRating) Tapped(event *fyne.PointEvent) {
+	stars := service.MaxStars
+	for i, star := range s.stars {
+		if event.Position.X < star.Position().X+star.Size().Width {
+			stars = i + 1
+			break
+		}
+	}
+	if stars == s.rating {
+		stars = 0
+	}
+
+	s.SetRating(stars)
+	if s.OnChanged != nil {
+		s.OnChanged(stars)
+	}
+}
+
+// starLayout places the stars next to each other without padding, so the row
+// reads as one control.
+type starLayout struct{}
+
+func (*starLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	x := float32(0)
+	for _, o := range objects {
+		o.Resize(o.MinSize())
+		o.Move(fyne.NewPos(x, (size.Height-o.MinSize().Height)/2))
+		x += o.MinSize().Width
+	}
+}
+
+func (*starLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	var size fyne.Size
+	for _, o := range objects {
+		size.Width += o.MinSize().Width
+		size.Height = max(size.Height, o.MinSize().Height)
+	}
+	return size
+}
@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"context"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// rotationRefreshInterval is how often the rotation status is read again,
+// to follow the process running the rotation.
+const rotationRefreshInterval = 30 * time.Second
+
+// RotationControls pause, resume and skip the rotation, which runs in its
+// own process, `wallpaper-manager rotate`, and show when it changes the
+// wallpaper next.
+type RotationControls struct {
+	rotation *service.Rotation
+	status   service.RotationStatus
+
+	label     *widget.Label
+	pauseBtn  *widget.Button
+	skipBtn   *widget.Button
+	container *fyne.Container
+
+	// OnSkipped is called after Skip changed the wallpaper.
+	OnSkipped func()
+	// OnError is called with errors controlling the rotation.
+	OnError func(error)
+}
+
+func NewRotationControls(rotation *service.Rotation) *RotationControls {
+	c := &RotationControls{rotation: rotation}
+
+	c.label = widget.NewLabel("")
+	c.label.Truncation = fyne.TextTruncateEllipsis
+	c.pauseBtn = widget.NewButtonWithIcon("", theme.MediaPauseIcon(), c.togglePause)
+	c.skipBtn = widget.NewButtonWithIcon("", theme.MediaSkipNextIcon(), c.skip)
+
+	c.container = container.NewBorder(nil, nil,
+		widget.NewLabel("Rotation:"),
+		container.NewHBox(c.pauseBtn, c.skipBtn),
+		c.label,
+	)
+
+	c.Refresh()
+	go func() {
+		for range time.Tick(rotationRefreshInterval) {
+			c.Refresh()
+		}
+	}()
+	return c
+}
+
+func (c *RotationControls) GetContainer() *fyne.Container {
+	return c.container
+}
+
+// Refresh reads the rotation status again in the background. The status
+// asks the backend for its outputs, which may run a command.
+func (c *RotationControls) Refresh() {
+	go func() {
+		status, err := c.rotation.Status()
+		fyne.Do(func() { c.show(status, err) })
+	}()
+}
+
+func (c *RotationControls) show(status service.RotationStatus, err error) {
+	if err != nil {
+		c.label.SetText(err.Error())
+		c.pauseBtn.Disable()
+		c.skipBtn.Disable()
+		return
+	}
+	c.status = status
+	c.pauseBtn.Enable()
+	c.skipBtn.Enable()
+
+	if status.Paused {
+		c.pauseBtn.SetIcon(theme.MediaPlayIcon())
+	} else {
+		c.pauseBtn.SetIcon(theme.MediaPauseIcon())
+	}
+
+	var next time.Time
+	for _, o := range status.Outputs {
+		if !o.NextAt.IsZero() && (next.IsZero() || o.NextAt.Before(next)) {
+			next = o.NextAt
+		}
+	}
+	switch {
+	case status.Paused:
+		c.label.SetText("Paused")
+	case !status.Running:
+		c.label.SetText("Not running")
+	case next.IsZero():
+		c.label.SetText("Starting")
+	default:
+		c.label.SetText("Next at " + next.Local().Format(time.TimeOnly))
+	}
+}
+
+func (c *RotationControls) togglePause() {
+	paused := c.status.Paused
+	c.run(func() error {
+		if paused {
+			return c.rotation.Resume()
+		}
+		return c.rotation.Pause()
+	})
+}
+
+// skip changes the wallpaper of every rotated output to the next of its
+// playlist.
+func (c *RotationControls) skip() {
+	c.run(func() error {
+		if err := c.rotation.Skip(context.Background(), ""); err != nil {
+			return err
+		}
+		if c.OnSkipped != nil {
+			fyne.Do(c.OnSkipped)
+		}
+		return nil
+	})
+}
+
+// run does action in the background, since it may scan folders, with the
+// buttons disabled, and shows the status afterwards.
+func (c *RotationControls) run(action func() error) {
+	c.pauseBtn.Disable()
+	c.skipBtn.Disable()
+	go func() {
+		err := action()
+		fyne.Do(func() {
+			if err != nil && c.OnError != nil {
+				c.OnError(err)
+			}
+			c.Refresh()
+		})
+	}()
+}
@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"path/filepath"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+)
+
+// scheduleCell shows the wallpaper in effect at the start of one hour.
+type scheduleCell struct {
+	highlight *canvas.Rectangle
+	thumb     *canvas.Image
+	hour      *widget.Label
+	name      *widget.Label
+	cancel    func()
+}
+
+// showScheduleWindow previews the schedule: the wallpaper in effect at each
+// hour of a day on one output, with the day's sunrise and sunset.
+func (a *App) showScheduleWindow() {
+	schedule := a.config.ScheduleOptions()
+
+	scheduleWindow := a.fyneApp.NewWindow("Wallpaper Schedule")
+	scheduleWindow.Resize(fyne.NewSize(720, 560))
+	closeBtn := container.NewCenter(widget.NewButton("Close", func() { scheduleWindow.Close() }))
+
+	if schedule.Empty() {
+		scheduleWindow.SetContent(container.NewBorder(nil, closeBtn, nil, nil,
+			container.NewCenter(widget.NewLabel("No schedule is configured. Add rules or dynamic wallpapers\nto the [schedule] section of the config file.")),
+		))
+		scheduleWindow.CenterOnScreen()
+		scheduleWindow.Show()
+		return
+	}
+
+	day := time.Now()
+	output := ""
+	loaded := false
+
+	dayLabel := widget.NewLabel("")
+	dayLabel.Alignment = fyne.TextAlignCenter
+	sunLabel := widget.NewLabel("Loading schedule...")
+	sunLabel.Alignment = fyne.TextAlignCenter
+
+	cells := make([]*scheduleCell, 24)
+	grid := container.NewGridWithColumns(4)
+	for i := range cells {
+		cell := &scheduleCell{
+			highlight: canvas.NewRectangle(theme.Color(theme.ColorNameSelection)),
+			thumb:     canvas.NewImageFromImage(nil),
+			hour:      widget.NewLabel(fmt.Sprintf("%02d:00", i)),
+			name:      widget.NewLabel(""),
+		}
+		cell.highlight.Hide()
+		cell.thumb.FillMode = canvas.ImageFillContain
+		cell.thumb.SetMinSize(fyne.NewSize(thumbnailWidth, thumbnailHeight))
+		cell.name.Truncation = fyne.TextTruncateEllipsis
+		cells[i] = cell
+		grid.Add(container.NewStack(cell.highlight, container.NewBorder(nil, nil,
+			cell.thumb, nil, container.NewVBox(cell.hour, cell.name),
+		)))
+	}
+
+	update := func() {
+		dayLabel.SetText(day.Format("Monday, 2 January 2006"))
+		if !loaded {
+			return
+		}
+
+		sunrise, sunset, up, ok := schedule.SunTimes(day)
+		switch {
+		case schedule.Latitude == 0 && schedule.Longitude == 0:
+			sunLabel.SetText("")
+		case ok:
+			sunLabel.SetText(fmt.Sprintf("Sunrise %s • Sunset %s", sunrise.Format("15:04"), sunset.Format("15:04")))
+		case up:
+			sunLabel.SetText("The sun does not set")
+		default:
+			sunLabel.SetText("The sun does not rise")
+		}
+
+		now := time.Now()
+		today := now.Format(time.DateOnly) == day.Format(time.DateOnly)
+		for hour, change := range schedule.Timeline(day, output) {
+			cell := cells[hour]
+			if cell.cancel != nil {
+				cell.cancel()
+				cell.cancel = nil
+			}
+			if today && hour == now.Hour() {
+				cell.highlight.Show()
+			} else {
+				cell.highlight.Hide()
+			}
+
+			if change.Path == "" {
+				cell.name.SetText("Not scheduled")
+				cell.thumb.Image = nil
+				cell.thumb.Refresh()
+				continue
+			}
+			cell.name.SetText(filepath.Base(change.Path))
+			cell.thumb.Image, _, cell.cancel = a.thumbnails.Get(model.Wallpaper{Path: change.Path}, func(img image.Image) {
+				cell.thumb.Image = img
+				cell.thumb.Refresh()
+			})
+			cell.thumb.Refresh()
+		}
+	}
+
+	prevBtn := widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+		day = day.AddDate(0, 0, -1)
+		update()
+	})
+	nextBtn := widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() {
+		day = day.AddDate(0, 0, 1)
+		update()
+	})
+	todayBtn := widget.NewButton("Today", func() {
+		day = time.Now()
+		update()
+	})
+
+	outputOptions := []string{allOutputsLabel}
+	for _, o := range a.outputs {
+		outputOptions = append(outputOptions, o.Name)
+	}
+	outputSelect := widget.NewSelect(outputOptions, func(selected string) {
+		output = selected
+		if selected == allOutputsLabel {
+			output = ""
+		}
+		update()
+	})
+	outputSelect.SetSelected(allOutputsLabel)
+
+	scheduleWindow.SetContent(container.NewBorder(
+		container.NewVBox(
+			container.NewBorder(nil, nil, container.NewHBox(prevBtn, todayBtn), nextBtn, dayLabel),
+			container.NewBorder(nil, nil, widget.NewLabel("Output:"), nil, outputSelect),
+			sunLabel,
+		),
+		closeBtn,
+		nil,
+		nil,
+		container.NewVScroll(grid),
+	))
+	scheduleWindow.SetOnClosed(func() {
+		for _, cell := range cells {
+			if cell.cancel != nil {
+				cell.cancel()
+			}
+		}
+	})
+	scheduleWindow.CenterOnScreen()
+	scheduleWindow.Show()
+
+	// Reading the folders of dynamic wallpapers scans the disk.
+	go func() {
+		err := schedule.ReadFolders(context.Background(), a.wallpaperService.Scan)
+		fyne.Do(func() {
+			if err != nil {
+				sunLabel.SetText(fmt.Sprintf("Error loading schedule: %v", err))
+				return
+			}
+			loaded = true
+			update()
+		})
+	}()
+}
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Scores of fuzzyScore for each letter found, and the bonuses for letters
+// right after the previous one and for letters starting a word.
+const (
+	fuzzyMatchScore       = 1
+	fuzzyConsecutiveBonus = 5
+	fuzzyWordStartBonus   = 8
+)
+
+// fuzzyScore reports whether every word of query appears in name with its
+// letters in order, though not necessarily next to each other, and how well
+// it matches: letters next to each other and at the start of words score
+// higher, and letters far apart lower. Case is ignored. An empty query
+// matches every name equally.
+func fuzzyScore(query, name string) (int, bool) {
+	runes := []rune(name)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	total := 0
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		score, ok := fuzzyWordScore([]rune(word), lower, runes)
+		if !ok {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+// fuzzyWordScore finds word in lower, the lowercased name, starting from
+// every occurrence of its first letter and keeping the best score.
+func fuzzyWordScore(word, lower, name []rune) (int, bool) {
+	best, found := 0, false
+	for start := range lower {
+		if lower[start] != word[0] {
+			continue
+		}
+
+		score, previous, matched := 0, -1, 0
+		for i := start; i < len(lower) && matched < len(word); i++ {
+			if lower[i] != word[matched] {
+				continue
+			}
+			score += fuzzyMatchScore
+			switch {
+			case previous >= 0 && i == previous+1:
+				score += fuzzyConsecutiveBonus
+			case wordStart(name, i):
+				score += fuzzyWordStartBonus
+			}
+			if previous >= 0 {
+				score -= i - previous - 1
+			}
+			previous = i
+			matched++
+		}
+		if matched == len(word) && (!found || score > best) {
+			best, found = score, true
+		}
+	}
+	return best, found
+}
+
+// wordStart reports whether name[i] starts a word: it follows a separator
+// such as "_" or "-", or is an uppercase letter after a lowercase one, or a
+// digit after a letter.
+func wordStart(name []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	previous, current := name[i-1], name[i]
+	switch {
+	case !unicode.IsLetter(previous) && !unicode.IsDigit(previous):
+		return true
+	case unicode.IsLower(previous) && unicode.IsUpper(current):
+		return true
+	case unicode.IsLetter(previous) && unicode.IsDigit(current):
+		return true
+	}
+	return false
+}
+
+// searchEntry is an entry that passes the up and down keys to onNavigate, so
+// the list can be browsed while typing, and clears itself on Escape.
+type searchEntry struct {
+	widget.Entry
+	onNavigate func(delta int)
+}
+
+func newSearchEntry(onNavigate func(delta int)) *searchEntry {
+	e := &searchEntry{onNavigate: onNavigate}
+	e.ActionItem = widget.NewIcon(theme.SearchIcon())
+	e.ExtendBaseWidget(e)
+	return e
+}
+
+func (e *searchEntry) TypedKey(key *fyne.KeyEvent) {
+	switch key.Name {
+	case fyne.KeyUp:
+		e.onNavigate(-1)
+	case fyne.KeyDown:
+		e.onNavigate(1)
+	case fyne.KeyEscape:
+		e.SetText("")
+	default:
+		e.Entry.TypedKey(key)
+	}
+}
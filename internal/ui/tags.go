@@ -0,0 +1,182 @@
+package ui
+
+import (
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// TagEditor edits the tags of the wallpaper in the preview. Each tag is a
+// button that removes it, new ones are typed into an entry, and the keywords
+// embedded in the image can be added with one button. Changes are saved
+// right away.
+type TagEditor struct {
+	wallpaperService *service.WallpaperService
+	path             string
+	tags             []string
+	keywords         []string
+
+	chips     *fyne.Container
+	entry     *widget.Entry
+	importBtn *widget.Button
+	container *fyne.Container
+
+	// OnChanged is called with the tags of path after they were saved.
+	OnChanged func(path string, tags []string)
+	// OnError is called with errors saving tags.
+	OnError func(error)
+}
+
+func NewTagEditor(wallpaperServ *service.WallpaperService) *TagEditor {
+	e := &TagEditor{wallpaperService: wallpaperServ}
+
+	e.chips = container.New(&flowLayout{})
+	e.entry = widget.NewEntry()
+	e.entry.SetPlaceHolder("Add tags, separated by commas")
+	e.entry.OnSubmitted = func(text string) {
+		e.entry.SetText("")
+		e.save(append(slices.Clone(e.tags), strings.Split(text, ",")...))
+	}
+	e.importBtn = widget.NewButtonWithIcon("Import keywords", theme.DownloadIcon(), func() {
+		e.save(append(slices.Clone(e.tags), e.keywords...))
+	})
+	e.importBtn.Hide()
+
+	e.container = container.NewVBox(
+		e.chips,
+		container.NewBorder(nil, nil, widget.NewLabel("Tags:"), e.importBtn, e.entry),
+	)
+	e.container.Hide()
+	return e
+}
+
+// Show edits the tags of wp, offering to import the keywords in metadata.
+// While wp stays the same, the tags saved since are kept.
+func (e *TagEditor) Show(wp model.Wallpaper, metadata *model.Metadata) {
+	if wp.Path != e.path {
+		e.path = wp.Path
+		e.tags = wp.Tags
+		e.entry.SetText("")
+	}
+	e.keywords = nil
+	if metadata != nil {
+		e.keywords = service.NormalizeTags(metadata.Keywords)
+	}
+	e.update()
+	e.container.Show()
+}
+
+// Clear hides the editor when no wallpaper is shown.
+func (e *TagEditor) Clear() {
+	e.path = ""
+	e.tags = nil
+	e.keywords = nil
+	e.container.Hide()
+}
+
+func (e *TagEditor) GetContainer() *fyne.Container {
+	return e.container
+}
+
+func (e *TagEditor) save(tags []string) {
+	path := e.path
+	tags, err := e.wallpaperService.SetTags(path, tags)
+	if err != nil {
+		if e.OnError != nil {
+			e.OnError(err)
+		}
+		return
+	}
+
+	e.tags = tags
+	e.update()
+	if e.OnChanged != nil {
+		e.OnChanged(path, tags)
+	}
+}
+
+func (e *TagEditor) update() {
+	e.chips.RemoveAll()
+	for _, tag := range e.tags {
+		chip := widget.NewButtonWithIcon(tag, theme.CancelIcon(), func() {
+			e.save(slices.DeleteFunc(slices.Clone(e.tags), func(t string) bool { return t == tag }))
+		})
+		chip.IconPlacement = widget.ButtonIconTrailingText
+		chip.Importance = widget.LowImportance
+		e.chips.Add(chip)
+	}
+	if len(e.tags) > 0 {
+		e.chips.Show()
+	} else {
+		e.chips.Hide()
+	}
+	e.chips.Refresh()
+
+	imported := true
+	for _, keyword := range e.keywords {
+		if !slices.Contains(e.tags, keyword) {
+			imported = false
+			break
+		}
+	}
+	if imported {
+		e.importBtn.Hide()
+	} else {
+		e.importBtn.Show()
+	}
+}
+
+// flowLayout places objects in rows, starting a new row when the next one
+// does not fit. Its minimum height is that of the rows at the last width it
+// was laid out with.
+type flowLayout struct {
+	width float32
+}
+
+func (f *flowLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	resized := f.width != size.Width
+	f.width = size.Width
+	f.place(objects, size.Width, true)
+	if resized && len(objects) > 0 {
+		// Have the parent ask for the height of the rows at the new width.
+		fyne.Do(objects[0].Refresh)
+	}
+}
+
+func (f *flowLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	return f.place(objects, f.width, false)
+}
+
+// place lays objects out in rows of at most width, or one row if width is
+// not known yet, moving them if move is set, and returns the size they take.
+func (f *flowLayout) place(objects []fyne.CanvasObject, width float32, move bool) fyne.Size {
+	padding := theme.Padding()
+	var x, y, rowHeight float32
+	var size fyne.Size
+	for _, o := range objects {
+		if !o.Visible() {
+			continue
+		}
+		objectSize := o.MinSize()
+		if x > 0 && width > 0 && x+objectSize.Width > width {
+			x = 0
+			y += rowHeight + padding
+			rowHeight = 0
+		}
+		if move {
+			o.Resize(objectSize)
+			o.Move(fyne.NewPos(x, y))
+		}
+		x += objectSize.Width + padding
+		rowHeight = max(rowHeight, objectSize.Height)
+		size.Width = max(size.Width, objectSize.Width)
+		size.Height = y + rowHeight
+	}
+	return size
+}
@@ -0,0 +1,150 @@
+package ui
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/hambosto/wallpaper-manager/internal/model"
+	"github.com/hambosto/wallpaper-manager/internal/service"
+)
+
+// thumbnailMemoryLimit is how many decoded thumbnails are kept in memory;
+// older ones are read back from the thumbnail cache when needed again.
+const thumbnailMemoryLimit = 512
+
+// ThumbnailLoader makes thumbnails in the background, at most maxConcurrent
+// at a time. The most recent requests are served first, so the cells that
+// just scrolled into view are filled before the ones scrolled past, and
+// requests are cancelled when their cell shows another wallpaper before its
+// turn comes.
+type ThumbnailLoader struct {
+	cache *service.ThumbnailCache
+	size  service.ThumbnailSize
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+	queue []*thumbnailRequest
+	// images holds the loaded thumbnails by path, oldest first in order.
+	// A nil image means none could be made.
+	images map[string]thumbnailImage
+	order  []string
+}
+
+type thumbnailRequest struct {
+	wp       model.Wallpaper
+	ctx      context.Context
+	cancel   context.CancelFunc
+	onLoaded func(image.Image)
+}
+
+type thumbnailImage struct {
+	size    int64
+	modTime time.Time
+	image   image.Image
+}
+
+func NewThumbnailLoader(cache *service.ThumbnailCache, size service.ThumbnailSize, maxConcurrent int) *ThumbnailLoader {
+	l := &ThumbnailLoader{
+		cache:  cache,
+		size:   size,
+		images: make(map[string]thumbnailImage),
+	}
+	l.cond = sync.NewCond(&l.mutex)
+	for range maxConcurrent {
+		go l.work()
+	}
+	return l
+}
+
+// Get returns the thumbnail of wp and true if it has been loaded, with a nil
+// image if none could be made. Otherwise it queues wp and calls onLoaded on
+// the UI goroutine with the thumbnail, or nil, once it is ready; the returned
+// function cancels the request.
+func (l *ThumbnailLoader) Get(wp model.Wallpaper, onLoaded func(image.Image)) (image.Image, bool, context.CancelFunc) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if loaded, ok := l.images[wp.Path]; ok && loaded.size == wp.Size && loaded.modTime.Equal(wp.ModTime) {
+		return loaded.image, true, nil
+	}
+	if wp.Unsupported != "" {
+		return nil, true, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.queue = append(l.queue, &thumbnailRequest{wp: wp, ctx: ctx, cancel: cancel, onLoaded: onLoaded})
+	l.cond.Signal()
+	return nil, false, cancel
+}
+
+// CancelAll cancels every queued request, such as when the grid is hidden.
+func (l *ThumbnailLoader) CancelAll() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, req := range l.queue {
+		req.cancel()
+	}
+	l.queue = nil
+}
+
+func (l *ThumbnailLoader) work() {
+	for {
+		l.mutex.Lock()
+		for len(l.queue) == 0 {
+			l.cond.Wait()
+		}
+		req := l.queue[len(l.queue)-1]
+		l.queue = l.queue[:len(l.queue)-1]
+		l.mutex.Unlock()
+
+		if req.ctx.Err() != nil {
+			continue
+		}
+		img, err := l.load(req.ctx, req.wp.Path)
+		if errors.Is(err, context.Canceled) {
+			continue
+		}
+		l.store(req.wp, img)
+
+		fyne.Do(func() {
+			if req.ctx.Err() == nil {
+				req.onLoaded(img)
+			}
+		})
+	}
+}
+
+func (l *ThumbnailLoader) load(ctx context.Context, path string) (image.Image, error) {
+	thumbPath, err := l.cache.Thumbnail(ctx, path, l.size)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(thumbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+func (l *ThumbnailLoader) store(wp model.Wallpaper, img image.Image) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, ok := l.images[wp.Path]; !ok {
+		l.order = append(l.order, wp.Path)
+	}
+	l.images[wp.Path] = thumbnailImage{size: wp.Size, modTime: wp.ModTime, image: img}
+
+	for len(l.order) > thumbnailMemoryLimit {
+		delete(l.images, l.order[0])
+		l.order = l.order[1:]
+	}
+}
@@ -3,19 +3,38 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
+	"github.com/hambosto/wallpaper-manager/internal/cli"
+	"github.com/hambosto/wallpaper-manager/internal/config"
+	"github.com/hambosto/wallpaper-manager/internal/service"
 	"github.com/hambosto/wallpaper-manager/internal/ui"
 )
 
 func main() {
-	defaultWallpaperDir := filepath.Join(os.Getenv("HOME"), "Pictures")
+	if len(os.Args) > 1 && os.Args[1] != "gui" {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
+	cfg, configErr := config.Load()
+	if configErr != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\nUsing default settings; changes will not be saved.\n", configErr)
+		cfg = config.Default()
+	}
 
-	if _, err := os.Stat(defaultWallpaperDir); os.IsNotExist(err) {
-		fmt.Printf("Default directory %s doesn't exist. Using current directory.\n", defaultWallpaperDir)
-		defaultWallpaperDir, _ = os.Getwd()
+	// Configured roots may be temporarily unavailable and are kept, but a
+	// missing default directory is replaced by the current one.
+	roots := cfg.Roots()
+	if len(roots) == 1 && roots[0].Path == config.DefaultWallpaperDir() {
+		if _, err := os.Stat(roots[0].Path); os.IsNotExist(err) {
+			fmt.Printf("Default directory %s doesn't exist. Using current directory.\n", roots[0].Path)
+			cwd, _ := os.Getwd()
+			roots = service.NewLibraryRoots(cwd)
+		}
 	}
 
-	app := ui.NewApp(defaultWallpaperDir)
+	app := ui.NewApp(cfg, roots)
+	if configErr != nil {
+		app.ReportError(fmt.Sprintf("Error loading config: %v", configErr))
+	}
 	app.Run()
 }
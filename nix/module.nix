@@ -11,18 +11,7 @@ with lib;
 let
   cfg = config.programs.wallpaper-manager;
 
-  wallpaper-activator = pkgs.writeShellScriptBin "wallpaper-activator" ''
-    WALLPAPER_PATH=$(${pkgs.coreutils}/bin/cat "${config.xdg.cacheHome}/.active_wallpaper")
-
-    if [[ -f "$WALLPAPER_PATH" ]]; then
-      ${lib.getExe pkgs.swww} img "$WALLPAPER_PATH" --transition-type outer
-      echo "Wallpaper set: $WALLPAPER_PATH"
-      exit 0
-    else
-      echo "Wallpaper file not found: $WALLPAPER_PATH"
-      exit 1
-    fi
-  '';
+  package = self.packages.${pkgs.system}.default;
 in
 {
   #
@@ -31,11 +20,38 @@ in
   options.programs.wallpaper-manager = {
     enable = mkEnableOption "Wallpaper Manager for managing desktop backgrounds";
 
-    # defaultTransition = mkOption {
-    #   type = types.str;
-    #   default = "outer";
-    #   description = "Default transition effect for wallpaper changes";
-    # };
+    defaultTransition = mkOption {
+      type = types.nullOr (types.enum [
+        "none"
+        "simple"
+        "fade"
+        "left"
+        "right"
+        "top"
+        "bottom"
+        "wipe"
+        "wave"
+        "grow"
+        "center"
+        "any"
+        "outer"
+        "random"
+      ]);
+      default = null;
+      description = "Transition effect used when restoring the wallpaper, overriding the one in config.toml";
+    };
+
+    defaultWallpaper = mkOption {
+      type = types.nullOr types.path;
+      default = null;
+      description = "Wallpaper to restore on login when none has been set yet";
+    };
+
+    restoreTimeout = mkOption {
+      type = types.ints.unsigned;
+      default = 30;
+      description = "Seconds to wait for swww-daemon before giving up on restoring the wallpaper";
+    };
 
     # wallust = {
     #   enable = mkEnableOption "Wallust integration for color scheme generation";
@@ -110,7 +126,7 @@ in
 
         wallpaper-activator = {
           Unit = {
-            Description = "Activate Wallpaper using SWWW";
+            Description = "Restore the wallpaper using SWWW";
             Requires = [ "swww.service" ];
             After = [ "swww.service" ];
             PartOf = [ "swww.service" ];
@@ -118,14 +134,29 @@ in
           Install.WantedBy = [ "swww.service" ];
           Service = {
             Type = "oneshot";
-            ExecStart = "${wallpaper-activator}/bin/wallpaper-activator";
-            Restart = "on-failure";
-            RestartSec = 3;
+            Environment = [
+              "WALLPAPER_MANAGER_BACKEND=swww"
+            ]
+            ++ optionals (cfg.defaultTransition != null) [
+              "WALLPAPER_MANAGER_TRANSITION=${cfg.defaultTransition}"
+            ];
+            ExecStart = concatStringsSep " " (
+              [
+                "${package}/bin/wallpaper-manager"
+                "restore"
+                "--timeout"
+                "${toString cfg.restoreTimeout}s"
+              ]
+              ++ optionals (cfg.defaultWallpaper != null) [
+                "--default"
+                (escapeShellArg (toString cfg.defaultWallpaper))
+              ]
+            );
           };
         };
       };
 
-      home.packages = with pkgs; [ self.packages.${system}.default ];
+      home.packages = [ package ];
     }
 
     # Wallust Integration
@@ -9,7 +9,7 @@ pkgs.buildGoModule {
   version = common.meta.version;
 
   src = ./../.;
-  vendorHash = "sha256-taM+1aqJ5ax21+aow+i5AQSy7GY+uYCncvVHlYiD8xg=";
+  vendorHash = "sha256-j1Gjxbb1G4374o1Mgu3C6/ddOlGvAjToUhsH1kRuEAA=";
 
   nativeBuildInputs = common.buildDeps ++ [
     pkgs.makeWrapper